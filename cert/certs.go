@@ -237,7 +237,6 @@ func LoadTLSCert(certf string) (cert tls.Certificate, ca *x509.Certificate, err
 		if block == nil {
 			return tls.Certificate{}, nil, fmt.Errorf("Failed to decode %s. Is it in PEM format?", certf)
 		}
-		fmt.Printf("FOUND BLOCK TYPE %s\n", block.Type)
 		if block.Type == "CERTIFICATE" {
 			certbs = block.Bytes
 		} else if block.Type == "RSA PRIVATE KEY" {
@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file implements the allocation of the tags and fids of a Client.
+//
+// Tags are numbered from 0, and _NOTAG is only used by Tversion. A tag is
+// held from when its call is made until the response arrives or, for a
+// call that is flushed, until the Tflush is answered. Once all of the
+// tags are held, calls wait for one to be returned. A few tags are kept
+// for Tflushes, so that calls waiting on a server can always be
+// abandoned.
+//
+// Fids are numbered from 1, as fid 0 is the root. A fid is returned once
+// it is clunked or removed. The Fids cached for paths are counted, and
+// only clunked once they are neither cached nor in use.
+
+const _NOTAG = ^uint16(0)
+
+// takeTag returns a tag for a call on fid, waiting for one if all are
+// held. It returns _NOTAG once c can no longer be used.
+func (c *Client) takeTag(fid uint32) uint16 {
+	c.Lock()
+	defer c.Unlock()
+	return c.lockedTakeTag(fid, false)
+}
+
+// lockedTakeTag is takeTag, for a Tflush if flush is set. c must be
+// locked.
+func (c *Client) lockedTakeTag(fid uint32, flush bool) uint16 {
+	limit := c.tagLimit
+	if !flush {
+		limit -= c.tagLimit/64 + 1
+	}
+	for c.err == nil {
+		if c.tagsHeld >= limit {
+			c.freed.Wait()
+			continue
+		}
+		var t uint16
+		if n := len(c.tags); n > 0 {
+			t = c.tags[n-1]
+			c.tags = c.tags[:n-1]
+		} else {
+			t = uint16(c.nextTag)
+			c.nextTag++
+		}
+		c.tagsHeld++
+		c.tagFids[t] = fid
+		return t
+	}
+	return _NOTAG
+}
+
+func (c *Client) returnTag(tag uint16) {
+	c.Lock()
+	defer c.Unlock()
+	c.lockedReturnTag(tag)
+}
+
+func (c *Client) lockedReturnTag(tag uint16) {
+	if tag == _NOTAG {
+		delete(c.calls, tag)
+		return
+	}
+	if _, ok := c.tagFids[tag]; !ok {
+		// Already returned.
+		return
+	}
+	c.tags = append(c.tags, tag)
+	c.tagsHeld--
+	delete(c.calls, tag)
+	delete(c.tagFids, tag)
+	c.freed.Broadcast()
+}
+
+// takeFid returns an unused fid, waiting for one if all are in use.
+func (c *Client) takeFid() uint32 {
+	c.Lock()
+	defer c.Unlock()
+	for {
+		if n := len(c.fids); n > 0 {
+			fid := c.fids[n-1]
+			c.fids = c.fids[:n-1]
+			return fid
+		}
+		if c.nextFid != _NOFID {
+			c.nextFid++
+			return c.nextFid - 1
+		}
+		c.freed.Wait()
+	}
+}
+
+func (c *Client) returnFid(fid uint32) {
+	if fid == c.rootFid || fid == _NOFID {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.fids = append(c.fids, fid)
+	c.freed.Broadcast()
+}
+
+// clunk clunks fid, and returns it.
+func (c *Client) clunk(ctx context.Context, s *session, fid uint32) error {
+	if fid == c.rootFid || fid == _NOFID {
+		return nil
+	}
+	clunk := proto.TClunk{
+		Header: proto.Header{proto.Tclunk, c.takeTag(fid)},
+		Fid:    fid,
+	}
+	res, err := c.rpc(ctx, s, &clunk)
+	// The fid is clunked even if the server returns an error.
+	c.returnFid(fid)
+	if err != nil {
+		return err
+	}
+	if rerror, ok := res.(*proto.RError); ok {
+		return errors.New(rerror.Ename)
+	}
+	if _, ok := res.(*proto.RClunk); !ok {
+		return errors.New("Unexpected response to TClunk.")
+	}
+	return nil
+}
+
+// clunkFid clunks fid in the background. Close waits for it.
+func (c *Client) clunkFid(fid uint32) {
+	if fid == c.rootFid || fid == _NOFID {
+		return
+	}
+	c.clunks.Add(1)
+	go func() {
+		defer c.clunks.Done()
+		c.clunk(context.Background(), nil, fid)
+	}()
+}
+
+// flushAll abandons the calls in progress on fid, which fail with err.
+func (c *Client) flushAll(fid uint32, err error) {
+	type call struct {
+		tag      uint16
+		response chan proto.FCall
+	}
+	var calls []call
+	c.Lock()
+	s := c.sess
+	for t, f := range c.tagFids {
+		if r := c.calls[t]; f == fid && r != nil && !c.flushing[t] {
+			calls = append(calls, call{t, r})
+		}
+	}
+	c.Unlock()
+	for _, call := range calls {
+		if !c.flush(s, call.tag, call.response) {
+			continue
+		}
+		select {
+		case call.response <- &proto.RError{Header: proto.Header{Type: proto.Rerror, Tag: call.tag}, Ename: err.Error()}:
+		default:
+		}
+	}
+}
+
+// lookupFid returns the Fid cached for path, which must be released
+// with releaseFid. Fids are cached by cleaned path.
+func (c *Client) lookupFid(path string) (*Fid, bool) {
+	c.pathCacheLock.Lock()
+	defer c.pathCacheLock.Unlock()
+	fid, ok := c.pathCache[cleanPath(path)]
+	if ok {
+		fid.refs++
+	}
+	return fid, ok
+}
+
+// cacheFid returns the Fid cached for path, walking one if there is
+// none. With a cache, a Fid not walked within its TTL is walked again.
+// Without one, nothing is cached, and a new Fid is walked each time. The
+// Fid must be released with releaseFid, and not clunked.
+func (c *Client) cacheFid(ctx context.Context, path string) (*Fid, error) {
+	path = cleanPath(path)
+	if c.cache == nil {
+		fid, err := c.Root().WalkContext(ctx, removeBlank(strings.Split(path, "/"))...)
+		if err != nil {
+			return nil, err
+		}
+		fid.refs = 1
+		return fid, nil
+	}
+	if fid, ok := c.lookupFid(path); ok {
+		if c.cache.fidFresh(path) {
+			return fid, nil
+		}
+		c.releaseFid(fid)
+	}
+	fid, err := c.Root().WalkContext(ctx, removeBlank(strings.Split(path, "/"))...)
+	if err != nil {
+		// The file may have been removed.
+		c.dropCachedFid(path)
+		return nil, err
+	}
+	// One reference is held by the cache, and one by the caller.
+	fid.refs = 2
+	c.pathCacheLock.Lock()
+	old := c.pathCache[path]
+	c.pathCache[path] = fid
+	c.lockedRelease(old)
+	c.pathCacheLock.Unlock()
+	c.cache.walkedFid(path)
+	return fid, nil
+}
+
+// releaseFid releases a Fid returned by cacheFid.
+func (c *Client) releaseFid(fid *Fid) {
+	c.pathCacheLock.Lock()
+	defer c.pathCacheLock.Unlock()
+	c.lockedRelease(fid)
+}
+
+// lockedRelease releases fid, clunking it once it is no longer used.
+// c.pathCacheLock must be held.
+func (c *Client) lockedRelease(fid *Fid) {
+	if fid == nil {
+		return
+	}
+	if fid.refs--; fid.refs == 0 {
+		c.clunkFid(fid.fid)
+	}
+}
+
+// dropCachedFid drops the Fids cached for path and the files below it.
+func (c *Client) dropCachedFid(path string) {
+	path = cleanPath(path)
+	c.pathCacheLock.Lock()
+	defer c.pathCacheLock.Unlock()
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	for p, fid := range c.pathCache {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(c.pathCache, p)
+			c.lockedRelease(fid)
+		}
+	}
+}
+
+// Close clunks the open Files and cached fids of c, and closes its
+// connection. Calls made after Close fail with ErrClientClosed.
+func (c *Client) Close() error {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return ErrClientClosed
+	}
+	c.closed = true
+	lost := c.err != nil
+	files := make([]*File, 0, len(c.files))
+	for _, f := range c.files {
+		files = append(files, f)
+	}
+	c.Unlock()
+
+	var err error
+	if !lost {
+		for _, f := range files {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		c.dropCachedFid("/")
+		c.clunks.Wait()
+	}
+
+	c.Lock()
+	c.finish(ErrClientClosed)
+	s := c.sess
+	c.Unlock()
+	if cerr := s.rwc.Close(); cerr != nil && err == nil && !lost {
+		err = cerr
+	}
+	return err
+}
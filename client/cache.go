@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file implements the cache of a Client made with WithCache.
+//
+// The cache remembers, by path, the Qid each file had when it was last
+// walked, opened or stated, along with its Stat and, for directories,
+// their entries. Walks use the fid cached for the parent directory of a
+// file, rather than starting from the root, while the walk to that
+// directory is recent enough.
+//
+// Everything cached expires after the TTL of the cache. Before that, a
+// Qid seen from the server that differs from the cached one, because the
+// file was changed or replaced, drops what was cached for the file, and
+// the entries of its directory. Changes made through the Client drop what
+// they make stale. Invalidate drops the rest, such as the changes made by
+// other clients of the server.
+//
+// A cache without a TTL keeps what it holds, but checks it before each
+// use: the file is walked to again, or the root stated, and what was
+// cached is only used if the Qid the server returns has not changed.
+
+// WithCache makes the client cache walks, stats and directory entries
+// for at most ttl. A ttl of 0 keeps them until they are found to be out
+// of date, or dropped with Invalidate, but walks to each file again to
+// check its Qid before using what is cached for it.
+func WithCache(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.cache = true
+		c.cacheTTL = ttl
+	}
+}
+
+// A cache holds what a Client knows about the files of its server. The
+// methods of a nil *cache do nothing, and report nothing cached.
+type cache struct {
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+	sync.Mutex
+}
+
+type cacheEntry struct {
+	qid      proto.Qid
+	fidTime  time.Time // When the fid cached for the file was walked.
+	stat     *proto.Stat
+	statTime time.Time
+	dir      []proto.Stat
+	dirTime  time.Time
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl, entries: make(map[string]*cacheEntry)}
+}
+
+func (c *cache) fresh(t time.Time) bool {
+	return c.ttl <= 0 || time.Since(t) < c.ttl
+}
+
+// revalidates reports whether c has no TTL, so that what it holds for a
+// file must be checked against the server's Qid before it is used.
+func (c *cache) revalidates() bool {
+	return c != nil && c.ttl <= 0
+}
+
+// fidFresh reports whether the fid cached for p still refers to p. The
+// root never changes. Without a TTL, every other fid is walked again,
+// which checks the Qids cached along the way.
+func (c *cache) fidFresh(p string) bool {
+	if c == nil {
+		return true
+	}
+	p = cleanPath(p)
+	if p == "/" {
+		return true
+	}
+	c.Lock()
+	defer c.Unlock()
+	e := c.entries[p]
+	return e != nil && !e.fidTime.IsZero() && !c.revalidates() && c.fresh(e.fidTime)
+}
+
+// walkedFid records that the fid cached for p was just walked.
+func (c *cache) walkedFid(p string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if e := c.entries[cleanPath(p)]; e != nil {
+		e.fidTime = time.Now()
+	}
+}
+
+// see records that p has qid, dropping what is cached for p if it
+// changed. c must be locked.
+func (c *cache) see(p string, qid proto.Qid) *cacheEntry {
+	e := c.entries[p]
+	if e == nil {
+		e = &cacheEntry{}
+		c.entries[p] = e
+	} else if e.qid != qid {
+		if e.qid.Uid != qid.Uid || e.qid.Qtype != qid.Qtype {
+			// The file was replaced, and the files below it may be
+			// different ones.
+			c.dropBelow(p)
+			e.fidTime = time.Time{}
+		}
+		e.stat = nil
+		e.dir = nil
+		if parent := c.entries[path.Dir(p)]; parent != nil && p != "/" {
+			parent.dir = nil
+		}
+	}
+	e.qid = qid
+	return e
+}
+
+// dropBelow drops the entries of the files below p. c must be locked.
+func (c *cache) dropBelow(p string) {
+	prefix := strings.TrimSuffix(p, "/") + "/"
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// walked records the Qids returned by walking names from base.
+func (c *cache) walked(base string, names []string, qids []proto.Qid) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	p := cleanPath(base)
+	for i, qid := range qids {
+		p = path.Join(p, names[i])
+		c.see(p, qid)
+	}
+}
+
+// opened records the Qid returned by opening p.
+func (c *cache) opened(p string, qid proto.Qid) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.see(cleanPath(p), qid)
+}
+
+// stat returns the cached Stat of p.
+func (c *cache) stat(p string) (*proto.Stat, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	e := c.entries[cleanPath(p)]
+	if e == nil || e.stat == nil || !c.fresh(e.statTime) {
+		return nil, false
+	}
+	st := *e.stat
+	return &st, true
+}
+
+// setStat caches st as the Stat of p.
+func (c *cache) setStat(p string, st *proto.Stat) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.putStat(cleanPath(p), st)
+}
+
+// putStat caches st as the Stat of p. c must be locked.
+func (c *cache) putStat(p string, st *proto.Stat) {
+	e := c.see(p, st.Qid)
+	cp := *st
+	e.stat = &cp
+	e.statTime = time.Now()
+}
+
+// dir returns the cached entries of the directory p.
+func (c *cache) dir(p string) ([]proto.Stat, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	e := c.entries[cleanPath(p)]
+	if e == nil || e.dir == nil || !c.fresh(e.dirTime) {
+		return nil, false
+	}
+	return append([]proto.Stat(nil), e.dir...), true
+}
+
+// setDir caches stats as the entries of the directory p, and as the
+// Stats of the files in it.
+func (c *cache) setDir(p string, stats []proto.Stat) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	p = cleanPath(p)
+	for i := range stats {
+		c.putStat(path.Join(p, stats[i].Name), &stats[i])
+	}
+	e := c.entries[p]
+	if e == nil {
+		// The Qid of p is not known, so it cannot be checked.
+		return
+	}
+	e.dir = append(make([]proto.Stat, 0, len(stats)), stats...)
+	e.dirTime = time.Now()
+}
+
+// changed drops what a change to the file p makes stale: its Stat and
+// entries, and those of its directory.
+func (c *cache) changed(p string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	p = cleanPath(p)
+	for _, k := range []string{p, path.Dir(p)} {
+		if e := c.entries[k]; e != nil {
+			e.stat = nil
+			e.dir = nil
+		}
+	}
+}
+
+// invalidate drops everything cached for p and the files below it, and
+// what is stale in its directory.
+func (c *cache) invalidate(p string) {
+	if c == nil {
+		return
+	}
+	c.changed(p)
+	c.Lock()
+	defer c.Unlock()
+	p = cleanPath(p)
+	if p != "/" {
+		delete(c.entries, p)
+	}
+	c.dropBelow(p)
+}
+
+// reset drops everything cached.
+func (c *cache) reset() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.entries = make(map[string]*cacheEntry)
+}
+
+// revalidate checks what the cache of c holds for path against the
+// server, by walking to path again, or stating the root, whose walk
+// returns no Qid. What has changed is dropped.
+func (c *Client) revalidate(ctx context.Context, path string) error {
+	fid, err := c.cacheFid(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer c.releaseFid(fid)
+	if cleanPath(path) == "/" {
+		_, err = fid.StatContext(ctx)
+	}
+	return err
+}
+
+// Invalidate drops what the cache of c holds for path and the files
+// below it, so that they are read from the server again. Clients made
+// without WithCache cache nothing, and Invalidate does nothing.
+func (c *Client) Invalidate(path string) {
+	c.cache.invalidate(path)
+}
@@ -1,13 +1,12 @@
 package client
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"net"
 	"os"
@@ -15,6 +14,8 @@ import (
 
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Plan9-Archive/libauth"
 	"github.com/emersion/go-sasl"
@@ -22,28 +23,80 @@ import (
 	"github.com/knusbaum/go9p/proto"
 )
 
-func verboseLog(msg string, args ...interface{}) {
-	if go9p.Verbose {
-		log.Printf(msg, args...)
-	}
-}
-
 const _NOFID = ^uint32(0)
 
 type Client struct {
-	c             io.ReadWriteCloser
+	sess          *session
 	rootFid       uint32
-	tags          []uint16
-	lastTag       uint16
+	rootQid       proto.Qid
+	tags          []uint16 // The tags and fids not in use, see alloc.go.
+	nextTag       uint32
+	tagsHeld      uint32
+	tagLimit      uint32
 	fids          []uint32
-	lastFid       uint32
+	nextFid       uint32
+	freed         *sync.Cond     // Signalled when a tag or fid is returned.
+	clunks        sync.WaitGroup // The clunks made in the background.
 	calls         map[uint16]chan proto.FCall
 	tagFids       map[uint16]uint32
+	flushing      map[uint16]bool // Tags of the calls being flushed.
 	closed        bool
+	done          chan struct{} // Closed when the client can no longer be used.
+	err           error         // Why done was closed.
 	pathCacheLock sync.RWMutex
-	pathCache     map[string]uint32
+	pathCache     map[string]*Fid
+	cache         *cache // nil unless made with WithCache.
 	msize         uint32
+	window        int
+	dialect       proto.Dialect
+	tracer        go9p.Tracer
+	conn          uint64
+	// writeLock serializes writes to the connection. It is not held
+	// with the Mutex, so that the worker can deliver responses while a
+	// call is being written.
+	writeLock sync.Mutex
 	sync.Mutex
+
+	// The following are used to reconnect, see reconnect.go.
+	user         string
+	aname        string
+	authFunc     func(user string, s io.ReadWriter) (string, error)
+	redial       func() (io.ReadWriteCloser, error)
+	reconnecting bool
+	ready        chan struct{}    // Closed when reconnecting is done.
+	files        map[uint32]*File // The open Files, by fid.
+	lostFids     map[uint32]error // Files that could not be reopened.
+}
+
+// A session is one connection of a Client to its server. A Client that
+// reconnects has a new session for each connection.
+type session struct {
+	rwc  io.ReadWriteCloser
+	lost chan struct{} // Closed when the connection is lost.
+	err  error         // Why the connection was lost, once lost is closed.
+}
+
+func newSession(rwc io.ReadWriteCloser) *session {
+	return &session{rwc: rwc, lost: make(chan struct{})}
+}
+
+// ErrClientClosed is the error of the calls of a Client whose connection
+// was closed by the client.
+var ErrClientClosed = errors.New("client closed")
+
+// ConnError is the error of the calls of a Client that fail because the
+// connection to the server was lost. Err is the reason, which is io.EOF
+// if the server hung up.
+type ConnError struct {
+	Err error
+}
+
+func (e *ConnError) Error() string {
+	return "9p connection lost: " + e.Err.Error()
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
 }
 
 type File struct {
@@ -51,46 +104,168 @@ type File struct {
 	client *Client
 	offset uint64
 	iounit uint32
+
+	// path, mode and qid are used to reopen the file after
+	// reconnecting.
+	path string
+	mode proto.Mode
+	qid  proto.Qid
+	// sess is the session of files used during the connection
+	// handshake, which cannot wait for it to finish.
+	sess *session
+
+	readDeadline  deadline
+	writeDeadline deadline
+	ra            *readAhead // Reads in flight after offset.
+	closed        bool
 }
 
 type Config struct {
 	authFunc func(user string, s io.ReadWriter) (string, error)
+	dialect  proto.Dialect
+	msize    uint32
+	window   int
+	tracer   go9p.Tracer
+	metrics  *go9p.Metrics
+	// cache and cacheTTL are set by WithCache.
+	cache    bool
+	cacheTTL time.Duration
+	// reconnect and dial are set by WithReconnect.
+	reconnect bool
+	dial      func() (io.ReadWriteCloser, error)
 }
 
+// DefaultMsize is the msize a client asks for unless WithMsize is used.
+const DefaultMsize = 65536
+
 type Option func(*Config)
 
 func (c *Client) stop() {
 	c.Lock()
 	defer c.Unlock()
 	c.closed = true
-	c.c.Close()
+	c.sess.rwc.Close()
+}
+
+// Done returns a channel that is closed when the client can no longer be
+// used, because its connection was lost and it could not reconnect, or
+// was closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
 }
 
-func (c *Client) worker() {
-	defer c.c.Close()
+// Err returns why Done was closed: a *ConnError if the connection was
+// lost, or ErrClientClosed. It returns nil until then.
+func (c *Client) Err() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
+
+// String describes the server c is connected to, as a Plan 9 dial string
+// such as tcp!host!564 when its connection has a remote address.
+func (c *Client) String() string {
+	c.Lock()
+	rwc := c.sess.rwc
+	c.Unlock()
+	conn, ok := rwc.(interface{ RemoteAddr() net.Addr })
+	if !ok {
+		return fmt.Sprintf("conn%d", c.conn)
+	}
+	addr := conn.RemoteAddr()
+	if host, port, err := net.SplitHostPort(addr.String()); err == nil {
+		return addr.Network() + "!" + host + "!" + port
+	}
+	return addr.Network() + "!" + addr.String()
+}
+
+// finish marks c as no longer usable, because of err. c must be locked.
+func (c *Client) finish(err error) {
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	// Calls waiting for tags fail.
+	c.freed.Broadcast()
+	if c.reconnecting {
+		close(c.ready)
+		c.reconnecting = false
+	}
+}
+
+func (c *Client) worker(s *session, msize uint32) {
+	defer s.rwc.Close()
 	for {
-		call, err := proto.ParseCall(c.c)
+		call, err := proto.ParseCallSize(s.rwc, msize)
 		if err != nil {
-			c.Lock()
-			if c.closed {
-				c.Unlock()
-				return
-			}
-			c.closed = true
-			c.Unlock()
-			log.Printf("Client Error: %s", err)
+			c.lose(s, err)
 			return
 		}
 		tag := call.GetTag()
-		verboseLog("=in=> %v\n", call)
 		c.Lock()
 		rchan := c.calls[tag]
+		// The tag of a call being flushed is held until the flush is
+		// answered.
+		if rchan != nil && !c.flushing[tag] {
+			c.lockedReturnTag(tag)
+		}
 		c.Unlock()
 		if rchan == nil {
+			c.trace(&go9p.Event{Kind: go9p.EventReceive, Call: call})
 			continue
 		}
-		rchan <- call
-		c.returnTag(tag)
+		// The channel has room for the one response. Anything more
+		// from a confused server is dropped.
+		select {
+		case rchan <- call:
+		default:
+		}
+	}
+}
+
+// lose records that the connection of s was lost because of err, which
+// fails the calls waiting on s. If s is the session of c, c reconnects if
+// it can, and is done otherwise.
+func (c *Client) lose(s *session, err error) {
+	c.Lock()
+	closed := c.closed
+	if closed {
+		s.err = ErrClientClosed
+	} else {
+		s.err = &ConnError{err}
+	}
+	close(s.lost)
+	switch {
+	case s != c.sess:
+		// A session that failed while reconnecting.
+	case closed || c.redial == nil:
+		c.finish(s.err)
+	default:
+		c.reconnecting = true
+		c.ready = make(chan struct{})
+		go c.reconnect()
+	}
+	c.Unlock()
+	if closed || err == io.EOF {
+		err = nil
+	}
+	c.trace(&go9p.Event{Kind: go9p.EventDisconnect, Err: err})
+}
+
+// WithTracer sets the Tracer that receives the Events of the client's
+// connection. By default, Events are discarded, unless go9p.Verbose is
+// set.
+func WithTracer(t go9p.Tracer) Option {
+	return func(c *Config) {
+		c.tracer = t
+	}
+}
+
+// WithMetrics counts the requests of the client in m.
+func WithMetrics(m *go9p.Metrics) Option {
+	return func(c *Config) {
+		c.metrics = m
 	}
 }
 
@@ -100,17 +275,38 @@ func WithAuth(f func(user string, s io.ReadWriter) (string, error)) Option {
 	}
 }
 
+// WithMsize sets the msize, the largest message size, the client asks
+// the server for. The server may choose a smaller one. Larger messages
+// move more data per round trip, but use more memory. msize is limited
+// to proto.MaxMsize.
+func WithMsize(msize uint32) Option {
+	return func(c *Config) {
+		if msize > proto.MaxMsize {
+			msize = proto.MaxMsize
+		}
+		c.msize = msize
+	}
+}
+
+// WithDialect sets the dialect of the protocol the client offers to the
+// server. The client falls back to plain 9p2000 if the server does not
+// support it. The default is proto.DotU, which gives access to the
+// numeric ids and error numbers sent by 9P2000.u servers. proto.DotL is
+// not supported.
+func WithDialect(d proto.Dialect) Option {
+	return func(c *Config) {
+		c.dialect = d
+	}
+}
+
 func Plan9Auth(user string, s io.ReadWriter) (string, error) {
 	//log.Println("STARTING LIBAUTH PROXY")
 	//defer log.Println("FINISHED LIBAUTH PROXY")
 	ai, err := libauth.Proxy(s, "proto=p9any role=client user=%s", user)
 	if err != nil {
-		log.Printf("Authentication Error: %s", err)
 		return "", err
-	} else {
-		log.Printf("AuthInfo: [Cuid: %s, Suid: %s, Cap: %s]", ai.Cuid, ai.Suid, ai.Cap)
-		return ai.Cuid, nil
 	}
+	return ai.Cuid, nil
 }
 
 func PlainAuth(password string) func(string, io.ReadWriter) (string, error) {
@@ -120,7 +316,6 @@ func PlainAuth(password string) func(string, io.ReadWriter) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		log.Printf("WRITE1\n")
 		//s.Write([]byte(mech))
 		var ba [4096]byte
 		if ir != nil {
@@ -131,11 +326,9 @@ func PlainAuth(password string) func(string, io.ReadWriter) (string, error) {
 			// 			}
 			// 			//bs := ba[:n]
 			// 			log.Printf("WRITE2\n")
-			log.Printf("WRITE1\n")
 			s.Write(ir)
 		}
 		for {
-			log.Printf("READ2\n")
 			n, err := s.Read(ba[:])
 			if err != nil {
 				if err == io.EOF {
@@ -148,7 +341,6 @@ func PlainAuth(password string) func(string, io.ReadWriter) (string, error) {
 			if err != nil {
 				return "", err
 			}
-			log.Printf("WRITE3\n")
 			s.Write(resp)
 		}
 	}
@@ -174,190 +366,320 @@ func DialTLS(network, addr, user, aname string, cert *tls.Certificate, ca *x509.
 		cfg.InsecureSkipVerify = false
 	}
 
-	c, err := tls.Dial(network, addr, cfg)
+	dial := func() (io.ReadWriteCloser, error) { return tls.Dial(network, addr, cfg) }
+	c, err := dial()
 	if err != nil {
 		return nil, err
 	}
 
-	return NewClient(c, user, aname, opts...)
+	return NewClient(c, user, aname, append(opts[:len(opts):len(opts)], withDefaultDial(dial))...)
 }
 
 func Dial(network, addr, user, aname string, opts ...Option) (*Client, error) {
-	c, err := net.Dial(network, addr)
+	dial := func() (io.ReadWriteCloser, error) { return net.Dial(network, addr) }
+	c, err := dial()
 	if err != nil {
 		return nil, err
 	}
-	return NewClient(c, user, aname, opts...)
+	return NewClient(c, user, aname, append(opts[:len(opts):len(opts)], withDefaultDial(dial))...)
 }
 
 func NewClient(c io.ReadWriteCloser, user, aname string, opts ...Option) (*Client, error) {
-	conf := Config{}
+	conf := Config{dialect: proto.DotU, msize: DefaultMsize, window: DefaultWindow}
 	for _, o := range opts {
 		o(&conf)
 	}
+	if conf.dialect == proto.DotL {
+		c.Close()
+		return nil, errors.New("client does not support 9P2000.L")
+	}
+	if conf.reconnect && conf.dial == nil {
+		c.Close()
+		return nil, errors.New("WithReconnect needs a dial function, unless used with Dial or DialTLS")
+	}
 	client := &Client{
-		c:         c,
+		sess:      newSession(c),
 		rootFid:   0,
-		tags:      nil,
-		lastTag:   1,
-		fids:      nil,
-		lastFid:   0,
+		tagLimit:  uint32(_NOTAG),
+		nextFid:   1,
 		calls:     make(map[uint16]chan proto.FCall),
 		tagFids:   make(map[uint16]uint32),
-		pathCache: make(map[string]uint32),
+		flushing:  make(map[uint16]bool),
+		done:      make(chan struct{}),
+		pathCache: make(map[string]*Fid),
+		tracer:    go9p.DefaultTracer(conf.tracer),
+		conn:      atomic.AddUint64(&lastConnID, 1),
+		window:    conf.window,
+		user:      user,
+		aname:     aname,
+		authFunc:  conf.authFunc,
+		files:     make(map[uint32]*File),
+		lostFids:  make(map[uint32]error),
+	}
+	if conf.metrics != nil {
+		client.tracer = go9p.MultiTracer(client.tracer, conf.metrics)
+	}
+	if conf.cache {
+		client.cache = newCache(conf.cacheTTL)
+	}
+	client.freed = sync.NewCond(&client.Mutex)
+	client.trace(&go9p.Event{Kind: go9p.EventConnect, User: user})
+	go client.worker(client.sess, conf.msize)
+	if err := client.attach(client.sess, conf.msize, conf.dialect); err != nil {
+		client.stop()
+		return nil, err
 	}
-	var afid uint32 = _NOFID
-	go client.worker()
+	if conf.reconnect {
+		client.Lock()
+		client.redial = conf.dial
+		client.Unlock()
+	}
+	return client, nil
+}
 
+// attach performs the version, auth and attach exchanges on s, attaching
+// c's root fid. The first time, the msize and dialect of c are
+// negotiated. After that, the server must accept the same ones.
+func (c *Client) attach(s *session, msize uint32, dialect proto.Dialect) error {
+	ctx := context.Background()
+	var afid uint32 = _NOFID
 	version := proto.TRVersion{
-		Header:  proto.Header{proto.Tversion, 0},
-		Msize:   65536,
-		Version: "9P2000",
+		Header:  proto.Header{proto.Tversion, _NOTAG},
+		Msize:   msize,
+		Version: dialect.Version(),
 	}
-	res, err := client.getResponse(&version)
+	res, err := c.rpc(ctx, s, &version)
 	if err != nil {
-		client.stop()
-		return nil, err
+		return err
 	}
 	if rerror, ok := res.(*proto.RError); ok {
-		client.stop()
-		return nil, errors.New(rerror.Ename)
+		return errors.New(rerror.Ename)
 	}
 	ver, ok := res.(*proto.TRVersion)
 	if !ok {
-		client.stop()
-		return nil, fmt.Errorf("Unexpected response while performing version: %v", res)
+		return fmt.Errorf("Unexpected response while performing version: %v", res)
+	}
+	d, ok := proto.DialectOf(ver.Version)
+	if !ok || d == proto.DotL {
+		return fmt.Errorf("Server does not support protocol version %s", version.Version)
+	}
+	if ver.Msize > msize {
+		ver.Msize = msize
+	}
+	if c.msize == 0 {
+		c.msize = ver.Msize
+		c.dialect = d
+	} else if ver.Msize != c.msize || d != c.dialect {
+		return fmt.Errorf("Server changed msize or version to %d, %s", ver.Msize, ver.Version)
 	}
-	client.msize = ver.Msize
 
-	if conf.authFunc != nil {
-		afid = client.takeFid()
+	if c.authFunc != nil {
+		afid = c.takeFid()
 		// perform Authentication.
 		auth := proto.TAuth{
-			Header: proto.Header{proto.Tauth, 0},
+			Header: proto.Header{proto.Tauth, c.takeTag(afid)},
 			Afid:   afid,
-			Uname:  user,
-			Aname:  aname,
+			Uname:  c.user,
+			Aname:  c.aname,
+			NUname: proto.NoUid,
 		}
-		res, err := client.getResponse(&auth)
+		res, err := c.rpc(ctx, s, &auth)
 		if err != nil {
-			client.stop()
-			return nil, err
+			return err
 		}
 		if rerror, ok := res.(*proto.RError); ok {
-			client.stop()
-			return nil, errors.New(rerror.Ename)
+			return errors.New(rerror.Ename)
 		}
 		_, ok := res.(*proto.RAuth)
 		if !ok {
-			client.stop()
-			return nil, fmt.Errorf("Unexpected response while performing auth: %v", res)
+			return fmt.Errorf("Unexpected response while performing auth: %v", res)
 		}
 		f := &File{
 			fid:    afid,
-			client: client,
+			client: c,
 			offset: 0,
 			iounit: math.MaxUint32,
+			sess:   s,
 		}
 		defer f.Close() // Needs to be closed *after* attach, or it becomes invalid
-		conf.authFunc(user, f)
+		c.authFunc(c.user, f)
 	}
 
 	attach := proto.TAttach{
-		Header: proto.Header{proto.Tattach, 0},
-		Fid:    client.rootFid,
+		Header: proto.Header{proto.Tattach, c.takeTag(c.rootFid)},
+		Fid:    c.rootFid,
 		Afid:   afid,
-		Uname:  user,
-		Aname:  aname,
+		Uname:  c.user,
+		Aname:  c.aname,
+		NUname: proto.NoUid,
 	}
 
-	res, err = client.getResponse(&attach)
+	res, err = c.rpc(ctx, s, &attach)
 	if err != nil {
-		client.stop()
-		return nil, err
+		return err
 	}
 	if rerror, ok := res.(*proto.RError); ok {
-		client.stop()
-		return nil, fmt.Errorf("Failed to attach to filesystem: %v", rerror.Ename)
+		c.trace(&go9p.Event{Kind: go9p.EventAuth, User: c.user, Err: errors.New(rerror.Ename)})
+		return fmt.Errorf("Failed to attach to filesystem: %v", rerror.Ename)
 	}
-	_, ok = res.(*proto.RAttach)
+	ra, ok := res.(*proto.RAttach)
 	if !ok {
-		client.stop()
-		return nil, fmt.Errorf("Unexpected response while attaching: %v", res)
+		return fmt.Errorf("Unexpected response while attaching: %v", res)
 	}
-
-	return client, nil
-}
-
-func (c *Client) getResponse(call proto.FCall) (proto.FCall, error) {
-	response := make(chan proto.FCall)
 	c.Lock()
-	c.calls[call.GetTag()] = response
-	verboseLog("<=out= %v\n", call)
-	_, err := c.c.Write(call.Compose())
+	c.rootQid = ra.Qid
 	c.Unlock()
-	if err != nil {
-		return nil, err
-	}
-	r, ok := <-response
-	if !ok {
-		return nil, errors.New("RPC Error.")
-	}
-	return r, nil
+	c.trace(&go9p.Event{Kind: go9p.EventAuth, User: c.user})
+	return nil
 }
 
-func (c *Client) send(call proto.FCall) error {
-	c.Lock()
-	defer c.Unlock()
-	verboseLog("<=out= %v\n", call)
-	_, err := c.c.Write(call.Compose())
-	return err
+func (c *Client) getResponse(call proto.FCall) (proto.FCall, error) {
+	return c.rpc(context.Background(), nil, call)
 }
 
-func (c *Client) takeTag(fid uint32) uint16 {
-	c.Lock()
-	defer c.Unlock()
-	return c.lockedTakeTag(fid)
+// getResponseContext sends call and waits for its response. If ctx is
+// done first, the call is flushed and ctx.Err() is returned.
+func (c *Client) getResponseContext(ctx context.Context, call proto.FCall) (proto.FCall, error) {
+	return c.rpc(ctx, nil, call)
 }
 
-func (c *Client) lockedTakeTag(fid uint32) uint16 {
-	if len(c.tags) == 0 {
-		c.lastTag++
-		return c.lastTag
+// session returns the session of c, waiting for c to reconnect if it is
+// reconnecting.
+func (c *Client) session(ctx context.Context) (*session, error) {
+	for {
+		c.Lock()
+		if c.err != nil {
+			c.Unlock()
+			return nil, c.err
+		}
+		if !c.reconnecting {
+			s := c.sess
+			c.Unlock()
+			return s, nil
+		}
+		ready := c.ready
+		c.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
-	t := c.tags[len(c.tags)-1]
-	c.tags = c.tags[:len(c.tags)-1]
-	c.tagFids[t] = fid
-	return t
 }
 
-func (c *Client) returnTag(tag uint16) {
-	if tag == 0 {
-		return
+// rpc sends call on s, or, if s is nil, on the session of c once it is
+// connected, and waits for its response. If ctx is done first, the call
+// is flushed and ctx.Err() is returned. If the connection is lost, the
+// error is a *ConnError.
+func (c *Client) rpc(ctx context.Context, s *session, call proto.FCall) (proto.FCall, error) {
+	tag := call.GetTag()
+	// A call that could not be written did not reach the server, so it
+	// is safe to send it again once c has reconnected.
+	retry := s == nil
+	response := make(chan proto.FCall, 1)
+	var start time.Time
+	for {
+		if retry {
+			var err error
+			if s, err = c.session(ctx); err != nil {
+				c.returnTag(tag)
+				return nil, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			c.returnTag(tag)
+			return nil, err
+		}
+		c.Lock()
+		c.calls[tag] = response
+		c.Unlock()
+		c.writeLock.Lock()
+		c.trace(&go9p.Event{Kind: go9p.EventSend, Call: call})
+		start = time.Now()
+		err := proto.WriteCall(s.rwc, call, c.dialect)
+		c.writeLock.Unlock()
+		if err == nil {
+			break
+		}
+		c.trace(&go9p.Event{Kind: go9p.EventError, Call: call, Err: err})
+		// The connection is broken. Closing it makes the worker
+		// notice.
+		s.rwc.Close()
+		if !retry {
+			c.returnTag(tag)
+			return nil, &ConnError{err}
+		}
+		<-s.lost
+	}
+	var r proto.FCall
+	var ok bool
+	select {
+	case r, ok = <-response:
+	case <-s.lost:
+		select {
+		case r, ok = <-response:
+		default:
+			c.returnTag(tag)
+			return nil, s.err
+		}
+	case <-ctx.Done():
+		if !c.flush(s, tag, response) {
+			// The response came in before the flush could be
+			// sent. It is returned, so that fids it creates are
+			// not lost. A client that is done has no tags left
+			// to flush with.
+			select {
+			case r, ok = <-response:
+			case <-s.lost:
+				c.returnTag(tag)
+				return nil, s.err
+			}
+			break
+		}
+		c.trace(&go9p.Event{Kind: go9p.EventError, Call: call, Err: ctx.Err()})
+		return nil, ctx.Err()
 	}
-	c.Lock()
-	defer c.Unlock()
-	c.tags = append(c.tags, tag)
-	delete(c.calls, tag)
-	delete(c.tagFids, tag)
+	if !ok {
+		return nil, errors.New("RPC Error.")
+	}
+	c.trace(&go9p.Event{Kind: go9p.EventReceive, Call: r, Request: call, Latency: time.Since(start)})
+	return r, nil
 }
 
-func (c *Client) takeFid() uint32 {
+// flush abandons the call with tag oldtag on s, whose response would be
+// sent on response. It reports false if the response has already
+// arrived. Otherwise, a Tflush is sent, and oldtag is held until it is
+// answered, as a reply to the abandoned call may still arrive until then.
+func (c *Client) flush(s *session, oldtag uint16, response chan proto.FCall) bool {
 	c.Lock()
-	defer c.Unlock()
-	if len(c.fids) == 0 {
-		c.lastFid++
-		return c.lastFid
+	tag := c.lockedTakeTag(_NOFID, true)
+	if tag == _NOTAG || c.calls[oldtag] != response || len(response) > 0 {
+		c.lockedReturnTag(tag)
+		c.Unlock()
+		return false
 	}
-	fid := c.fids[len(c.fids)-1]
-	c.fids = c.fids[:len(c.fids)-1]
-	return fid
+	c.flushing[oldtag] = true
+	flush := proto.TFlush{
+		Header: proto.Header{proto.Tflush, tag},
+		Oldtag: oldtag,
+	}
+	c.Unlock()
+	go func() {
+		c.rpc(context.Background(), s, &flush)
+		c.Lock()
+		delete(c.flushing, oldtag)
+		c.lockedReturnTag(oldtag)
+		c.Unlock()
+	}()
+	return true
 }
 
-func (c *Client) returnFid(fid uint32) {
-	c.Lock()
-	defer c.Unlock()
-	c.fids = append(c.fids, fid)
+var lastConnID uint64
+
+// trace passes e, an Event on c's connection, to c's Tracer.
+func (c *Client) trace(e *go9p.Event) {
+	e.Conn = c.conn
+	c.tracer.Trace(e)
 }
 
 func removeBlank(ss []string) []string {
@@ -372,291 +694,307 @@ func removeBlank(ss []string) []string {
 	return ss
 }
 
-// walkFid walks a new fid to the selected path from the root and returns it.
-// fids should be returned to the client with returnFid once they're finished being used.
-func (c *Client) walkFid(path string) (uint32, error) {
-	//log.Printf("Walk(%s)", path)
+// walkPath walks a new Fid to the selected path from the root and returns it.
+// With a cache, the walk starts from the cached Fid of the parent directory.
+func (c *Client) walkPath(ctx context.Context, name string) (*Fid, error) {
+	//log.Printf("Walk(%s)", name)
 	//defer log.Printf("Walk() Return ")
-	parts := removeBlank(strings.Split(path, "/"))
-	newfid := c.takeFid()
-	walk := proto.TWalk{
-		Header: proto.Header{proto.Twalk, c.takeTag(c.rootFid)},
-		Fid:    c.rootFid,
-		Newfid: newfid,
-		Nwname: uint16(len(parts)),
-		Wname:  parts,
-	}
-	res, err := c.getResponse(&walk)
-	if err != nil {
-		c.clunkFid(newfid)
-		return ^uint32(0), err
-	}
-	if rerror, ok := res.(*proto.RError); ok {
-		c.clunkFid(newfid)
-		return 0, errors.New(rerror.Ename)
-	}
-	_, ok := res.(*proto.RWalk)
-	if !ok {
-		c.clunkFid(newfid)
-		return 0, errors.New("Unexpected response to TWalk.")
+	names := removeBlank(strings.Split(name, "/"))
+	if c.cache != nil && len(names) > 1 {
+		dir, err := c.cacheFid(ctx, path.Dir(cleanPath(name)))
+		if err != nil {
+			return nil, err
+		}
+		defer c.releaseFid(dir)
+		return dir.WalkContext(ctx, path.Base(cleanPath(name)))
 	}
-	//log.Printf("Walk() Return (%d, nil)", newfid)
-	return newfid, nil
+	return c.Root().WalkContext(ctx, names...)
 }
 
-func (c *Client) lookupFid(path string) (uint32, bool) {
-	c.pathCacheLock.RLock()
-	defer c.pathCacheLock.RUnlock()
-	fid, ok := c.pathCache[path]
-	return fid, ok
+// walkTo walks newfid to path from the root, on the session s as rpc
+// does. If it fails, newfid may still have been walked, and should be
+// clunked.
+func (c *Client) walkTo(ctx context.Context, s *session, path string, newfid uint32) error {
+	_, _, err := c.walkFrom(ctx, s, c.rootFid, "/", removeBlank(strings.Split(path, "/")), newfid)
+	return err
 }
 
-func (c *Client) cacheFid(path string) (uint32, error) {
-	if fid, ok := c.lookupFid(path); ok {
-		return fid, nil
-	}
-	fid, err := c.walkFid(path)
-	if err != nil {
-		return 0, err
+// walkFrom walks newfid to names from fid, the file at base, as walkTo
+// does, and returns the Qid it reaches. Walks of more than maxWalkElem
+// names are split, walking newfid further each time. If the walk fails,
+// walked reports whether newfid may have been walked anyway, and so must
+// be clunked rather than reused.
+func (c *Client) walkFrom(ctx context.Context, s *session, fid uint32, base string, names []string, newfid uint32) (qid proto.Qid, walked bool, err error) {
+	for {
+		n := len(names)
+		if n > maxWalkElem {
+			n = maxWalkElem
+		}
+		walk := proto.TWalk{
+			Header: proto.Header{proto.Twalk, c.takeTag(fid)},
+			Fid:    fid,
+			Newfid: newfid,
+			Nwname: uint16(n),
+			Wname:  names[:n],
+		}
+		res, err := c.rpc(ctx, s, &walk)
+		if err != nil {
+			// The server may have walked newfid before the call was
+			// abandoned.
+			return qid, true, err
+		}
+		if rerror, ok := res.(*proto.RError); ok {
+			return qid, walked, errors.New(rerror.Ename)
+		}
+		rwalk, ok := res.(*proto.RWalk)
+		if !ok || len(rwalk.Wqid) > n {
+			return qid, true, errors.New("Unexpected response to TWalk.")
+		}
+		c.cache.walked(base, names[:n], rwalk.Wqid)
+		if len(rwalk.Wqid) != n {
+			// Only part of the path was walked, and newfid is left
+			// as it was.
+			return qid, walked, fmt.Errorf("%s: file does not exist", names[len(rwalk.Wqid)])
+		}
+		walked = true
+		if n > 0 {
+			qid = rwalk.Wqid[n-1]
+			base = path.Join(append([]string{base}, names[:n]...)...)
+		}
+		if names = names[n:]; len(names) == 0 {
+			return qid, true, nil
+		}
+		fid = newfid
 	}
-	c.pathCacheLock.Lock()
-	defer c.pathCacheLock.Unlock()
-	c.pathCache[path] = fid
-	return fid, nil
 }
 
-func (c *Client) dropCachedFid(path string) {
-	c.pathCacheLock.Lock()
-	defer c.pathCacheLock.Unlock()
-	delete(c.pathCache, path)
+// Readdir returns the entries of the directory at path. Use OpenDir to
+// read large directories without holding every entry at once.
+func (c *Client) Readdir(path string) ([]proto.Stat, error) {
+	return c.ReaddirContext(context.Background(), path)
 }
 
-func (c *Client) clunkFid(fid uint32) {
-	//log.Printf("Clunk(%d)", fid)
-	//defer log.Println("Clunk() Return")
-	if fid == 0 {
-		panic("Clunked 0")
+// ReaddirContext is Readdir, giving up when ctx is done.
+func (c *Client) ReaddirContext(ctx context.Context, path string) ([]proto.Stat, error) {
+	if c.cache.revalidates() {
+		if err := c.revalidate(ctx, path); err != nil {
+			return nil, err
+		}
 	}
-	clunk := proto.TClunk{
-		Header: proto.Header{proto.Tclunk, c.takeTag(0)},
-		Fid:    fid,
+	if stats, ok := c.cache.dir(path); ok {
+		return stats, nil
 	}
-	//log.Println("Getting Clunk Response.")
-	go func() {
-		c.getResponse(&clunk) // TODO: do something with response and err?
-		//c.send(&clunk)
-		//log.Printf("TClunk Response: %#v, error %#v\n", response, err)
-		c.returnFid(fid)
-	}()
-}
-
-func readAll(max uint32, r io.Reader) ([]byte, error) {
-	var buff bytes.Buffer
-	buff.Grow(int(max))
-	_, err := buff.ReadFrom(r)
-	return buff.Bytes(), err
-}
-
-func (c *Client) Readdir(path string) ([]proto.Stat, error) {
-	file, err := c.Open(path, proto.Oread)
+	f, err := c.OpenContext(ctx, path, proto.Oread)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	bs, err := readAll(c.msize, file)
-	stats, err := proto.ParseStats(bs)
-	if err != nil {
-		//log.Printf("ERROR: %v\n", err)
-		return nil, err
+	defer f.Close()
+	stats := make([]proto.Stat, 0)
+	buff := make([]byte, c.msize)
+	for {
+		// Each read of a directory returns a whole number of entries.
+		n, err := f.ReadContext(ctx, buff)
+		if err == io.EOF {
+			c.cache.setDir(path, stats)
+			return stats, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s, err := proto.ParseStats(buff[:n])
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s...)
 	}
-	//log.Printf("STATS: %v\n", stats)
-	return stats, nil
 }
 
 func (c *Client) Stat(path string) (*proto.Stat, error) {
+	return c.StatContext(context.Background(), path)
+}
+
+// StatContext is Stat, giving up when ctx is done.
+func (c *Client) StatContext(ctx context.Context, path string) (*proto.Stat, error) {
 	//log.Println("Stat()")
 	//defer log.Println("Stat() Return")
-	newFid, err := c.cacheFid(path)
-	if err != nil {
-		return nil, err
+	if st, ok := c.cache.stat(path); ok && !c.cache.revalidates() {
+		return st, nil
 	}
-
-	stat := proto.TStat{
-		Header: proto.Header{proto.Tstat, c.takeTag(newFid)},
-		Fid:    newFid,
-	}
-	res, err := c.getResponse(&stat)
+	fid, err := c.cacheFid(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	if rerror, ok := res.(*proto.RError); ok {
-		return nil, errors.New(rerror.Ename)
-	}
-	rstat, ok := res.(*proto.RStat)
-	if !ok {
-		return nil, errors.New("Unexpected response to RStat.")
+	defer c.releaseFid(fid)
+	if c.cache.revalidates() && cleanPath(path) != "/" {
+		// Walking fid to path has checked what is cached for it.
+		if st, ok := c.cache.stat(path); ok {
+			return st, nil
+		}
 	}
-	return &rstat.Stat, nil
+	return fid.StatContext(ctx)
 }
 
 func (c *Client) WStat(path string, stat *proto.Stat) error {
+	return c.WStatContext(context.Background(), path, stat)
+}
+
+// WStatContext is WStat, giving up when ctx is done.
+func (c *Client) WStatContext(ctx context.Context, path string, stat *proto.Stat) error {
 	//log.Println("WStat()")
 	//defer log.Println("WStat() Return")
-	newFid, err := c.cacheFid(path)
+	fid, err := c.cacheFid(ctx, path)
 	if err != nil {
 		return err
 	}
-
-	wstat := proto.TWstat{
-		Header: proto.Header{proto.Twstat, c.takeTag(newFid)},
-		Fid:    newFid,
-		Stat:   *stat,
-	}
-	res, err := c.getResponse(&wstat)
-	if err != nil {
+	defer c.releaseFid(fid)
+	if err := fid.WStatContext(ctx, stat); err != nil {
 		return err
 	}
-	if rerror, ok := res.(*proto.RError); ok {
-		return errors.New(rerror.Ename)
-	}
-	_, ok := res.(*proto.RWstat)
-	if !ok {
-		return fmt.Errorf("Unexpected response to RWstat: %#v", res)
+	if stat.Name != "" {
+		// The file may have been renamed, so the fids cached for path
+		// may no longer refer to path.
+		c.dropCachedFid(path)
 	}
 	return nil
 }
 
 func (c *Client) Create(name string, perm os.FileMode) (*File, error) {
+	return c.CreateContext(context.Background(), name, perm)
+}
+
+// CreateContext is Create, giving up when ctx is done.
+func (c *Client) CreateContext(ctx context.Context, name string, perm os.FileMode) (*File, error) {
 	//log.Printf("Create(%s)\n", name)
 	//defer log.Println("Create() Return")
-	newFid, err := c.walkFid(path.Dir(name))
+	return c.create(ctx, name, uint32(perm), proto.Ordwr)
+}
+
+// create creates the file name with the 9P permissions perm, and opens it
+// with mode.
+func (c *Client) create(ctx context.Context, name string, perm uint32, mode proto.Mode) (*File, error) {
+	dir, err := c.walkPath(ctx, path.Dir(name))
 	if err != nil {
 		return nil, err
 	}
-
-	create := proto.TCreate{
-		Header: proto.Header{proto.Tcreate, c.takeTag(newFid)},
-		Fid:    newFid,
-		Name:   path.Base(name),
-		Perm:   uint32(perm),
-		Mode:   uint8(proto.Ordwr),
-	}
-	res, err := c.getResponse(&create)
+	f, err := dir.CreateContext(ctx, path.Base(name), perm, mode)
 	if err != nil {
-		c.clunkFid(newFid)
+		c.clunkFid(dir.fid)
 		return nil, err
 	}
-	if rerror, ok := res.(*proto.RError); ok {
-		c.clunkFid(newFid)
-		return nil, errors.New(rerror.Ename)
-	}
-	rc, ok := res.(*proto.RCreate)
-	if !ok {
-		c.clunkFid(newFid)
-		return nil, errors.New("Unexpected response to TCreate.")
-	}
-	iounit := rc.Iounit
-	if iounit == 0 {
-		iounit = math.MaxUint32
-	}
-	return &File{
-		fid:    newFid,
+	return f, nil
+}
+
+// newFile returns the File for fid, the file at path opened with mode,
+// and keeps track of it so it can be reopened after reconnecting.
+func (c *Client) newFile(fid, iounit uint32, path string, mode proto.Mode, qid proto.Qid) *File {
+	f := &File{
+		fid:    fid,
 		client: c,
 		offset: 0,
 		iounit: iounit,
-	}, nil
+		path:   path,
+		mode:   mode,
+		qid:    qid,
+	}
+	c.Lock()
+	c.files[fid] = f
+	c.Unlock()
+	return f
 }
 
 func (c *Client) Open(path string, mode proto.Mode) (*File, error) {
+	return c.OpenContext(context.Background(), path, mode)
+}
+
+// OpenContext is Open, giving up when ctx is done.
+func (c *Client) OpenContext(ctx context.Context, path string, mode proto.Mode) (*File, error) {
 	//log.Println("Open()")
 	//defer log.Println("Open() Return")
-	newFid, err := c.walkFid(path)
+	fid, err := c.walkPath(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-
-	open := proto.TOpen{
-		Header: proto.Header{proto.Topen, c.takeTag(newFid)},
-		Fid:    newFid,
-		Mode:   mode,
-	}
-	res, err := c.getResponse(&open)
+	f, err := fid.OpenContext(ctx, mode)
 	if err != nil {
-		c.clunkFid(newFid)
+		c.clunkFid(fid.fid)
 		return nil, err
 	}
-	if rerror, ok := res.(*proto.RError); ok {
-		c.clunkFid(newFid)
-		return nil, errors.New(rerror.Ename)
-	}
-	ro, ok := res.(*proto.ROpen)
-	if !ok {
-		c.clunkFid(newFid)
-		return nil, errors.New("Unexpected response to TOpen.")
-	}
-	//c.clunkFid(newFid)
-	iounit := ro.Iounit
-	if iounit == 0 {
-		iounit = math.MaxUint32
-	}
-	return &File{
-		fid:    newFid,
-		client: c,
-		offset: 0,
-		iounit: iounit,
-	}, nil
+	return f, nil
 }
 
-func (f *File) flushAll(fid uint32) error {
+func (f *File) Close() error {
+	//log.Println("Close()")
+	//defer log.Println("Close() Return")
+	if f.closed {
+		return errors.New("file already closed")
+	}
+	f.closed = true
+	f.dropReadAhead()
 	f.client.Lock()
-	defer f.client.Unlock()
-	for t, cf := range f.client.tagFids {
-		if cf != fid {
-			continue
-		}
-		//for t, r := range f.client.calls {
-		flush := proto.TFlush{
-			Header: proto.Header{proto.Tflush, f.client.lockedTakeTag(0)},
-			Oldtag: t,
-		}
-		verboseLog("<=out= %v\n", proto.FCall(&flush))
-		_, err := f.client.c.Write(flush.Compose())
-		if err != nil {
-			return err
-		}
-		r := f.client.calls[t]
-		close(r) // Should we send an RError instead?
-		delete(f.client.calls, t)
+	delete(f.client.files, f.fid)
+	delete(f.client.lostFids, f.fid)
+	f.client.Unlock()
+	// Calls still waiting on f would hold up its Tclunk.
+	f.client.flushAll(f.fid, errors.New("file closed"))
+	err := f.client.clunk(context.Background(), f.sess, f.fid)
+	if f.mode&proto.Orclose != 0 {
+		f.client.cache.invalidate(f.path)
 	}
-	return nil
+	return err
 }
 
-func (f *File) Close() error {
-	//log.Println("Close()")
-	//defer log.Println("Close() Return")
-	if err := f.flushAll(f.fid); err != nil {
-		return err
+// rpc sends call for f, failing if f could not be reopened after the
+// client reconnected.
+func (f *File) rpc(ctx context.Context, call proto.FCall) (proto.FCall, error) {
+	f.client.Lock()
+	err := f.client.lostFids[f.fid]
+	f.client.Unlock()
+	if err != nil {
+		f.client.returnTag(call.GetTag())
+		return nil, err
 	}
-	f.client.clunkFid(f.fid)
-	return nil
+	return f.client.rpc(ctx, f.sess, call)
 }
 
+// Read reads from f at its offset. It fails with os.ErrDeadlineExceeded
+// once the read deadline of f has passed.
 func (f *File) Read(p []byte) (n int, err error) {
+	return f.ReadContext(f.readDeadline.context(), p)
+}
+
+// ReadContext is Read, giving up when ctx is done.
+func (f *File) ReadContext(ctx context.Context, p []byte) (n int, err error) {
 	//log.Printf("Read(%d)", len(p))
 	//defer log.Printf("Read() Return (%d, %v)", n, err)
-	if len(p) > int(f.client.msize-11) {
-		p = p[:f.client.msize-11]
+	if f.client.window > 1 {
+		return f.readAhead(ctx, p)
 	}
-	if len(p) > int(f.iounit) {
-		p = p[:f.iounit]
+	n, err = f.ReadAtContext(ctx, p, int64(f.offset))
+	f.offset += uint64(n)
+	return n, err
+}
+
+// ReadAt reads from f at off, with a single Tread, so it may read less
+// than len(b). It fails with os.ErrDeadlineExceeded once the read
+// deadline of f has passed.
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	return f.ReadAtContext(f.readDeadline.context(), b, off)
+}
+
+// ReadAtContext is ReadAt, giving up when ctx is done.
+func (f *File) ReadAtContext(ctx context.Context, b []byte, off int64) (n int, err error) {
+	//log.Printf("ReadAt(%d (len: %d))\n", off, len(b))
+	//defer func() { log.Printf("ReadAt -> %d, (err: %s)", n, err) }()
+	if len(b) > f.readSize() {
+		b = b[:f.readSize()]
 	}
 	read := proto.TRead{
 		Header: proto.Header{proto.Tread, f.client.takeTag(f.fid)},
 		Fid:    f.fid,
-		Offset: f.offset,
-		Count:  uint32(len(p)),
+		Offset: uint64(off),
+		Count:  uint32(len(b)),
 	}
-	res, err := f.client.getResponse(&read)
+	res, err := f.rpc(ctx, &read)
 	if err != nil {
 		return 0, err
 	}
@@ -671,133 +1009,152 @@ func (f *File) Read(p []byte) (n int, err error) {
 		return 0, errors.New("Unexpected response to TRead.")
 	}
 
-	n = copy(p, rresp.Data)
+	n = copy(b, rresp.Data)
 	if uint32(n) != rresp.Count {
 		panic("Sent too much data.")
 	}
-	f.offset += uint64(n)
 	if len(rresp.Data) == 0 {
 		return 0, io.EOF
 	}
 	return n, nil
 }
 
-func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
-	//log.Printf("ReadAt(%d (len: %d))\n", off, len(b))
-	//defer func() { log.Printf("ReadAt -> %d, (err: %s)", n, err) }()
-	if len(b) > int(f.client.msize-11) {
-		b = b[:f.client.msize-11]
+// Seek sets the offset of the next Read or Write on f, as io.Seeker
+// describes. Seeking relative to the end of the file stats it.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(f.offset)
+	case io.SeekEnd:
+		st, err := f.Stat()
+		if err != nil {
+			return int64(f.offset), err
+		}
+		offset += int64(st.Length)
+	default:
+		return int64(f.offset), errors.New("Seek: invalid whence")
 	}
-	if len(b) > int(f.iounit) {
-		b = b[:f.iounit]
+	if offset < 0 {
+		return int64(f.offset), errors.New("Seek: negative offset")
 	}
-	read := proto.TRead{
-		Header: proto.Header{proto.Tread, f.client.takeTag(f.fid)},
+	f.offset = uint64(offset)
+	return offset, nil
+}
+
+// Stat returns the Stat of the open file f.
+func (f *File) Stat() (*proto.Stat, error) {
+	return f.StatContext(context.Background())
+}
+
+// StatContext is Stat, giving up when ctx is done.
+func (f *File) StatContext(ctx context.Context) (*proto.Stat, error) {
+	stat := proto.TStat{
+		Header: proto.Header{proto.Tstat, f.client.takeTag(f.fid)},
 		Fid:    f.fid,
-		Offset: uint64(off),
-		Count:  uint32(len(b)),
 	}
-	res, err := f.client.getResponse(&read)
+	res, err := f.rpc(ctx, &stat)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if rerror, ok := res.(*proto.RError); ok {
-		if rerror.Ename == "EOF" {
-			return 0, io.EOF
-		}
-		return 0, errors.New(rerror.Ename)
+		return nil, errors.New(rerror.Ename)
 	}
-	rresp, ok := res.(*proto.RRead)
+	rstat, ok := res.(*proto.RStat)
 	if !ok {
-		return 0, errors.New("Unexpected response to TRead.")
-	}
-
-	n = copy(b, rresp.Data)
-	if uint32(n) != rresp.Count {
-		panic("Sent too much data.")
-	}
-	f.offset += uint64(n)
-	if len(rresp.Data) == 0 {
-		return 0, io.EOF
+		return nil, errors.New("Unexpected response to RStat.")
 	}
-	return n, nil
+	return &rstat.Stat, nil
 }
 
+// Write writes to f at its offset. It fails with os.ErrDeadlineExceeded
+// once the write deadline of f has passed.
 func (f *File) Write(p []byte) (n int, err error) {
+	return f.WriteContext(f.writeDeadline.context(), p)
+}
+
+// WriteContext is Write, giving up when ctx is done.
+func (f *File) WriteContext(ctx context.Context, p []byte) (n int, err error) {
 	//log.Println("Write()")
 	//defer log.Println("Write() Return")
-	n, err = f.twrite(p, f.offset)
+	n, err = f.twrite(ctx, p, f.offset)
 	f.offset += uint64(n)
 	return n, err
 }
 
+// WriteAt writes to f at off. It fails with os.ErrDeadlineExceeded once
+// the write deadline of f has passed.
 func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	return f.WriteAtContext(f.writeDeadline.context(), b, off)
+}
+
+// WriteAtContext is WriteAt, giving up when ctx is done.
+func (f *File) WriteAtContext(ctx context.Context, b []byte, off int64) (n int, err error) {
 	//log.Printf("WriteAt(b(%d), off: %d)", len(b), off)
 	//defer log.Println("WriteAt() Return")
-	return f.twrite(b, uint64(off))
+	return f.twrite(ctx, b, uint64(off))
 }
 
-func (f *File) twrite(p []byte, off uint64) (n int, err error) {
+func (f *File) twrite(ctx context.Context, p []byte, off uint64) (n int, err error) {
+	// Data read ahead may be overwritten.
+	f.dropReadAhead()
+	defer f.client.cache.changed(f.path)
+	if f.client.window > 1 && len(p) > f.writeSize() {
+		return f.pwrite(ctx, p, off)
+	}
 	wrote := 0
 	for len(p) > 0 {
 		//log.Printf("f.client.msize: %d, f.iounit: %d", f.client.msize, f.iounit)
 		b := p
-		if len(b) > int(f.client.msize-23) {
-			b = b[:f.client.msize-23]
-		}
-		if len(b) > int(f.iounit) {
-			b = b[:f.iounit]
-		}
-		write := proto.TWrite{
-			Header: proto.Header{proto.Twrite, f.client.takeTag(f.fid)},
-			Fid:    f.fid,
-			Offset: uint64(off) + uint64(wrote),
-			Count:  uint32(len(b)),
-			Data:   b,
+		if len(b) > f.writeSize() {
+			b = b[:f.writeSize()]
 		}
-		res, err := f.client.getResponse(&write)
+		n, err := f.writeOnce(ctx, b, off+uint64(wrote))
+		wrote += n
 		if err != nil {
 			return wrote, err
 		}
-		if rerror, ok := res.(*proto.RError); ok {
-			return wrote, errors.New(rerror.Ename)
-		}
-		r, ok := res.(*proto.RWrite)
-		if !ok {
-			return wrote, errors.New("Unexpected response to TWrite.")
-		}
-		wrote += int(r.Count)
-		p = p[r.Count:]
+		p = p[n:]
 	}
 	return wrote, nil
 }
 
-func (c *Client) Remove(path string) error {
-	//log.Printf("Remove(%s)\n", path)
-	//defer log.Println("Remove() Return")
-	defer c.dropCachedFid(path)
-	newFid, err := c.walkFid(path)
-	if err != nil {
-		return err
-	}
-	// Tremove automatically clunks the fid regardless of response.
-	defer c.returnFid(newFid)
-
-	remove := proto.TRemove{
-		Header: proto.Header{proto.Tremove, c.takeTag(newFid)},
-		Fid:    newFid,
+// writeOnce writes b, which fits in one message, at off with a single
+// Twrite.
+func (f *File) writeOnce(ctx context.Context, b []byte, off uint64) (int, error) {
+	write := proto.TWrite{
+		Header: proto.Header{proto.Twrite, f.client.takeTag(f.fid)},
+		Fid:    f.fid,
+		Offset: off,
+		Count:  uint32(len(b)),
+		Data:   b,
 	}
-	res, err := c.getResponse(&remove)
+	res, err := f.rpc(ctx, &write)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if rerror, ok := res.(*proto.RError); ok {
-		c.clunkFid(newFid)
-		return errors.New(rerror.Ename)
+		return 0, errors.New(rerror.Ename)
 	}
-	_, ok := res.(*proto.RRemove)
+	r, ok := res.(*proto.RWrite)
 	if !ok {
-		return errors.New("Unexpected response to TRemove.")
+		return 0, errors.New("Unexpected response to TWrite.")
 	}
-	return nil
+	return int(r.Count), nil
+}
+
+func (c *Client) Remove(path string) error {
+	return c.RemoveContext(context.Background(), path)
+}
+
+// RemoveContext is Remove, giving up when ctx is done.
+func (c *Client) RemoveContext(ctx context.Context, path string) error {
+	//log.Printf("Remove(%s)\n", path)
+	//defer log.Println("Remove() Return")
+	defer c.dropCachedFid(path)
+	fid, err := c.walkPath(ctx, path)
+	if err != nil {
+		return err
+	}
+	return fid.RemoveContext(ctx)
 }
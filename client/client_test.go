@@ -1,10 +1,21 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/knusbaum/go9p"
@@ -82,3 +93,1337 @@ func TestWalk(t *testing.T) {
 	err = f.Close()
 	assert.NoError(t, err)
 }
+
+func TestDialect(t *testing.T) {
+	tfs, _ := setup(t)
+
+	for _, tt := range []struct {
+		dialect proto.Dialect
+		nuid    uint32
+	}{
+		{proto.DotU, 65534},
+		{proto.Plan9, proto.NoUid},
+	} {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			p1r, p1w := io.Pipe()
+			p2r, p2w := io.Pipe()
+			go go9p.ServeReadWriter(p1r, p2w, tfs.Server())
+
+			c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "", WithDialect(tt.dialect))
+			assert.NoError(t, err)
+			st, err := c.Stat("/hello")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.nuid, st.NUid)
+
+			stats, err := c.Readdir("/")
+			assert.NoError(t, err)
+			assert.Len(t, stats, 1)
+			assert.Equal(t, tt.nuid, stats[0].NUid)
+
+			_, err = c.Open("/nonexistent", proto.Oread)
+			assert.Error(t, err)
+		})
+	}
+}
+
+type closeFile struct {
+	*fs.StaticFile
+	closed chan uint64
+}
+
+func (f *closeFile) Close(fid uint64) error {
+	f.closed <- fid
+	return f.StaticFile.Close(fid)
+}
+
+func TestServerShutdown(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	hello := &closeFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)),
+		closed:     make(chan uint64, 1),
+	}
+	root.AddChild(hello)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &go9p.Server{Srv: testFS.Server()}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "")
+	assert.NoError(t, err)
+	_, err = c.Open("/hello", proto.Oread)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, srv.Shutdown(ctx))
+	assert.Equal(t, go9p.ErrServerClosed, <-served)
+	select {
+	case <-hello.closed:
+	default:
+		t.Error("open file was not closed by Shutdown")
+	}
+
+	_, err = Dial("tcp", l.Addr().String(), "glenda", "")
+	assert.Error(t, err)
+}
+
+// failSrv fails every Stat with a go error rather than an RError.
+type failSrv struct {
+	go9p.Srv
+}
+
+func (s failSrv) Stat(go9p.Conn, *proto.TStat) (proto.FCall, error) {
+	return nil, errors.New("stat failed")
+}
+
+func TestServerFailure(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	served := make(chan error, 1)
+	go func() { served <- go9p.ServeReadWriter(p1r, p2w, failSrv{testFS.Server()}) }()
+
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "")
+	assert.NoError(t, err)
+	stated := make(chan error, 1)
+	go func() {
+		_, err := c.Stat("/hello")
+		stated <- err
+	}()
+	select {
+	case err := <-stated:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stat did not return after the server failed")
+	}
+	assert.EqualError(t, <-served, "stat failed")
+}
+
+type slowFile struct {
+	*fs.StaticFile
+	running int32
+	max     int32
+}
+
+func (f *slowFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	n := atomic.AddInt32(&f.running, 1)
+	defer atomic.AddInt32(&f.running, -1)
+	for {
+		max := atomic.LoadInt32(&f.max)
+		if n <= max || atomic.CompareAndSwapInt32(&f.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return f.StaticFile.Read(fid, offset, count)
+}
+
+func TestServerLimits(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	hello := &slowFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)),
+	}
+	root.AddChild(hello)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &go9p.Server{Srv: testFS.Server(), MaxInflight: 2, QueueDepth: 1, MaxServerInflight: 1}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	// Many more requests than the queues hold are sent at once. The
+	// server slows the clients down, and handles one read at a time.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		c, err := Dial("tcp", l.Addr().String(), "glenda", "")
+		assert.NoError(t, err)
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f, err := c.Open("/hello", proto.Oread)
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer f.Close()
+				bs := make([]byte, 100)
+				n, err := f.Read(bs)
+				assert.NoError(t, err)
+				assert.Equal(t, helloText, string(bs[:n]))
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hello.max))
+}
+
+func TestServerFidOrder(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+	hang := &hangFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hang", "glenda", "glenda", 0666), nil),
+		cancelled:  make(chan struct{}, 10),
+	}
+	root.AddChild(hang)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &go9p.Server{Srv: testFS.Server(), MaxInflight: 2}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := c.Open("/hang", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	// More reads than the server has workers wait on one fid. They are
+	// handled one at a time, and the rest wait without holding a
+	// worker, so requests on other fids are still handled.
+	ctx, cancel := context.WithCancel(context.Background())
+	reads := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := f.ReadAtContext(ctx, make([]byte, 10), 0)
+			reads <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Stat("/hello")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a request on another fid waited behind a busy fid")
+	}
+	cancel()
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, context.Canceled, <-reads)
+	}
+}
+
+func TestMsize(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("big", "glenda", "glenda", 0444), data))
+
+	for _, tt := range []struct {
+		asked, got uint32
+	}{
+		{0, DefaultMsize},
+		{1 << 20, 1 << 20},
+		{1 << 30, proto.MaxMsize},
+	} {
+		p1r, p1w := io.Pipe()
+		p2r, p2w := io.Pipe()
+		go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+		var opts []Option
+		if tt.asked != 0 {
+			opts = append(opts, WithMsize(tt.asked))
+		}
+		c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "", opts...)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, tt.got, c.msize)
+
+		f, err := c.Open("/big", proto.Oread)
+		assert.NoError(t, err)
+		bs := make([]byte, len(data))
+		n, err := f.Read(bs)
+		assert.NoError(t, err)
+		expected := int(tt.got - proto.IOHdrSize)
+		if expected > len(data) {
+			expected = len(data)
+		}
+		assert.Equal(t, expected, n)
+		assert.Equal(t, data[:n], bs[:n])
+		f.Close()
+		p1w.Close()
+	}
+}
+
+type eventLog struct {
+	sync.Mutex
+	events []go9p.Event
+}
+
+func (l *eventLog) Trace(e *go9p.Event) {
+	l.Lock()
+	defer l.Unlock()
+	l.events = append(l.events, *e)
+}
+
+func (l *eventLog) find(kind go9p.EventKind, call proto.FCall) *go9p.Event {
+	l.Lock()
+	defer l.Unlock()
+	for i := range l.events {
+		e := &l.events[i]
+		if e.Kind != kind {
+			continue
+		}
+		if call == nil || (e.Call != nil && e.Call.GetTag() == call.GetTag() && fmt.Sprintf("%T", e.Call) == fmt.Sprintf("%T", call)) {
+			return e
+		}
+	}
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+
+	var srvLog, cliLog eventLog
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &go9p.Server{Srv: testFS.Server(), Tracer: &srvLog}
+	go srv.Serve(l)
+
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "", WithTracer(&cliLog))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Stat("/hello")
+	assert.NoError(t, err)
+	srv.Close()
+
+	for _, log := range []*eventLog{&srvLog, &cliLog} {
+		assert.NotNil(t, log.find(go9p.EventConnect, nil))
+		auth := log.find(go9p.EventAuth, nil)
+		if assert.NotNil(t, auth) {
+			assert.Equal(t, "glenda", auth.User)
+			assert.NoError(t, auth.Err)
+		}
+	}
+
+	// The server receives requests and sends responses, and the client
+	// does the opposite. Responses carry their request and latency.
+	stat := &proto.TStat{Header: proto.Header{Type: proto.Tstat}}
+	cliLog.Lock()
+	for _, e := range cliLog.events {
+		if ts, ok := e.Call.(*proto.TStat); ok && e.Kind == go9p.EventSend {
+			stat.Tag = ts.Tag
+		}
+	}
+	cliLog.Unlock()
+	assert.NotNil(t, srvLog.find(go9p.EventReceive, stat))
+	resp := srvLog.find(go9p.EventSend, &proto.RStat{Header: proto.Header{Tag: stat.Tag}})
+	if assert.NotNil(t, resp) {
+		assert.IsType(t, &proto.TStat{}, resp.Request)
+		assert.True(t, resp.Latency > 0)
+	}
+	resp = cliLog.find(go9p.EventReceive, &proto.RStat{Header: proto.Header{Tag: stat.Tag}})
+	if assert.NotNil(t, resp) {
+		assert.IsType(t, &proto.TStat{}, resp.Request)
+		assert.True(t, resp.Latency > 0)
+	}
+
+	// The connection is closed after Close returns.
+	for i := 0; i < 100 && srvLog.find(go9p.EventDisconnect, nil) == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NotNil(t, srvLog.find(go9p.EventDisconnect, nil))
+}
+
+func TestMetrics(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+	srvMetrics := go9p.NewMetrics()
+	root.AddChild(fs.NewMetricsFile(testFS.NewStat("metrics", "glenda", "glenda", 0444), srvMetrics))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := &go9p.Server{Srv: testFS.Server(), Metrics: srvMetrics}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	cliMetrics := go9p.NewMetrics()
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "", WithMetrics(cliMetrics))
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := c.Open("/hello", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bs := make([]byte, 100)
+	_, err = f.Read(bs)
+	assert.NoError(t, err)
+	f.Close()
+	_, err = c.Open("/nothing", proto.Oread)
+	assert.Error(t, err)
+
+	f, err = c.Open("/metrics", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bs = make([]byte, 8192)
+	n, err := f.Read(bs)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Contains(t, string(bs[:n]), `go9p_requests_total{type="Tread"} 1`)
+	assert.Contains(t, string(bs[:n]), `go9p_requests_total{type="Tattach"} 1`)
+
+	// Both ends see the same requests.
+	ss, cs := srvMetrics.Snapshot(), cliMetrics.Snapshot()
+	for _, typ := range []string{"Tversion", "Tattach", "Twalk", "Topen", "Tread", "Tclunk"} {
+		assert.NotZero(t, ss.Calls[typ].Count, typ)
+		assert.Equal(t, ss.Calls[typ].Count, cs.Calls[typ].Count, typ)
+		assert.Equal(t, ss.Calls[typ].Errors, cs.Calls[typ].Errors, typ)
+	}
+	assert.Equal(t, uint64(1), ss.Calls["Twalk"].Errors)
+	assert.Equal(t, ss.OpenFids, cs.OpenFids)
+	assert.True(t, ss.OpenFids >= 1)
+	assert.Equal(t, uint64(1), ss.TotalConnections)
+	assert.Len(t, ss.Conns, 1)
+}
+
+func TestMetricsReadWriter(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+	srvMetrics := go9p.NewMetrics()
+	srv := &go9p.Server{Srv: testFS.Server(), Metrics: srvMetrics}
+
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go srv.ServeReadWriter(p1r, p2w)
+
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Stat("/hello")
+	assert.NoError(t, err)
+
+	ss := srvMetrics.Snapshot()
+	assert.Equal(t, uint64(1), ss.TotalConnections)
+	for _, typ := range []string{"Tversion", "Tattach", "Twalk", "Tstat"} {
+		assert.NotZero(t, ss.Calls[typ].Count, typ)
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	testFS, _ := fs.NewFS("glenda", "glenda", 0777,
+		fs.WithCreateFile(fs.CreateStaticFile),
+		fs.WithCreateDir(fs.CreateStaticDir),
+		fs.WithRemoveFile(fs.RMFile),
+	)
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+	// A small msize makes OpenDir read the directory in several parts.
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "", WithMsize(1024))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, c.MkdirAll("/a/b/c", 0755))
+	assert.NoError(t, c.MkdirAll("/a/b", 0755))
+	st, err := c.Stat("/a/b/c")
+	if assert.NoError(t, err) {
+		assert.Equal(t, proto.DMDIR|0755, st.Mode)
+	}
+	assert.Error(t, c.Mkdir("/a/b", 0755))
+
+	f, err := c.Create("/a/b/file", 0644)
+	if assert.NoError(t, err) {
+		f.Write([]byte("some data"))
+		f.Close()
+	}
+	assert.Error(t, c.MkdirAll("/a/b/file/d", 0755))
+
+	assert.NoError(t, c.Chmod("/a/b/file", 0600))
+	assert.NoError(t, c.Truncate("/a/b/file", 4))
+	mtime := time.Unix(1234567890, 0)
+	assert.NoError(t, c.Chtimes("/a/b/file", time.Time{}, mtime))
+	st, err = c.Stat("/a/b/file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(0600), st.Mode)
+		assert.Equal(t, uint64(4), st.Length)
+		assert.Equal(t, uint32(mtime.Unix()), st.Mtime)
+	}
+
+	assert.Error(t, c.Rename("/a/b/file", "/a/file"))
+	assert.NoError(t, c.Rename("/a/b/file", "/a/b/renamed"))
+	_, err = c.Stat("/a/b/file")
+	assert.Error(t, err)
+	_, err = c.Stat("/a/b/renamed")
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		f, err := c.Create(fmt.Sprintf("/a/many%02d", i), 0644)
+		if assert.NoError(t, err) {
+			f.Close()
+		}
+	}
+	d, err := c.OpenDir("/a")
+	if assert.NoError(t, err) {
+		n := 0
+		for d.Next() {
+			n++
+		}
+		assert.NoError(t, d.Err())
+		assert.Equal(t, 101, n)
+		d.Close()
+	}
+
+	var walked []string
+	err = c.Walk("/a", func(path string, stat *proto.Stat, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		if stat.Name == "c" || stat.Name == "many02" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/a", "/a/b", "/a/b/c", "/a/b/renamed", "/a/many00", "/a/many01", "/a/many02"}, walked)
+
+	assert.NoError(t, c.RemoveAll("/a"))
+	assert.NoError(t, c.RemoveAll("/a"))
+	stats, err := c.Readdir("/")
+	assert.NoError(t, err)
+	assert.Empty(t, stats)
+}
+
+func TestFS(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	dir := fs.NewStaticDir(testFS.NewStat("dir", "glenda", "glenda", proto.DMDIR|0755))
+	root.AddChild(dir)
+	dir.AddChild(fs.NewStaticFile(testFS.NewStat("big", "glenda", "glenda", 0644), data))
+	dir.AddChild(fs.NewStaticDir(testFS.NewStat("empty", "glenda", "glenda", proto.DMDIR|0700)))
+
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "", WithMsize(4096))
+	if !assert.NoError(t, err) {
+		return
+	}
+	fsys := NewFS(c)
+	assert.NoError(t, fstest.TestFS(fsys, "hello", "dir/big", "dir/empty"))
+
+	st, err := iofs.Stat(fsys, "dir/empty")
+	if assert.NoError(t, err) {
+		assert.Equal(t, iofs.ModeDir|0700, st.Mode())
+		assert.IsType(t, &proto.Stat{}, st.Sys())
+	}
+	_, err = fsys.Open("nothing")
+	assert.True(t, errors.Is(err, iofs.ErrNotExist))
+	_, err = fsys.Open("/hello")
+	assert.True(t, errors.Is(err, iofs.ErrInvalid))
+}
+
+func TestWindow(t *testing.T) {
+	testFS, _ := fs.NewFS("glenda", "glenda", 0777,
+		fs.WithCreateFile(fs.CreateStaticFile),
+	)
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "", WithMsize(1024), WithWindow(8))
+	if !assert.NoError(t, err) {
+		return
+	}
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	f, err := c.Create("/big", 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+	n, err := io.Copy(f, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	off, err := f.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), off)
+	f.Close()
+
+	f, err = c.Open("/big", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	n, err = io.Copy(&buf, f)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, buf.Bytes())
+
+	// Reads after a Seek continue from the new offset.
+	_, err = f.Seek(5000, io.SeekStart)
+	assert.NoError(t, err)
+	bs := make([]byte, 3000)
+	_, err = io.ReadFull(f, bs)
+	assert.NoError(t, err)
+	assert.Equal(t, data[5000:8000], bs)
+	_, err = f.Seek(-100, io.SeekEnd)
+	assert.NoError(t, err)
+	bs, err = io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, data[len(data)-100:], bs)
+	f.Close()
+
+	// Writes drop the data read ahead of them.
+	f, err = c.Open("/big", proto.Ordwr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bs = make([]byte, 10)
+	_, err = io.ReadFull(f, bs)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("overwritten"))
+	assert.NoError(t, err)
+	bs = make([]byte, 10)
+	_, err = f.ReadAt(bs, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("overwritte"), bs)
+	_, err = f.Seek(10, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = io.ReadFull(f, bs)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("overwritte"), bs)
+	f.Close()
+
+	// io.Copy from a stream writes what arrives, without waiting for
+	// a window of data.
+	f, err = c.Create("/stream", 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pr, pw := io.Pipe()
+	copied := make(chan int64, 1)
+	go func() {
+		n, err := io.Copy(f, pr)
+		assert.NoError(t, err)
+		copied <- n
+	}()
+	_, err = pw.Write([]byte("line\n"))
+	assert.NoError(t, err)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		st, err := c.Stat("/stream")
+		if assert.NoError(t, err) && st.Length == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("data copied from a stream was not written")
+		}
+	}
+	pw.Close()
+	assert.Equal(t, int64(5), <-copied)
+	f.Close()
+}
+
+// requests counts the requests in l other than Twalks, which check a
+// cache without a TTL, and Tclunks, which are sent in the background.
+func (l *eventLog) requests() int {
+	l.Lock()
+	defer l.Unlock()
+	n := 0
+	for _, e := range l.events {
+		switch e.Call.(type) {
+		case *proto.TWalk, *proto.TClunk:
+			continue
+		}
+		if e.Kind == go9p.EventSend {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCache(t *testing.T) {
+	testFS, _ := fs.NewFS("glenda", "glenda", 0777,
+		fs.WithCreateFile(fs.CreateStaticFile),
+		fs.WithCreateDir(fs.CreateStaticDir),
+		fs.WithRemoveFile(fs.RMFile),
+	)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := &go9p.Server{Srv: testFS.Server()}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	var log eventLog
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "", WithCache(0), WithTracer(&log))
+	if !assert.NoError(t, err) {
+		return
+	}
+	other, err := Dial("tcp", l.Addr().String(), "glenda", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	write := func(c *Client, name, data string) {
+		f, err := c.Open(name, proto.Owrite|proto.Otrunc)
+		if assert.NoError(t, err) {
+			f.Write([]byte(data))
+			f.Close()
+		}
+	}
+	length := func(name string) uint64 {
+		st, err := c.Stat(name)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return st.Length
+	}
+
+	assert.NoError(t, c.MkdirAll("/dir", 0755))
+	f, err := c.Create("/dir/a", 0644)
+	if assert.NoError(t, err) {
+		f.Close()
+	}
+	write(c, "/dir/a", "hello")
+
+	// Listing a directory caches it, and the Stats of its files.
+	stats, err := c.Readdir("/dir")
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	n := log.requests()
+	stats, err = c.Readdir("/dir")
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, uint64(5), length("/dir/a"))
+	assert.Equal(t, n, log.requests())
+
+	// Changes made through c drop what they make stale.
+	write(c, "/dir/a", "hello, world")
+	assert.Equal(t, uint64(12), length("/dir/a"))
+	f, err = c.Create("/dir/b", 0644)
+	if assert.NoError(t, err) {
+		f.Close()
+	}
+	stats, err = c.Readdir("/dir")
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	assert.NoError(t, c.Remove("/dir/b"))
+	_, err = c.Stat("/dir/b")
+	assert.Error(t, err)
+
+	// Changes made by other clients are seen once invalidated.
+	write(other, "/dir/a", "hi")
+	assert.Equal(t, uint64(12), length("/dir/a"))
+	c.Invalidate("/dir")
+	assert.Equal(t, uint64(2), length("/dir/a"))
+
+	// A file replaced by another client has a new Qid, which drops what
+	// was cached for it when it is walked to again before its use.
+	assert.NoError(t, other.Remove("/dir/a"))
+	f, err = other.Create("/dir/a", 0644)
+	if assert.NoError(t, err) {
+		f.Write([]byte("new"))
+		f.Close()
+	}
+	assert.Equal(t, uint64(3), length("/dir/a"))
+	stats, err = c.Readdir("/dir")
+	assert.NoError(t, err)
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, uint64(3), stats[0].Length)
+	}
+
+	// Entries expire after the TTL.
+	c, err = Dial("tcp", l.Addr().String(), "glenda", "", WithCache(50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint64(3), length("/dir/a"))
+	write(other, "/dir/a", "hello")
+	assert.Equal(t, uint64(3), length("/dir/a"))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, uint64(5), length("/dir/a"))
+}
+
+// removeSrv holds each Tremove until release is closed.
+type removeSrv struct {
+	go9p.Srv
+	started chan struct{}
+	release chan struct{}
+	removed chan struct{}
+}
+
+func (s removeSrv) Remove(c go9p.Conn, t *proto.TRemove) (proto.FCall, error) {
+	s.started <- struct{}{}
+	<-s.release
+	defer func() { s.removed <- struct{}{} }()
+	return s.Srv.Remove(c, t)
+}
+
+func TestRemoveFlushed(t *testing.T) {
+	testFS, _ := fs.NewFS("glenda", "glenda", 0777,
+		fs.WithCreateFile(fs.CreateStaticFile),
+		fs.WithRemoveFile(fs.RMFile),
+	)
+	rs := removeSrv{
+		Srv:     testFS.Server(),
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+		removed: make(chan struct{}, 1),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := &go9p.Server{Srv: rs, Ordering: go9p.FidOrdered}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, name := range []string{"/a", "/b"} {
+		f, err := c.Create(name, 0644)
+		if assert.NoError(t, err) {
+			f.Close()
+		}
+	}
+	a, err := c.Root().Walk("a")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The Tremove is flushed before the server handles it, so its fid
+	// is not used again until the server is done with it.
+	ctx, cancel := context.WithCancel(context.Background())
+	removed := make(chan error, 1)
+	go func() { removed <- a.RemoveContext(ctx) }()
+	<-rs.started
+	cancel()
+	assert.Equal(t, context.Canceled, <-removed)
+	walked := make(chan *Fid, 1)
+	go func() {
+		b, err := c.Root().Walk("b")
+		assert.NoError(t, err)
+		walked <- b
+	}()
+	var b *Fid
+	select {
+	case b = <-walked:
+	case <-time.After(5 * time.Second):
+		close(rs.release)
+		t.Fatal("a walk reused the fid of the flushed Tremove")
+	}
+	if b == nil {
+		return
+	}
+	close(rs.release)
+	<-rs.removed
+	_, err = b.Stat()
+	assert.NoError(t, err)
+	assert.NoError(t, b.Clunk())
+}
+
+func TestFid(t *testing.T) {
+	testFS, _ := fs.NewFS("glenda", "glenda", 0777,
+		fs.WithCreateFile(fs.CreateStaticFile),
+		fs.WithCreateDir(fs.CreateStaticDir),
+		fs.WithRemoveFile(fs.RMFile),
+	)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := &go9p.Server{Srv: testFS.Server()}
+	go srv.Serve(l)
+	defer srv.Close()
+	var log eventLog
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "", WithTracer(&log))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Paths deeper than a single Twalk can carry are walked in parts.
+	var names []string
+	for i := 0; i < 40; i++ {
+		names = append(names, fmt.Sprintf("d%d", i))
+	}
+	deep := "/" + strings.Join(names, "/")
+	assert.NoError(t, c.MkdirAll(deep, 0755))
+	f, err := c.Create(deep+"/file", 0644)
+	if assert.NoError(t, err) {
+		f.Write([]byte(helloText))
+		f.Close()
+	}
+	st, err := c.Stat(deep + "/file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(len(helloText)), st.Length)
+	}
+	log.Lock()
+	for _, e := range log.events {
+		if w, ok := e.Call.(*proto.TWalk); ok {
+			assert.LessOrEqual(t, len(w.Wname), maxWalkElem)
+		}
+	}
+	log.Unlock()
+
+	root := c.Root()
+	d, err := root.Walk(names[:20]...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/"+strings.Join(names[:20], "/"), d.Path())
+	next, err := d.Walk(names[20])
+	if assert.NoError(t, err) {
+		st, err := next.Stat()
+		if assert.NoError(t, err) {
+			assert.Equal(t, names[20], st.Name)
+			assert.Equal(t, st.Qid, next.Qid())
+		}
+		up, err := next.Walk("..")
+		if assert.NoError(t, err) {
+			st, err := up.Stat()
+			if assert.NoError(t, err) {
+				assert.Equal(t, names[19], st.Name)
+			}
+			assert.NoError(t, up.Clunk())
+		}
+		assert.NoError(t, next.Clunk())
+		assert.Error(t, next.Clunk())
+	}
+	_, err = d.Walk("nothing")
+	assert.Error(t, err)
+
+	// Opening, creating in and removing through a Fid uses it up.
+	clone, err := d.Clone()
+	if assert.NoError(t, err) {
+		f, err := clone.Create("new", 0644, proto.Ordwr)
+		if assert.NoError(t, err) {
+			f.Write([]byte("data"))
+			f.Close()
+		}
+		assert.Error(t, clone.Clunk())
+	}
+	nf, err := d.Walk("new")
+	if assert.NoError(t, err) {
+		assert.Equal(t, d.Path()+"/new", nf.Path())
+		f, err := nf.Open(proto.Oread)
+		if assert.NoError(t, err) {
+			bs, err := io.ReadAll(f)
+			assert.NoError(t, err)
+			assert.Equal(t, "data", string(bs))
+			f.Close()
+		}
+	}
+	nf, err = d.Walk("new")
+	if assert.NoError(t, err) {
+		assert.NoError(t, nf.Remove())
+	}
+	_, err = d.Walk("new")
+	assert.Error(t, err)
+	assert.NoError(t, d.Clunk())
+
+	// The root stays usable.
+	rf, err := root.Open(proto.Oread)
+	if assert.NoError(t, err) {
+		rf.Close()
+	}
+	assert.NoError(t, root.Clunk())
+	st, err = root.Stat()
+	assert.NoError(t, err)
+	stats, err := c.Readdir("/")
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+}
+
+// hangFile is a file whose reads and writes wait until they are
+// cancelled.
+type hangFile struct {
+	*fs.StaticFile
+	cancelled chan struct{}
+}
+
+func (f *hangFile) OpenContext(ctx context.Context, c fs.Caller, omode proto.Mode) error {
+	return f.Open(c.Fid, omode)
+}
+
+func (f *hangFile) ReadContext(ctx context.Context, c fs.Caller, offset uint64, count uint64) ([]byte, error) {
+	<-ctx.Done()
+	f.cancelled <- struct{}{}
+	return nil, ctx.Err()
+}
+
+func (f *hangFile) WriteContext(ctx context.Context, c fs.Caller, offset uint64, data []byte) (uint32, error) {
+	<-ctx.Done()
+	f.cancelled <- struct{}{}
+	return 0, ctx.Err()
+}
+
+func TestContext(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+	hang := &hangFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hang", "glenda", "glenda", 0666), nil),
+		cancelled:  make(chan struct{}, 10),
+	}
+	root.AddChild(hang)
+
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	waitCancel := func() {
+		select {
+		case <-hang.cancelled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("call was not flushed")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.OpenContext(ctx, "/hello", proto.Oread)
+	assert.Equal(t, context.Canceled, err)
+
+	f, err := c.Open("/hang", proto.Ordwr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = f.ReadAtContext(ctx, make([]byte, 10), 0)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	waitCancel()
+
+	// Deadlines work as they do for a net.Conn, and can be extended
+	// while a call waits.
+	f.SetReadDeadline(time.Now().Add(time.Hour))
+	done := make(chan error)
+	go func() {
+		_, err := f.Read(make([]byte, 10))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	f.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	err = <-done
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	waitCancel()
+	f.SetDeadline(time.Now().Add(-time.Second))
+	_, err = f.Write([]byte("data"))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	f.SetDeadline(time.Time{})
+
+	// The client still works after the flushes.
+	for i := 0; i < 10; i++ {
+		st, err := c.StatContext(context.Background(), "/hello")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "hello", st.Name)
+		}
+	}
+}
+
+func TestConnectionLoss(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)))
+	hang := &hangFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hang", "glenda", "glenda", 0666), nil),
+		cancelled:  make(chan struct{}, 10),
+	}
+	root.AddChild(hang)
+
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	f, err := c.Open("/hang", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan error)
+	go func() {
+		_, err := f.Read(make([]byte, 10))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, c.Err())
+
+	// The server hangs up. The waiting call fails, and so do later ones.
+	p2w.Close()
+	var connErr *ConnError
+	select {
+	case err = <-done:
+		if assert.True(t, errors.As(err, &connErr)) {
+			assert.Equal(t, io.EOF, connErr.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending call did not fail")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client is not done")
+	}
+	assert.True(t, errors.As(c.Err(), &connErr))
+	_, err = c.Stat("/hello")
+	assert.True(t, errors.As(err, &connErr))
+}
+
+func TestReconnect(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777, fs.WithRemoveFile(fs.RMFile))
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0666), []byte(helloText)))
+	root.AddChild(fs.NewStaticFile(testFS.NewStat("other", "glenda", "glenda", 0666), []byte("other")))
+
+	var mu sync.Mutex
+	var conns []*TwoPipe
+	var dials int
+	dial := func() (io.ReadWriteCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dials++
+		if dials == 3 {
+			return nil, errors.New("dial failed")
+		}
+		p1r, p1w := io.Pipe()
+		p2r, p2w := io.Pipe()
+		go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+		conns = append(conns, &TwoPipe{p1r, p2w})
+		return &TwoPipe{p2r, p1w}, nil
+	}
+	hangUp := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		conns[len(conns)-1].Close()
+	}
+	rwc, _ := dial()
+	c, err := NewClient(rwc, "glenda", "", WithReconnect(dial))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Stat("/hello")
+	assert.NoError(t, err)
+	f, err := c.Open("/hello", proto.Ordwr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	g, err := c.Open("/other", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer g.Close()
+	bs := make([]byte, 5)
+	_, err = f.Read(bs)
+	assert.NoError(t, err)
+
+	// The client reconnects, and the Files carry on.
+	hangUp()
+	_, err = f.Read(bs)
+	assert.NoError(t, err)
+	assert.Equal(t, helloText[5:10], string(bs))
+	_, err = f.WriteAt([]byte("J"), 0)
+	assert.NoError(t, err)
+	st, err := c.Stat("/hello")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hello", st.Name)
+	}
+
+	// Files that were removed in the meantime cannot be reopened. The
+	// client retries when dialing fails.
+	assert.NoError(t, c.Remove("/other"))
+	hangUp()
+	_, err = g.Read(bs)
+	assert.Error(t, err)
+	n, err := f.ReadAt(bs, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Jello", string(bs[:n]))
+	assert.Nil(t, c.Err())
+	mu.Lock()
+	assert.Equal(t, 4, dials)
+	mu.Unlock()
+}
+
+func TestAlloc(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777)
+	hello := &closeFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hello", "glenda", "glenda", 0444), []byte(helloText)),
+		closed:     make(chan uint64, 10),
+	}
+	root.AddChild(hello)
+	hang := &hangFile{
+		StaticFile: fs.NewStaticFile(testFS.NewStat("hang", "glenda", "glenda", 0666), nil),
+		cancelled:  make(chan struct{}, 10),
+	}
+	root.AddChild(hang)
+
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, testFS.Server())
+	var log eventLog
+	c, err := NewClient(&TwoPipe{p2r, p1w}, "glenda", "", WithTracer(&log))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotNil(t, log.find(go9p.EventSend, &proto.TRVersion{Header: proto.Header{Type: proto.Tversion, Tag: _NOTAG}}))
+
+	// With 4 tags, 3 calls may wait, and the last tag is kept for a
+	// Tflush.
+	c.Lock()
+	c.tagLimit = 4
+	c.Unlock()
+	held := func() uint32 {
+		c.Lock()
+		defer c.Unlock()
+		return c.tagsHeld
+	}
+	var cancels []context.CancelFunc
+	reads := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		f, err := c.Open("/hang", proto.Oread)
+		if !assert.NoError(t, err) {
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancels = append(cancels, cancel)
+		go func() {
+			_, err := f.ReadContext(ctx, make([]byte, 10))
+			reads <- err
+		}()
+	}
+	for held() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	stat := make(chan error, 1)
+	go func() {
+		_, err := c.Stat("/hello")
+		stat <- err
+	}()
+	select {
+	case <-stat:
+		t.Fatal("Stat did not wait for a tag")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancels[0]()
+	assert.Equal(t, context.Canceled, <-reads)
+	select {
+	case err := <-stat:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stat still waits for a tag")
+	}
+	for _, cancel := range cancels[1:] {
+		cancel()
+		assert.Equal(t, context.Canceled, <-reads)
+	}
+	log.Lock()
+	for _, e := range log.events {
+		if e.Kind == go9p.EventSend {
+			if tag := e.Call.GetTag(); tag != _NOTAG {
+				assert.True(t, tag < 4, "tag %d", tag)
+			}
+		}
+	}
+	log.Unlock()
+
+	// The root is never clunked.
+	c.clunkFid(c.rootFid)
+
+	// Close clunks the open Files, and the Client can no longer be
+	// used.
+	_, err = c.Open("/hello", proto.Oread)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.Close())
+	select {
+	case <-hello.closed:
+	default:
+		t.Error("open file was not clunked by Close")
+	}
+	_, err = c.Stat("/hello")
+	assert.Equal(t, ErrClientClosed, err)
+	assert.Equal(t, ErrClientClosed, c.Close())
+	assert.Equal(t, ErrClientClosed, c.Err())
+}
+
+func TestCloseCachedFids(t *testing.T) {
+	testFS, root := fs.NewFS("glenda", "glenda", 0777,
+		fs.WithRemoveFile(fs.RMFile),
+	)
+	dir := fs.NewStaticDir(testFS.NewStat("a", "glenda", "glenda", 0777|proto.DMDIR))
+	root.AddChild(dir)
+	for _, name := range []string{"b", "c", "d"} {
+		dir.AddChild(fs.NewStaticFile(testFS.NewStat(name, "glenda", "glenda", 0666), nil))
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var srvLog eventLog
+	srv := &go9p.Server{Srv: testFS.Server(), Tracer: &srvLog}
+	go srv.Serve(l)
+	defer srv.Close()
+	clunks := func() int {
+		srvLog.Lock()
+		defer srvLog.Unlock()
+		n := 0
+		for _, e := range srvLog.events {
+			if _, ok := e.Call.(*proto.TClunk); ok && e.Kind == go9p.EventReceive {
+				n++
+			}
+		}
+		return n
+	}
+
+	c, err := Dial("tcp", l.Addr().String(), "glenda", "", WithCache(0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c.Stat("a/b")
+	assert.NoError(t, err)
+	_, err = c.Stat("/a/c/")
+	assert.NoError(t, err)
+	_, err = c.Stat("/a/d")
+	assert.NoError(t, err)
+	assert.NoError(t, c.Remove("/a/d/"))
+
+	// Fids are cached by cleaned path, and a removed file's is dropped.
+	c.pathCacheLock.RLock()
+	var paths []string
+	for p := range c.pathCache {
+		paths = append(paths, p)
+	}
+	c.pathCacheLock.RUnlock()
+	assert.ElementsMatch(t, []string{"/a", "/a/b", "/a/c"}, paths)
+
+	// Every fid walked, other than the removed one, is clunked: those
+	// cached for /a, /a/b and /a/c, and the one /a/d was stated with.
+	assert.NoError(t, c.Close())
+	for deadline := time.Now().Add(5 * time.Second); clunks() < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 4, clunks())
+}
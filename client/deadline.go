@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// A deadline is a time after which the calls of a File fail, like the
+// read and write deadlines of a net.Conn. Calls that are waiting for the
+// server when the deadline passes are flushed.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // Closed when the deadline passes.
+}
+
+// set sets the deadline to t. A zero t means no deadline.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer to close cancel.
+	}
+	d.timer = nil
+
+	closed := d.cancel != nil && isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = nil
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed || d.cancel == nil {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// context returns a context that is done when the deadline passes.
+func (d *deadline) context() context.Context {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel == nil {
+		return context.Background()
+	}
+	return deadlineContext{context.Background(), d.cancel}
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// deadlineContext is a context that is done when done is closed. Its Err
+// is os.ErrDeadlineExceeded, which is what a net.Conn returns for an
+// expired deadline.
+type deadlineContext struct {
+	context.Context
+	done <-chan struct{}
+}
+
+func (c deadlineContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c deadlineContext) Err() error {
+	select {
+	case <-c.done:
+		return os.ErrDeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+// SetDeadline sets both the read and write deadlines of f, as
+// net.Conn's SetDeadline does. A zero t means Read, ReadAt, Write and
+// WriteAt will not time out.
+func (f *File) SetDeadline(t time.Time) error {
+	f.readDeadline.set(t)
+	f.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read and ReadAt calls, including
+// those already waiting for the server. A zero t means no deadline.
+func (f *File) SetReadDeadline(t time.Time) error {
+	f.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write and WriteAt calls,
+// including those already waiting for the server. A zero t means no
+// deadline.
+func (f *File) SetWriteDeadline(t time.Time) error {
+	f.writeDeadline.set(t)
+	return nil
+}
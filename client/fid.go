@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file implements Fid, a handle to a file of the server, from which
+// other files can be walked to without starting over from the root. The
+// methods of Client taking paths are implemented with Fids.
+
+// maxWalkElem is the most names a Twalk may carry. Longer walks are made
+// with several Twalks.
+const maxWalkElem = 16
+
+// A Fid refers to a file on the server. Fids are made by walking from
+// the Root of a Client, or from other Fids, and must be clunked once they
+// are no longer needed, unless they are opened, created in or removed.
+type Fid struct {
+	c    *Client
+	fid  uint32
+	path string
+	qid  proto.Qid
+	refs int // Held by the cache and users of a cached Fid.
+}
+
+// Root returns the Fid of the root of the files attached to. It is used
+// to walk to other files, and is never clunked. Opening, creating in or
+// removing the root uses a clone of it.
+func (c *Client) Root() *Fid {
+	c.Lock()
+	defer c.Unlock()
+	return &Fid{c: c, fid: c.rootFid, path: "/", qid: c.rootQid}
+}
+
+// Path returns the path of f from the root, as it was walked.
+func (f *Fid) Path() string {
+	return f.path
+}
+
+// Qid returns the Qid of the file f refers to, as it was when f was
+// walked. The Qid of the Root, and of Fids cloned from it, may be zero.
+func (f *Fid) Qid() proto.Qid {
+	return f.qid
+}
+
+// Walk returns a new Fid for the file reached by walking names from f.
+// Each name is a single path element, which may be "..". Walking no
+// names clones f.
+func (f *Fid) Walk(names ...string) (*Fid, error) {
+	return f.WalkContext(context.Background(), names...)
+}
+
+// WalkContext is Walk, giving up when ctx is done.
+func (f *Fid) WalkContext(ctx context.Context, names ...string) (*Fid, error) {
+	newfid := f.c.takeFid()
+	qid, walked, err := f.c.walkFrom(ctx, nil, f.fid, f.path, names, newfid)
+	if err != nil {
+		if walked {
+			f.c.clunkFid(newfid)
+		} else {
+			f.c.returnFid(newfid)
+		}
+		return nil, err
+	}
+	if len(names) == 0 {
+		qid = f.qid
+	}
+	return &Fid{
+		c:    f.c,
+		fid:  newfid,
+		path: path.Join(append([]string{f.path}, names...)...),
+		qid:  qid,
+	}, nil
+}
+
+// Clone returns a new Fid for the same file as f.
+func (f *Fid) Clone() (*Fid, error) {
+	return f.Walk()
+}
+
+// own returns f, or a clone of it if it is the root, which must not be
+// opened or removed.
+func (f *Fid) own(ctx context.Context) (*Fid, error) {
+	if f.fid != f.c.rootFid {
+		return f, nil
+	}
+	return f.WalkContext(ctx)
+}
+
+// Stat returns the Stat of the file f refers to.
+func (f *Fid) Stat() (*proto.Stat, error) {
+	return f.StatContext(context.Background())
+}
+
+// StatContext is Stat, giving up when ctx is done.
+func (f *Fid) StatContext(ctx context.Context) (*proto.Stat, error) {
+	stat := proto.TStat{
+		Header: proto.Header{proto.Tstat, f.c.takeTag(f.fid)},
+		Fid:    f.fid,
+	}
+	res, err := f.c.getResponseContext(ctx, &stat)
+	if err != nil {
+		return nil, err
+	}
+	if rerror, ok := res.(*proto.RError); ok {
+		return nil, errors.New(rerror.Ename)
+	}
+	rstat, ok := res.(*proto.RStat)
+	if !ok {
+		return nil, errors.New("Unexpected response to RStat.")
+	}
+	f.c.cache.setStat(f.path, &rstat.Stat)
+	return &rstat.Stat, nil
+}
+
+// WStat changes the Stat of the file f refers to, as described for
+// proto.NullStat. If stat renames the file, the path of f changes with
+// it.
+func (f *Fid) WStat(stat *proto.Stat) error {
+	return f.WStatContext(context.Background(), stat)
+}
+
+// WStatContext is WStat, giving up when ctx is done.
+func (f *Fid) WStatContext(ctx context.Context, stat *proto.Stat) error {
+	defer f.c.cache.changed(f.path)
+	wstat := proto.TWstat{
+		Header: proto.Header{proto.Twstat, f.c.takeTag(f.fid)},
+		Fid:    f.fid,
+		Stat:   *stat,
+	}
+	res, err := f.c.getResponseContext(ctx, &wstat)
+	if err != nil {
+		return err
+	}
+	if rerror, ok := res.(*proto.RError); ok {
+		return errors.New(rerror.Ename)
+	}
+	_, ok := res.(*proto.RWstat)
+	if !ok {
+		return fmt.Errorf("Unexpected response to RWstat: %#v", res)
+	}
+	if stat.Name != "" {
+		f.c.cache.invalidate(f.path)
+		if f.path != "/" {
+			f.path = path.Join(path.Dir(f.path), stat.Name)
+		}
+	}
+	return nil
+}
+
+// Open opens the file f refers to with mode. The returned File uses the
+// fid of f, which must not be used or clunked after Open succeeds.
+func (f *Fid) Open(mode proto.Mode) (*File, error) {
+	return f.OpenContext(context.Background(), mode)
+}
+
+// OpenContext is Open, giving up when ctx is done.
+func (f *Fid) OpenContext(ctx context.Context, mode proto.Mode) (*File, error) {
+	of, err := f.own(ctx)
+	if err != nil {
+		return nil, err
+	}
+	open := proto.TOpen{
+		Header: proto.Header{proto.Topen, f.c.takeTag(of.fid)},
+		Fid:    of.fid,
+		Mode:   mode,
+	}
+	res, err := f.c.getResponseContext(ctx, &open)
+	if err == nil {
+		if rerror, ok := res.(*proto.RError); ok {
+			err = errors.New(rerror.Ename)
+		} else if _, ok := res.(*proto.ROpen); !ok {
+			err = errors.New("Unexpected response to TOpen.")
+		}
+	}
+	if err != nil {
+		if of != f {
+			of.Clunk()
+		}
+		return nil, err
+	}
+	ro := res.(*proto.ROpen)
+	f.c.cache.opened(of.path, ro.Qid)
+	if mode&proto.Otrunc != 0 {
+		f.c.cache.changed(of.path)
+	}
+	iounit := ro.Iounit
+	if iounit == 0 {
+		iounit = math.MaxUint32
+	}
+	of.fid = _NOFID
+	return f.c.newFile(open.Fid, iounit, of.path, mode&^proto.Otrunc, ro.Qid), nil
+}
+
+// Create creates the file name, with the 9P permissions perm, in the
+// directory f refers to, and opens it with mode. The returned File uses
+// the fid of f, which must not be used or clunked after Create succeeds.
+func (f *Fid) Create(name string, perm uint32, mode proto.Mode) (*File, error) {
+	return f.CreateContext(context.Background(), name, perm, mode)
+}
+
+// CreateContext is Create, giving up when ctx is done.
+func (f *Fid) CreateContext(ctx context.Context, name string, perm uint32, mode proto.Mode) (*File, error) {
+	of, err := f.own(ctx)
+	if err != nil {
+		return nil, err
+	}
+	create := proto.TCreate{
+		Header: proto.Header{proto.Tcreate, f.c.takeTag(of.fid)},
+		Fid:    of.fid,
+		Name:   name,
+		Perm:   perm,
+		Mode:   uint8(mode),
+	}
+	p := path.Join(of.path, name)
+	res, err := f.c.getResponseContext(ctx, &create)
+	f.c.cache.changed(p)
+	if err == nil {
+		if rerror, ok := res.(*proto.RError); ok {
+			err = errors.New(rerror.Ename)
+		} else if _, ok := res.(*proto.RCreate); !ok {
+			err = errors.New("Unexpected response to TCreate.")
+		}
+	}
+	if err != nil {
+		if of != f {
+			of.Clunk()
+		}
+		return nil, err
+	}
+	rc := res.(*proto.RCreate)
+	iounit := rc.Iounit
+	if iounit == 0 {
+		iounit = math.MaxUint32
+	}
+	of.fid = _NOFID
+	return f.c.newFile(create.Fid, iounit, p, mode&^proto.Otrunc, rc.Qid), nil
+}
+
+// Remove removes the file f refers to. f is clunked, even if Remove
+// fails.
+func (f *Fid) Remove() error {
+	return f.RemoveContext(context.Background())
+}
+
+// RemoveContext is Remove, giving up when ctx is done.
+func (f *Fid) RemoveContext(ctx context.Context) error {
+	of, err := f.own(ctx)
+	if err != nil {
+		return err
+	}
+	defer f.c.cache.invalidate(of.path)
+	remove := proto.TRemove{
+		Header: proto.Header{proto.Tremove, f.c.takeTag(of.fid)},
+		Fid:    of.fid,
+	}
+	of.fid = _NOFID
+	res, err := f.c.getResponseContext(ctx, &remove)
+	if err != nil {
+		// The Tremove was abandoned, and may not have been handled,
+		// so the fid is clunked before it is used again.
+		f.c.clunkFid(remove.Fid)
+		return err
+	}
+	// Tremove clunks the fid regardless of the response.
+	f.c.returnFid(remove.Fid)
+	if rerror, ok := res.(*proto.RError); ok {
+		return errors.New(rerror.Ename)
+	}
+	_, ok := res.(*proto.RRemove)
+	if !ok {
+		return errors.New("Unexpected response to TRemove.")
+	}
+	return nil
+}
+
+// Clunk releases f. Clunking the Root does nothing.
+func (f *Fid) Clunk() error {
+	if f.fid == f.c.rootFid {
+		return nil
+	}
+	if f.fid == _NOFID {
+		return errors.New("fid already clunked")
+	}
+	fid := f.fid
+	f.fid = _NOFID
+	return f.c.clunk(context.Background(), nil, fid)
+}
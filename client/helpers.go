@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file implements conveniences on top of the basic 9P operations of
+// Client, in the manner of package os.
+
+// cleanPath returns name as an absolute, clean path.
+func cleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// isNotExist reports whether err was returned because a file does not
+// exist.
+func isNotExist(err error) bool {
+	return proto.ErrnoFor(err.Error()) == proto.ENOENT
+}
+
+// Rename renames the file oldpath to newpath. 9P can only rename a file
+// within its directory, so both paths must have the same parent.
+func (c *Client) Rename(oldpath, newpath string) error {
+	oldpath, newpath = cleanPath(oldpath), cleanPath(newpath)
+	if path.Dir(oldpath) != path.Dir(newpath) {
+		return fmt.Errorf("cannot rename %s to %s: not in the same directory", oldpath, newpath)
+	}
+	stat := proto.NullStat()
+	stat.Name = path.Base(newpath)
+	return c.WStat(oldpath, &stat)
+}
+
+// Chmod changes the permissions of the file name to mode.Perm(). The
+// other mode bits of the file are left alone.
+func (c *Client) Chmod(name string, mode os.FileMode) error {
+	st, err := c.Stat(name)
+	if err != nil {
+		return err
+	}
+	stat := proto.NullStat()
+	stat.Mode = st.Mode&^uint32(os.ModePerm) | uint32(mode.Perm())
+	return c.WStat(name, &stat)
+}
+
+// Truncate changes the length of the file name to size.
+func (c *Client) Truncate(name string, size int64) error {
+	stat := proto.NullStat()
+	stat.Length = uint64(size)
+	return c.WStat(name, &stat)
+}
+
+// Chtimes changes the access and modification times of the file name. A
+// zero time is left unchanged. Many servers, including those of package
+// fs, do not allow the access time to be changed, and ignore it.
+func (c *Client) Chtimes(name string, atime, mtime time.Time) error {
+	stat := proto.NullStat()
+	if !atime.IsZero() {
+		stat.Atime = uint32(atime.Unix())
+	}
+	if !mtime.IsZero() {
+		stat.Mtime = uint32(mtime.Unix())
+	}
+	return c.WStat(name, &stat)
+}
+
+// Mkdir creates the directory name with the permissions perm.Perm().
+func (c *Client) Mkdir(name string, perm os.FileMode) error {
+	f, err := c.create(context.Background(), name, uint32(perm.Perm())|proto.DMDIR, proto.Oread)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// MkdirAll creates the directory name, along with any parents that do
+// not exist, with the permissions perm.Perm(). It does nothing if name
+// is already a directory.
+func (c *Client) MkdirAll(name string, perm os.FileMode) error {
+	name = cleanPath(name)
+	if st, err := c.Stat(name); err == nil {
+		if st.Mode&proto.DMDIR == 0 {
+			return fmt.Errorf("%s: Not a directory.", name)
+		}
+		return nil
+	}
+	if parent := path.Dir(name); parent != name {
+		if err := c.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := c.Mkdir(name, perm); err != nil {
+		// Someone else may have created it in the meantime.
+		if st, serr := c.Stat(name); serr == nil && st.Mode&proto.DMDIR != 0 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveAll removes the file name, and everything it contains if it is a
+// directory. It returns nil if name does not exist.
+func (c *Client) RemoveAll(name string) error {
+	name = cleanPath(name)
+	st, err := c.Stat(name)
+	if err != nil {
+		if isNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return c.removeAll(name, st)
+}
+
+func (c *Client) removeAll(name string, st *proto.Stat) error {
+	if st.Mode&proto.DMDIR != 0 {
+		// Removing entries while reading the directory could make the
+		// server skip some, so read them all first.
+		stats, err := c.Readdir(name)
+		if err != nil && !isNotExist(err) {
+			return err
+		}
+		for i := range stats {
+			if err := c.removeAll(path.Join(name, stats[i].Name), &stats[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.Remove(name); err != nil && !isNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// A DirReader reads the entries of a directory as they are needed, rather
+// than all at once. It is used like a bufio.Scanner:
+//
+//	d, err := c.OpenDir("/")
+//	if err != nil {
+//		return err
+//	}
+//	defer d.Close()
+//	for d.Next() {
+//		fmt.Println(d.Stat().Name)
+//	}
+//	return d.Err()
+type DirReader struct {
+	f     *File
+	buff  []byte
+	stats []proto.Stat
+	stat  *proto.Stat
+	err   error
+}
+
+// OpenDir opens the directory at path for reading.
+func (c *Client) OpenDir(path string) (*DirReader, error) {
+	f, err := c.Open(path, proto.Oread)
+	if err != nil {
+		return nil, err
+	}
+	return &DirReader{f: f, buff: make([]byte, c.msize)}, nil
+}
+
+// Next advances d to the next entry of the directory, which is then
+// available through Stat. It returns false at the end of the directory
+// or if there is an error, which is returned by Err.
+func (d *DirReader) Next() bool {
+	for len(d.stats) == 0 {
+		if d.err != nil {
+			return false
+		}
+		// Each read of a directory returns a whole number of entries.
+		n, err := d.f.Read(d.buff)
+		if err != nil {
+			if err != io.EOF {
+				d.err = err
+			}
+			return false
+		}
+		d.stats, d.err = proto.ParseStats(d.buff[:n])
+	}
+	d.stat = &d.stats[0]
+	d.stats = d.stats[1:]
+	return true
+}
+
+// Stat returns the entry read by the last call to Next.
+func (d *DirReader) Stat() *proto.Stat {
+	return d.stat
+}
+
+// Err returns the error that stopped Next, if it was not the end of the
+// directory.
+func (d *DirReader) Err() error {
+	return d.err
+}
+
+// Close closes the directory.
+func (d *DirReader) Close() error {
+	return d.f.Close()
+}
+
+// WalkFunc is the type of the function called by Walk for each file and
+// directory. It is used as a filepath.WalkDirFunc is: stat is the Stat of
+// path, and err reports a failure to stat root or read a directory. If
+// WalkFunc returns filepath.SkipDir for a directory, the directory is
+// skipped; for a file, the rest of the directory holding it is skipped.
+// Any other error stops the walk, and is returned by Walk.
+type WalkFunc func(path string, stat *proto.Stat, err error) error
+
+// Walk walks the file tree rooted at root, calling fn for each file and
+// directory in the tree, including root. The entries of each directory
+// are walked in lexical order.
+func (c *Client) Walk(root string, fn WalkFunc) error {
+	st, err := c.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = c.walk(root, st, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) walk(name string, st *proto.Stat, fn WalkFunc) error {
+	isDir := st.Mode&proto.DMDIR != 0
+	if err := fn(name, st, nil); err != nil || !isDir {
+		if err == filepath.SkipDir && isDir {
+			err = nil
+		}
+		return err
+	}
+	stats, err := c.Readdir(name)
+	if err != nil {
+		if err = fn(name, st, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	for i := range stats {
+		if err := c.walk(path.Join(name, stats[i].Name), &stats[i], fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
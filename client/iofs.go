@@ -0,0 +1,282 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file adapts a Client to the interfaces of package io/fs, so that
+// remote trees can be used with fs.WalkDir, http.FS, template.ParseFS and
+// the like.
+
+// FS is an fs.FS holding the files served to a Client. It implements
+// fs.ReadDirFS, fs.StatFS and fs.ReadFileFS. The names it is given are
+// relative to the root of the Client's attach.
+type FS struct {
+	c *Client
+}
+
+// NewFS returns an FS reading the files of c.
+func NewFS(c *Client) *FS {
+	return &FS{c: c}
+}
+
+// clientPath checks that name is a valid fs.FS path, and returns the
+// path of the same file for c.
+func clientPath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return cleanPath(name), nil
+}
+
+// pathError wraps err, an error returned for the file name, in an
+// fs.PathError. Errors the server reported for missing files or denied
+// permission are replaced with fs.ErrNotExist and fs.ErrPermission.
+func pathError(op, name string, err error) error {
+	switch proto.ErrnoFor(err.Error()) {
+	case proto.ENOENT:
+		err = fs.ErrNotExist
+	case proto.EACCES, proto.EPERM:
+		err = fs.ErrPermission
+	case proto.EEXIST:
+		err = fs.ErrExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open opens the file name for reading. If it is a directory, the
+// returned file implements fs.ReadDirFile.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	p, err := clientPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.c.Open(p, proto.Oread)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, pathError("open", name, err)
+	}
+	file := &ioFile{f: f, name: name, stat: st}
+	if st.Mode&proto.DMDIR != 0 {
+		return &ioDir{ioFile: file}, nil
+	}
+	return file, nil
+}
+
+// Stat returns the fs.FileInfo of the file name.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	p, err := clientPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	st, err := fsys.c.Stat(p)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return FileInfo(st), nil
+}
+
+// ReadDir reads the directory name, and returns its entries sorted by
+// name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := clientPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := fsys.c.Readdir(p)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, len(stats))
+	for i := range stats {
+		entries[i] = statInfo{&stats[i]}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ReadFile reads the whole of the file name.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	p, err := clientPath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.c.Open(p, proto.Oread)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	defer f.Close()
+	bs, err := io.ReadAll(f)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return bs, nil
+}
+
+// An ioFile is an fs.File reading an open File.
+type ioFile struct {
+	f      *File
+	name   string
+	stat   *proto.Stat
+	closed bool
+}
+
+func (f *ioFile) Stat() (fs.FileInfo, error) {
+	return FileInfo(f.stat), nil
+}
+
+func (f *ioFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := f.f.Read(p)
+	if err != nil && err != io.EOF {
+		err = pathError("read", f.name, err)
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes, unless it reaches the end of the file
+// first, as io.ReaderAt requires. A single File.ReadAt reads at most one
+// message.
+func (f *ioFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("negative offset")}
+	}
+	read := 0
+	for read < len(p) {
+		n, err := f.f.ReadAt(p[read:], off+int64(read))
+		read += n
+		if err == io.EOF {
+			return read, io.EOF
+		}
+		if err != nil {
+			return read, pathError("read", f.name, err)
+		}
+	}
+	return read, nil
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	off, err := f.f.Seek(offset, whence)
+	if err != nil {
+		err = pathError("seek", f.name, err)
+	}
+	return off, err
+}
+
+func (f *ioFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return f.f.Close()
+}
+
+// An ioDir is an fs.ReadDirFile reading an open directory.
+type ioDir struct {
+	*ioFile
+	d *DirReader
+}
+
+func (d *ioDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *ioDir) ReadAt(p []byte, off int64) (int, error) {
+	return d.Read(p)
+}
+
+// ReadDir returns the next n entries of the directory, as
+// fs.ReadDirFile describes.
+func (d *ioDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	if d.d == nil {
+		d.d = &DirReader{f: d.f, buff: make([]byte, d.f.client.msize)}
+	}
+	var entries []fs.DirEntry
+	for n <= 0 || len(entries) < n {
+		if !d.d.Next() {
+			break
+		}
+		entries = append(entries, statInfo{d.d.Stat()})
+	}
+	if err := d.d.Err(); err != nil {
+		return entries, pathError("readdir", d.name, err)
+	}
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+// FileInfo returns st as an fs.FileInfo, which is also an fs.DirEntry.
+// Its Sys method returns st.
+func FileInfo(st *proto.Stat) fs.FileInfo {
+	return statInfo{st}
+}
+
+// statInfo implements fs.FileInfo and fs.DirEntry for a proto.Stat.
+type statInfo struct {
+	st *proto.Stat
+}
+
+func (i statInfo) Name() string               { return i.st.Name }
+func (i statInfo) Size() int64                { return int64(i.st.Length) }
+func (i statInfo) Mode() fs.FileMode          { return FileMode(i.st.Mode) }
+func (i statInfo) ModTime() time.Time         { return time.Unix(int64(i.st.Mtime), 0) }
+func (i statInfo) IsDir() bool                { return i.st.Mode&proto.DMDIR != 0 }
+func (i statInfo) Sys() interface{}           { return i.st }
+func (i statInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i statInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// modeBits maps the mode bits of a proto.Stat to those of an
+// fs.FileMode.
+var modeBits = []struct {
+	dm   uint32
+	mode fs.FileMode
+}{
+	{proto.DMDIR, fs.ModeDir},
+	{proto.DMAPPEND, fs.ModeAppend},
+	{proto.DMEXCL, fs.ModeExclusive},
+	{proto.DMTMP, fs.ModeTemporary},
+	{proto.DMSYMLINK, fs.ModeSymlink},
+	{proto.DMDEVICE, fs.ModeDevice},
+	{proto.DMNAMEDPIPE, fs.ModeNamedPipe},
+	{proto.DMSOCKET, fs.ModeSocket},
+	{proto.DMSETUID, fs.ModeSetuid},
+	{proto.DMSETGID, fs.ModeSetgid},
+}
+
+// FileMode returns the fs.FileMode equivalent to mode, the Mode of a
+// proto.Stat.
+func FileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0777)
+	for _, b := range modeBits {
+		if mode&b.dm != 0 {
+			m |= b.mode
+		}
+	}
+	return m
+}
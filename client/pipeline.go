@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// This file implements the pipelined I/O of File. With a window larger
+// than 1 (see WithWindow), sequential reads keep that many Treads for the
+// data ahead of the offset in flight, and large writes are split into
+// that many Twrites at once, so that copying a file is not bound by the
+// latency of the connection.
+//
+// Pipelining assumes that the file holds data at offsets, as ordinary
+// files do. Files whose reads ignore the offset, like streams, should be
+// read by a client with a window of 1.
+
+// DefaultWindow is the window of a client unless WithWindow is used. A
+// window of 1 does not pipeline.
+const DefaultWindow = 1
+
+// WithWindow sets the number of Treads or Twrites a File keeps in flight
+// for sequential reads, large writes, and io.Copy.
+func WithWindow(n int) Option {
+	return func(c *Config) {
+		if n < 1 {
+			n = 1
+		}
+		c.window = n
+	}
+}
+
+// readSize is the most data a single Tread of f returns.
+func (f *File) readSize() int {
+	n := int(f.client.msize - 11)
+	if n > int(f.iounit) {
+		n = int(f.iounit)
+	}
+	return n
+}
+
+// writeSize is the most data a single Twrite of f carries.
+func (f *File) writeSize() int {
+	n := int(f.client.msize - 23)
+	if n > int(f.iounit) {
+		n = int(f.iounit)
+	}
+	return n
+}
+
+// A readAhead holds the Treads in flight for the data of a File from off
+// onwards.
+type readAhead struct {
+	off     uint64         // The offset of buf.
+	buf     []byte         // Data read, but not yet returned.
+	pending []*pendingRead // The reads after buf, in order.
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+type pendingRead struct {
+	off  uint64
+	buf  []byte
+	n    int
+	err  error
+	done chan struct{}
+}
+
+// next returns the offset after the data already read or requested.
+func (ra *readAhead) next() uint64 {
+	if len(ra.pending) == 0 {
+		return ra.off + uint64(len(ra.buf))
+	}
+	last := ra.pending[len(ra.pending)-1]
+	return last.off + uint64(len(last.buf))
+}
+
+// fill starts reads until window are in flight.
+func (ra *readAhead) fill(f *File, window int) {
+	for len(ra.pending) < window {
+		r := &pendingRead{
+			off:  ra.next(),
+			buf:  make([]byte, f.readSize()),
+			done: make(chan struct{}),
+		}
+		ctx := ra.ctx
+		go func() {
+			r.n, r.err = f.ReadAtContext(ctx, r.buf, int64(r.off))
+			close(r.done)
+		}()
+		ra.pending = append(ra.pending, r)
+	}
+}
+
+// dropReadAhead abandons the reads ahead of the offset of f.
+func (f *File) dropReadAhead() {
+	if f.ra != nil {
+		f.ra.cancel()
+		f.ra = nil
+	}
+}
+
+// readAhead reads p from the offset of f, keeping the client's window of
+// reads in flight after it.
+func (f *File) readAhead(ctx context.Context, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.ra != nil && f.ra.off != f.offset {
+		f.dropReadAhead()
+	}
+	if f.ra == nil {
+		rctx, cancel := context.WithCancel(context.Background())
+		f.ra = &readAhead{off: f.offset, ctx: rctx, cancel: cancel}
+	}
+	ra := f.ra
+	for len(ra.buf) == 0 {
+		ra.fill(f, f.client.window)
+		r := ra.pending[0]
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			// The read stays pending for the next call.
+			return 0, ctx.Err()
+		}
+		ra.pending = ra.pending[1:]
+		if r.err != nil {
+			f.dropReadAhead()
+			return 0, r.err
+		}
+		ra.buf = r.buf[:r.n]
+		if r.n < len(r.buf) {
+			// A short read leaves a gap before the reads after
+			// it, which are started again from the right offset.
+			ra.cancel()
+			ra.ctx, ra.cancel = context.WithCancel(context.Background())
+			ra.pending = nil
+		}
+	}
+	n := copy(p, ra.buf)
+	ra.buf = ra.buf[n:]
+	ra.off += uint64(n)
+	f.offset += uint64(n)
+	return n, nil
+}
+
+// pwrite writes p at off with the client's window of Twrites in flight.
+// The count returned is of the data written without a gap from off.
+func (f *File) pwrite(ctx context.Context, p []byte, off uint64) (int, error) {
+	size := f.writeSize()
+	type result struct {
+		n   int
+		err error
+	}
+	results := make([]result, (len(p)+size-1)/size)
+	sem := make(chan struct{}, f.client.window)
+	var wg sync.WaitGroup
+	var failed bool
+	var mu sync.Mutex
+	for i := range results {
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			results = results[:i]
+			break
+		}
+		b := p[i*size:]
+		if len(b) > size {
+			b = b[:size]
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, b []byte) {
+			defer wg.Done()
+			n, err := f.writeOnce(ctx, b, off+uint64(i*size))
+			if err == nil && n < len(b) {
+				err = io.ErrShortWrite
+			}
+			results[i] = result{n, err}
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+			<-sem
+		}(i, b)
+	}
+	wg.Wait()
+	wrote := 0
+	for _, r := range results {
+		wrote += r.n
+		if r.err != nil {
+			return wrote, r.err
+		}
+	}
+	return wrote, nil
+}
+
+// WriteTo writes the data of f from its offset to w, until the end of the
+// file. It is used by io.Copy, and keeps the client's window of Treads in
+// flight.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, f.readSize())
+	var total int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			total += int64(m)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// ReadFrom writes the data of r to f at its offset, until r returns
+// io.EOF. It is used by io.Copy. The data of each read of r is written
+// as soon as it returns, with the client's window of Twrites in flight
+// for reads larger than the iounit of f.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, f.writeSize()*f.client.window)
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			m, werr := f.Write(buf[:n])
+			total += int64(m)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
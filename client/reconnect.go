@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/knusbaum/go9p"
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file implements reconnecting a Client whose connection to the
+// server was lost.
+//
+// The calls in progress when the connection is lost fail with a
+// *ConnError, since it cannot be known whether the server carried them
+// out. Calls made while the client reconnects wait for it. Once the
+// client has dialed again and attached, it walks the fids it caches for
+// paths again, and reopens its open Files, reusing their fid numbers so
+// that the Files remain valid. A File is only reopened if it is the same
+// file, with the same Qid, and it is not truncated again. Files that
+// cannot be reopened fail with the reason.
+
+// Reconnection is tried reconnectAttempts times, waiting reconnectDelay
+// at first, and twice as long after each failure, up to
+// maxReconnectDelay.
+const (
+	reconnectAttempts = 10
+	reconnectDelay    = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+// WithReconnect makes the client reconnect when the connection to the
+// server is lost, using dial to connect again. If dial is nil, Dial and
+// DialTLS reconnect to the same address, and NewClient fails.
+func WithReconnect(dial func() (io.ReadWriteCloser, error)) Option {
+	return func(c *Config) {
+		c.reconnect = true
+		if dial != nil {
+			c.dial = dial
+		}
+	}
+}
+
+// withDefaultDial sets the function WithReconnect uses when it is not
+// given one.
+func withDefaultDial(dial func() (io.ReadWriteCloser, error)) Option {
+	return func(c *Config) {
+		if c.dial == nil {
+			c.dial = dial
+		}
+	}
+}
+
+// reconnect replaces the lost connection of c. Once it is done, c either
+// has a new session, or is finished.
+func (c *Client) reconnect() {
+	delay := reconnectDelay
+	var err error
+	for i := 0; i < reconnectAttempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+		c.Lock()
+		closed := c.closed
+		c.Unlock()
+		if closed {
+			err = ErrClientClosed
+			break
+		}
+		var rwc io.ReadWriteCloser
+		if rwc, err = c.redial(); err != nil {
+			continue
+		}
+		s := newSession(rwc)
+		c.trace(&go9p.Event{Kind: go9p.EventConnect, User: c.user})
+		go c.worker(s, c.msize)
+		if err = c.attach(s, c.msize, c.dialect); err != nil {
+			rwc.Close()
+			continue
+		}
+		// The files may have changed while c was disconnected.
+		c.cache.reset()
+		c.restore(s)
+		c.Lock()
+		if c.closed {
+			c.Unlock()
+			rwc.Close()
+			err = ErrClientClosed
+			break
+		}
+		c.sess = s
+		c.reconnecting = false
+		close(c.ready)
+		c.Unlock()
+		return
+	}
+	c.Lock()
+	if err != ErrClientClosed {
+		err = &ConnError{err}
+	}
+	c.finish(err)
+	c.Unlock()
+}
+
+// restore reestablishes the cached and open fids of c on s.
+func (c *Client) restore(s *session) {
+	ctx := context.Background()
+	c.pathCacheLock.Lock()
+	for p, fid := range c.pathCache {
+		if err := c.walkTo(ctx, s, p, fid.fid); err != nil {
+			delete(c.pathCache, p)
+			c.lockedRelease(fid)
+			continue
+		}
+		c.cache.walkedFid(p)
+	}
+	c.pathCacheLock.Unlock()
+
+	c.Lock()
+	files := make([]*File, 0, len(c.files))
+	for _, f := range c.files {
+		files = append(files, f)
+	}
+	c.Unlock()
+	for _, f := range files {
+		if err := c.reopen(ctx, s, f); err != nil {
+			c.Lock()
+			c.lostFids[f.fid] = fmt.Errorf("%s: could not reopen after reconnecting: %v", f.path, err)
+			c.Unlock()
+		}
+	}
+}
+
+// reopen opens f again on s, with the fid it had.
+func (c *Client) reopen(ctx context.Context, s *session, f *File) error {
+	// If reopening fails, the fid stays with f, and is clunked when f
+	// is closed.
+	if err := c.walkTo(ctx, s, f.path, f.fid); err != nil {
+		return err
+	}
+	open := proto.TOpen{
+		Header: proto.Header{proto.Topen, c.takeTag(f.fid)},
+		Fid:    f.fid,
+		Mode:   f.mode,
+	}
+	res, err := c.rpc(ctx, s, &open)
+	if err != nil {
+		return err
+	}
+	if rerror, ok := res.(*proto.RError); ok {
+		return errors.New(rerror.Ename)
+	}
+	ro, ok := res.(*proto.ROpen)
+	if !ok {
+		return errors.New("Unexpected response to TOpen.")
+	}
+	iounit := ro.Iounit
+	if iounit == 0 {
+		iounit = math.MaxUint32
+	}
+	if ro.Qid.Uid != f.qid.Uid || ro.Qid.Qtype != f.qid.Qtype {
+		return errors.New("file was replaced")
+	}
+	if iounit < f.iounit {
+		return errors.New("iounit changed")
+	}
+	return nil
+}
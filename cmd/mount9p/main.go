@@ -9,12 +9,10 @@ import (
 	"hash/crc64"
 	"io"
 	"log"
-	"math"
 	"os"
 	"os/user"
 	"path"
 	"strconv"
-	"sync"
 	"syscall"
 	"time"
 
@@ -33,12 +31,8 @@ var crc64Table = crc64.MakeTable(0xC96C5795D7870F42)
 //var DefaultTTL = 10 * time.Second
 //var ncTTL = uint64(10)
 
-var CacheTTL = 0 * time.Second
 var ncTTL = uint64(0)
 
-var dirCacheLock sync.RWMutex
-var dirCache map[string]*Dir = make(map[string]*Dir)
-
 var unknownUID uint32
 var unknownGID uint32
 var authUser string
@@ -58,28 +52,10 @@ func gidForGroup(gid string) uint32 {
 	return unknownGID
 }
 
-func dirGet(path string) *Dir {
-	dirCacheLock.RLock()
-	defer dirCacheLock.RUnlock()
-	return dirCache[path]
-}
-
-func dirPut(path string, d *Dir) {
-	dirCacheLock.Lock()
-	defer dirCacheLock.Unlock()
-	dirCache[path] = d
-}
-
 type Dir struct {
 	fs.Inode
 	client *client.Client
 	path   string
-
-	statCache *proto.Stat
-	statTTL   time.Time
-
-	dirCache []proto.Stat
-	dirTTL   time.Time
 }
 
 type StatDir struct {
@@ -115,26 +91,11 @@ func (r *Dir) Rename(ctx context.Context, name string, newParent fs.InodeEmbedde
 		//log.Printf("Cannot move from one place to another. (%s -> %s)", r.path, newD.path)
 		return syscall.EINVAL
 	}
-	stat := proto.Stat{
-		Type:   math.MaxUint16,
-		Dev:    math.MaxUint32,
-		Qid:    proto.Qid{Qtype: math.MaxUint8, Vers: math.MaxUint32, Uid: math.MaxUint64},
-		Mode:   math.MaxUint32,
-		Atime:  math.MaxUint32,
-		Mtime:  math.MaxUint32,
-		Length: math.MaxUint64,
-		Name:   newName,
-		Uid:    "",
-		Gid:    "",
-		Muid:   "",
-	}
-	err := r.client.WStat(path.Join(r.path, name), &stat)
+	err := r.client.Rename(path.Join(r.path, name), path.Join(r.path, newName))
 	if err != nil {
 		log.Printf("WSTAT RETURNED ERROR: %s\n", err)
 		return syscall.ENOENT
 	}
-	r.dirTTL = time.Time{}
-	r.statTTL = time.Time{}
 	return 0
 }
 
@@ -145,8 +106,6 @@ func (r *Dir) Unlink(ctx context.Context, name string) syscall.Errno {
 		//log.Printf("Unlink failed: %s\n", err)
 		return syscall.EINVAL
 	}
-	r.dirTTL = time.Time{}
-	r.statTTL = time.Time{}
 	return 0
 }
 
@@ -157,8 +116,6 @@ func (r *Dir) Rmdir(ctx context.Context, name string) syscall.Errno {
 		//log.Printf("Unlink failed: %s\n", err)
 		return syscall.EINVAL
 	}
-	r.dirTTL = time.Time{}
-	r.statTTL = time.Time{}
 	return 0
 }
 
@@ -166,7 +123,7 @@ func (r *Dir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.Ent
 	//log.Printf("(*Dir).Mkdir(%s)", r.path)
 	fullPath := path.Join(r.path, name)
 	//log.Printf("Mkdir(%s)", fullPath)
-	file, err := r.client.Create(fullPath, os.FileMode(mode|proto.DMDIR))
+	err := r.client.Mkdir(fullPath, os.FileMode(mode))
 	if err != nil {
 		if err.Error() == "Permission denied." {
 			return nil, syscall.EACCES
@@ -174,88 +131,33 @@ func (r *Dir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.Ent
 		//log.Printf("Error creating [%s]: %s", r.path, err)
 		return nil, syscall.EINVAL
 	}
-	defer file.Close()
-	r.dirTTL = time.Time{}
-	r.statTTL = time.Time{}
-	r.dirCache = append(r.dirCache, proto.Stat{
-		Type:   0,
-		Dev:    0,
-		Qid:    proto.Qid{Qtype: math.MaxUint8, Vers: math.MaxUint32, Uid: math.MaxUint64},
-		Mode:   mode | proto.DMDIR,
-		Atime:  0,
-		Mtime:  0,
-		Length: 0,
-		Name:   name,
-		Uid:    "",
-		Gid:    "",
-		Muid:   "",
-	})
 	dir := &Dir{client: r.client, path: fullPath}
-	dirPut(fullPath, dir)
 	return r.NewInode(ctx, dir, fs.StableAttr{Mode: fuse.S_IFDIR, Ino: crc64.Checksum([]byte(fullPath), crc64Table)}), 0
 }
 
-func (r *Dir) oldGetattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	//log.Printf("(*Dir).oldGetattr(%s)", r.path)
-	if r.statCache == nil || time.Now().After(r.statTTL) {
-		//log.Printf("oldGetattr(%s)", r.path)
-		stat, err := r.client.Stat(r.path)
-		if err != nil {
-			log.Printf("STAT RETURNED ERROR: %s\n", err)
-			return syscall.ENOENT
-		}
-		r.statCache = stat
-		r.statTTL = time.Now().Add(CacheTTL)
+func (r *Dir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	//log.Printf("(*Dir).Getattr(%s)", r.path)
+	// The client caches the Stats of the files of the directories it
+	// lists, so this is usually answered without asking the server.
+	stat, err := r.client.Stat(r.path)
+	if err != nil {
+		log.Printf("STAT RETURNED ERROR: %s\n", err)
+		return syscall.ENOENT
 	}
 	out.AttrValid = ncTTL
 	out.Nlink = 1
-	out.Ino = r.statCache.Qid.Uid
-	out.Mode = r.statCache.Mode
-	out.Size = r.statCache.Length
-	out.Mtime = uint64(r.statCache.Mtime)
-	out.Uid = uidForUser(r.statCache.Uid)
-	out.Gid = gidForGroup(r.statCache.Gid)
+	out.Ino = stat.Qid.Uid
+	out.Mode = stat.Mode
+	out.Size = stat.Length
+	out.Mtime = uint64(stat.Mtime)
+	out.Uid = uidForUser(stat.Uid)
+	out.Gid = gidForGroup(stat.Gid)
 	return 0
 }
 
-func (r *Dir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	//log.Printf("(*Dir).Getattr(%s)", r.path)
-	if dir := dirGet(path.Dir(r.path)); dir != nil {
-		_, errno := dir.Readdir(ctx)
-		if errno > 0 {
-			return errno
-		}
-		base := path.Base(r.path)
-		for _, stat := range dir.dirCache {
-			if stat.Name == base {
-				out.AttrValid = ncTTL
-				out.Nlink = 1
-				out.Ino = stat.Qid.Uid
-				out.Mode = stat.Mode
-				out.Size = stat.Length
-				out.Mtime = uint64(stat.Mtime)
-				return 0
-			}
-		}
-	}
-	return r.oldGetattr(ctx, f, out)
-}
-
 func (r *Dir) Setattr(ctx context.Context, h fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
 	//log.Printf("(*Dir).SetAttr(%s)", r.path)
-	stat := proto.Stat{
-		Type:   math.MaxUint16,
-		Dev:    math.MaxUint32,
-		Qid:    proto.Qid{Qtype: math.MaxUint8, Vers: math.MaxUint32, Uid: math.MaxUint64},
-		Mode:   math.MaxUint32,
-		Atime:  math.MaxUint32,
-		Mtime:  math.MaxUint32,
-		Length: math.MaxUint64,
-		Name:   "",
-		Uid:    "",
-		Gid:    "",
-		Muid:   "",
-	}
+	stat := proto.NullStat()
 	send := false
 	if newMode, ok := in.GetMode(); ok {
 		stat.Mode = newMode
@@ -275,10 +177,6 @@ func (r *Dir) Setattr(ctx context.Context, h fs.FileHandle, in *fuse.SetAttrIn,
 	out.Mode = stat.Mode
 	out.Size = stat.Length
 	out.Mtime = uint64(stat.Mtime)
-	if dir := dirGet(path.Dir(r.path)); dir != nil {
-		dir.dirTTL = time.Time{}
-		dir.statTTL = time.Time{}
-	}
 	out.Uid = uidForUser(stat.Uid)
 	out.Gid = gidForGroup(stat.Gid)
 	return 0
@@ -294,21 +192,6 @@ func (r *Dir) Create(ctx context.Context, name string, flags uint32, mode uint32
 		//log.Printf("Error creating [%s]: %s", r.path, err)
 		return nil, nil, 0, syscall.EINVAL
 	}
-	r.dirTTL = time.Time{}
-	r.statTTL = time.Time{}
-	r.dirCache = append(r.dirCache, proto.Stat{
-		Type:   0,
-		Dev:    0,
-		Qid:    proto.Qid{Qtype: math.MaxUint8, Vers: math.MaxUint32, Uid: math.MaxUint64},
-		Mode:   mode,
-		Atime:  0,
-		Mtime:  0,
-		Length: 0,
-		Name:   name,
-		Uid:    "",
-		Gid:    "",
-		Muid:   "",
-	})
 	fullPath := path.Join(r.path, name)
 	fileNode := &FileNode{client: r.client, path: fullPath}
 	return r.NewInode(ctx, fileNode, fs.StableAttr{Ino: crc64.Checksum([]byte(fullPath), crc64Table)}), &File{file, fileNode}, fuse.FOPEN_DIRECT_IO, 0
@@ -316,16 +199,11 @@ func (r *Dir) Create(ctx context.Context, name string, flags uint32, mode uint32
 
 func (r *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
 	//log.Printf("(*Dir).Lookup(%s): %s", r.path, name)
-	if r.dirCache == nil || time.Now().After(r.dirTTL) {
-		//log.Printf("LOOKUP READDIR(%s)\n", r.path)
-		stats, err := r.client.Readdir(r.path)
-		if err != nil {
-			return nil, syscall.EPIPE
-		}
-		r.dirCache = stats
-		r.dirTTL = time.Now().Add(CacheTTL)
+	stats, err := r.client.Readdir(r.path)
+	if err != nil {
+		return nil, syscall.EPIPE
 	}
-	for _, stat := range r.dirCache {
+	for _, stat := range stats {
 		if stat.Name == name {
 			out.EntryValid = ncTTL
 			out.AttrValid = ncTTL
@@ -338,11 +216,7 @@ func (r *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.
 			out.Gid = gidForGroup(stat.Gid)
 			fullPath := path.Join(r.path, name)
 			if stat.Mode&proto.DMDIR > 0 {
-				if dir := dirGet(fullPath); dir != nil {
-					return r.NewInode(ctx, dir, fs.StableAttr{Mode: fuse.S_IFDIR, Ino: crc64.Checksum([]byte(fullPath), crc64Table)}), 0
-				}
 				dir := &Dir{client: r.client, path: fullPath}
-				dirPut(fullPath, dir)
 				return r.NewInode(ctx, dir, fs.StableAttr{Mode: fuse.S_IFDIR, Ino: crc64.Checksum([]byte(fullPath), crc64Table)}), 0
 			}
 			return r.NewInode(ctx, &FileNode{client: r.client, path: fullPath}, fs.StableAttr{Ino: crc64.Checksum([]byte(fullPath), crc64Table)}), 0
@@ -353,17 +227,12 @@ func (r *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.
 
 func (r *Dir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 	//log.Printf("(*Dir).Readdir(%s)", r.path)
-	if r.dirCache == nil || time.Now().After(r.dirTTL) {
-		//log.Printf("ACTUAL READDIR(%s)\n", r.path)
-		stats, err := r.client.Readdir(r.path)
-		if err != nil {
-			return nil, syscall.EPIPE
-		}
-		r.dirCache = stats
-		r.dirTTL = time.Now().Add(CacheTTL)
+	stats, err := r.client.Readdir(r.path)
+	if err != nil {
+		return nil, syscall.EPIPE
 	}
 	entries := make([]fuse.DirEntry, 0)
-	for _, stat := range r.dirCache {
+	for _, stat := range stats {
 		var mode uint32 = 0
 		if stat.Mode&proto.DMDIR > 0 {
 			mode = fuse.S_IFDIR
@@ -447,8 +316,8 @@ func (f *FileNode) Open(ctx context.Context, flags uint32) (fh fs.FileHandle, fu
 	//return &File{file, f}, fuse.FOPEN_KEEP_CACHE, 0
 }
 
-func (f *FileNode) oldGetattr(ctx context.Context, h fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	//log.Printf("FileNode.oldGetattr(%s)", f.path)
+func (f *FileNode) Getattr(ctx context.Context, h fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	//log.Printf("(*FileNode).Getattr(%s)", f.path)
 	stat, err := f.client.Stat(f.path)
 	if err != nil {
 		log.Printf("STAT RETURNED ERROR: %s\n", err)
@@ -465,46 +334,9 @@ func (f *FileNode) oldGetattr(ctx context.Context, h fs.FileHandle, out *fuse.At
 	return 0
 }
 
-func (f *FileNode) Getattr(ctx context.Context, h fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	//log.Printf("(*FileNode).Getattr(%s)", f.path)
-	if dir := dirGet(path.Dir(f.path)); dir != nil {
-		_, errno := dir.Readdir(ctx)
-		if errno > 0 {
-			return errno
-		}
-		base := path.Base(f.path)
-		for _, stat := range dir.dirCache {
-			if stat.Name == base {
-				out.AttrValid = ncTTL
-				out.Nlink = 1
-				out.Ino = stat.Qid.Uid
-				out.Mode = stat.Mode
-				out.Size = stat.Length
-				out.Mtime = uint64(stat.Mtime)
-				out.Uid = uidForUser(stat.Uid)
-				out.Gid = gidForGroup(stat.Gid)
-				return 0
-			}
-		}
-	}
-	return f.oldGetattr(ctx, h, out)
-}
-
 func (f *FileNode) Setattr(ctx context.Context, h fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
 	//log.Printf("(*FileNode).SetAttr(%s)", f.path)
-	stat := proto.Stat{
-		Type:   math.MaxUint16,
-		Dev:    math.MaxUint32,
-		Qid:    proto.Qid{Qtype: math.MaxUint8, Vers: math.MaxUint32, Uid: math.MaxUint64},
-		Mode:   math.MaxUint32,
-		Atime:  math.MaxUint32,
-		Mtime:  math.MaxUint32,
-		Length: math.MaxUint64,
-		Name:   "",
-		Uid:    "",
-		Gid:    "",
-		Muid:   "",
-	}
+	stat := proto.NullStat()
 	send := false
 	if newMode, ok := in.GetMode(); ok {
 		stat.Mode = newMode
@@ -525,10 +357,6 @@ func (f *FileNode) Setattr(ctx context.Context, h fs.FileHandle, in *fuse.SetAtt
 	out.Mode = stat.Mode
 	out.Size = stat.Length
 	out.Mtime = uint64(stat.Mtime)
-	if dir := dirGet(path.Dir(f.path)); dir != nil {
-		dir.dirTTL = time.Time{}
-		dir.statTTL = time.Time{}
-	}
 	out.Uid = uidForUser(stat.Uid)
 	out.Gid = gidForGroup(stat.Gid)
 	return 0
@@ -578,10 +406,6 @@ func (f *File) Setattr(ctx context.Context, in *fuse.SetAttrIn, out *fuse.AttrOu
 	out.Mode = stat.Mode
 	out.Size = stat.Length
 	out.Mtime = uint64(stat.Mtime)
-	if dir := dirGet(path.Dir(f.node.path)); dir != nil {
-		dir.dirTTL = time.Time{}
-		dir.statTTL = time.Time{}
-	}
 	out.Uid = uidForUser(stat.Uid)
 	out.Gid = gidForGroup(stat.Gid)
 	return 0
@@ -594,10 +418,6 @@ func (f *File) Write(ctx context.Context, data []byte, off int64) (uint32, sysca
 		//log.Printf("Error writing file: %s", err)
 		return uint32(n), syscall.EINVAL
 	}
-	if dir := dirGet(path.Dir(f.node.path)); dir != nil {
-		dir.dirTTL = time.Time{}
-		dir.statTTL = time.Time{}
-	}
 	return uint32(n), 0
 }
 
@@ -652,6 +472,7 @@ func main() {
 	other := flag.Bool("other", false, "Enable the allow_other mount flag (See: mount.fuse(8))")
 	usetls := flag.Bool("tls", false, "Use TLS to encrypt communication with the server.")
 	certfile := flag.String("certfile", "", "If provided, use the certificate to authenticate to the server. Implies -tls")
+	reconnect := flag.Bool("reconnect", false, "Reconnect to the server if the connection is lost. Not available with -s.")
 	cachetime := flag.String("cachetime", "10s", "If provided, this is the amount of time various things (directory contents, file stats, etc) are cached before being recalculated. Must be in the format that time.ParseDuration accepts.")
 
 	flag.Parse()
@@ -665,13 +486,18 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to parse cache time: %v\n", err)
 	}
-	CacheTTL = t
 	ncTTL = uint64(t / time.Second)
 
 	var clientOpts []client.Option
+	if t > 0 {
+		clientOpts = append(clientOpts, client.WithCache(t))
+	}
 	if *auth {
 		clientOpts = append(clientOpts, client.WithAuth(client.Plan9Auth))
 	}
+	if *reconnect && !*stdio {
+		clientOpts = append(clientOpts, client.WithReconnect(nil))
+	}
 
 	//var network, addr string
 	var c *client.Client
@@ -724,7 +550,14 @@ func main() {
 				ca = eca
 			}
 			log.Printf("Mapping authenticated user %s to system user %s", authUser, u.Username)
-			c, err = client.DialTLS(network, addr, *username, *aname, crt, ca)
+			var tlsOpts []client.Option
+			if t > 0 {
+				tlsOpts = append(tlsOpts, client.WithCache(t))
+			}
+			if *reconnect {
+				tlsOpts = append(tlsOpts, client.WithReconnect(nil))
+			}
+			c, err = client.DialTLS(network, addr, *username, *aname, crt, ca, tlsOpts...)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -752,5 +585,16 @@ func main() {
 	if err != nil {
 		log.Fatalf("Mount fail: %v\n", err)
 	}
+	go func() {
+		<-c.Done()
+		if c.Err() == client.ErrClientClosed {
+			return
+		}
+		log.Printf("Lost connection to the server: %v", c.Err())
+		if err := server.Unmount(); err != nil {
+			log.Printf("Failed to unmount %s: %v", mountpoint, err)
+		}
+	}()
 	server.Wait()
+	c.Close()
 }
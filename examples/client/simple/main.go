@@ -20,6 +20,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer c.Close()
 	f, err := c.Open("/dynamic", proto.Oread)
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,349 @@
+package fs
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/knusbaum/go9p"
+	"github.com/knusbaum/go9p/proto"
+)
+
+// This file implements go9p.LSrv for server. Where possible, 9P2000.L
+// requests are translated into their 9p2000 equivalents, so that the
+// permission checks and FS callbacks are shared between the dialects.
+
+const (
+	sIFDIR = 0040000
+	sIFREG = 0100000
+
+	// v9fs magic number, reported by Statfs.
+	v9fsMagic = 0x01021997
+)
+
+func lerror(tag uint16, ecode uint32) proto.FCall {
+	return &proto.RLerror{proto.Header{proto.Rlerror, tag}, ecode}
+}
+
+// lopenMode converts Linux open flags to a 9p2000 open mode.
+func lopenMode(flags uint32) proto.Mode {
+	var mode proto.Mode
+	switch flags & proto.LOaccmode {
+	case proto.LOrdonly:
+		mode = proto.Oread
+	case proto.LOwronly:
+		mode = proto.Owrite
+	case proto.LOrdwr:
+		mode = proto.Ordwr
+	}
+	if flags&proto.LOtrunc != 0 {
+		mode |= proto.Otrunc
+	}
+	return mode
+}
+
+func (s *server) Statfs(gc go9p.Conn, t *proto.TStatfs) (proto.FCall, error) {
+	c := gc.(*conn)
+	if _, ok := c.fids.Load(t.Fid); !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	return &proto.RStatfs{
+		Header:  proto.Header{proto.Rstatfs, t.Tag},
+		FSType:  v9fsMagic,
+		Bsize:   proto.IOUnit,
+		Namelen: 255,
+	}, nil
+}
+
+func (s *server) Lopen(gc go9p.Conn, t *proto.TLopen) (proto.FCall, error) {
+	resp, err := s.Open(gc, &proto.TOpen{proto.Header{proto.Topen, t.Tag}, t.Fid, lopenMode(t.Flags)})
+	if r, ok := resp.(*proto.ROpen); ok {
+		return &proto.RLopen{proto.Header{proto.Rlopen, t.Tag}, r.Qid, r.Iounit}, err
+	}
+	return resp, err
+}
+
+func (s *server) Lcreate(gc go9p.Conn, t *proto.TLcreate) (proto.FCall, error) {
+	resp, err := s.Create(gc, &proto.TCreate{proto.Header{proto.Tcreate, t.Tag}, t.Fid, t.Name, t.Mode & 0777, uint8(lopenMode(t.Flags)), ""})
+	if r, ok := resp.(*proto.RCreate); ok {
+		return &proto.RLcreate{proto.Header{proto.Rlcreate, t.Tag}, r.Qid, r.Iounit}, err
+	}
+	return resp, err
+}
+
+func (s *server) Symlink(gc go9p.Conn, t *proto.TSymlink) (proto.FCall, error) {
+	return lerror(t.Tag, proto.EOPNOTSUPP), nil
+}
+
+func (s *server) Mknod(gc go9p.Conn, t *proto.TMknod) (proto.FCall, error) {
+	return lerror(t.Tag, proto.EOPNOTSUPP), nil
+}
+
+func (s *server) Readlink(gc go9p.Conn, t *proto.TReadlink) (proto.FCall, error) {
+	return lerror(t.Tag, proto.EOPNOTSUPP), nil
+}
+
+func (s *server) Link(gc go9p.Conn, t *proto.TLink) (proto.FCall, error) {
+	return lerror(t.Tag, proto.EOPNOTSUPP), nil
+}
+
+func (s *server) Xattrwalk(gc go9p.Conn, t *proto.TXattrwalk) (proto.FCall, error) {
+	return lerror(t.Tag, proto.ENODATA), nil
+}
+
+func (s *server) Xattrcreate(gc go9p.Conn, t *proto.TXattrcreate) (proto.FCall, error) {
+	return lerror(t.Tag, proto.EOPNOTSUPP), nil
+}
+
+func (s *server) Getattr(gc go9p.Conn, t *proto.TGetattr) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Fid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	info := i.(*fidInfo)
+	st := info.n.Stat()
+
+	mode := st.Mode & 0777
+	if st.Mode&proto.DMDIR != 0 {
+		mode |= sIFDIR
+	} else {
+		mode |= sIFREG
+	}
+	return &proto.RGetattr{
+		Header:      proto.Header{proto.Rgetattr, t.Tag},
+		Valid:       proto.GetattrBasic,
+		Qid:         st.Qid,
+		Mode:        mode,
+		Uid:         c.numericID(info.uname, st.Uid),
+		Gid:         c.numericID(info.uname, st.Gid),
+		Nlink:       1,
+		Size:        st.Length,
+		Blksize:     proto.IOUnit,
+		Blocks:      (st.Length + 511) / 512,
+		AtimeSec:    uint64(st.Atime),
+		MtimeSec:    uint64(st.Mtime),
+		CtimeSec:    uint64(st.Mtime),
+		DataVersion: uint64(st.Qid.Vers),
+	}, nil
+}
+
+func (s *server) Setattr(gc go9p.Conn, t *proto.TSetattr) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Fid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	info := i.(*fidInfo)
+
+	if t.Valid&proto.SetattrUid != 0 {
+		return lerror(t.Tag, proto.EPERM), nil
+	}
+	newstat := proto.NullStat()
+	if t.Valid&proto.SetattrMode != 0 {
+		newstat.Mode = t.Mode & 0777
+	}
+	if t.Valid&proto.SetattrGid != 0 {
+		newstat.Gid = strconv.FormatUint(uint64(t.Gid), 10)
+	}
+	if t.Valid&proto.SetattrSize != 0 {
+		newstat.Length = t.Size
+	}
+	if t.Valid&proto.SetattrMtime != 0 {
+		if t.Valid&proto.SetattrMtimeSet != 0 {
+			newstat.Mtime = uint32(t.MtimeSec)
+		} else {
+			newstat.Mtime = uint32(time.Now().Unix())
+		}
+	}
+	if err := s.wstat(info, &newstat); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
+	}
+	return &proto.RSetattr{proto.Header{proto.Rsetattr, t.Tag}}, nil
+}
+
+func (s *server) Readdir(gc go9p.Conn, t *proto.TReaddir) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Fid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	info := i.(*fidInfo)
+	children, ok := info.extra.([]FSNode)
+	if !ok || info.openMode == proto.None {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	if t.Count > c.msize-11 {
+		t.Count = c.msize - 11
+	}
+
+	// Offsets are indexes into the snapshot of children taken at open.
+	contents := make([]byte, 0)
+	for i := t.Offset; i < uint64(len(children)); i++ {
+		st := children[i].Stat()
+		ent := proto.Dirent{Qid: st.Qid, Offset: i + 1, Type: proto.DTReg, Name: st.Name}
+		if st.Mode&proto.DMDIR != 0 {
+			ent.Type = proto.DTDir
+		}
+		if uint32(len(contents))+ent.ComposeLength() > t.Count {
+			break
+		}
+		contents = ent.AppendCompose(contents)
+	}
+	return &proto.RReaddir{proto.Header{proto.Rreaddir, t.Tag}, uint32(len(contents)), contents}, nil
+}
+
+func (s *server) Fsync(gc go9p.Conn, t *proto.TFsync) (proto.FCall, error) {
+	c := gc.(*conn)
+	if _, ok := c.fids.Load(t.Fid); !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	return &proto.RFsync{proto.Header{proto.Rfsync, t.Tag}}, nil
+}
+
+func (s *server) Lock(gc go9p.Conn, t *proto.TLock) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Fid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	info := i.(*fidInfo)
+	status := s.locks.lock(info.n.Stat().Qid.Uid, &byteLock{
+		lockType: t.LockType,
+		start:    t.Start,
+		length:   t.Length,
+		procID:   t.ProcID,
+		clientID: t.ClientID,
+		fid:      c.toConnFid(t.Fid),
+	})
+	return &proto.RLock{proto.Header{proto.Rlock, t.Tag}, status}, nil
+}
+
+func (s *server) Getlock(gc go9p.Conn, t *proto.TGetlock) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Fid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	info := i.(*fidInfo)
+	l := &byteLock{
+		lockType: t.LockType,
+		start:    t.Start,
+		length:   t.Length,
+		procID:   t.ProcID,
+		clientID: t.ClientID,
+	}
+	if h := s.locks.conflicting(info.n.Stat().Qid.Uid, l); h != nil {
+		l = h
+	} else {
+		l.lockType = proto.LockTypeUnlck
+	}
+	return &proto.RGetlock{proto.Header{proto.Rgetlock, t.Tag}, l.lockType, l.start, l.length, l.procID, l.clientID}, nil
+}
+
+func (s *server) Mkdir(gc go9p.Conn, t *proto.TMkdir) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Dfid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	info := i.(*fidInfo)
+	dir, ok := info.n.(Dir)
+	if !ok {
+		return lerror(t.Tag, proto.ENOTDIR), nil
+	}
+	if !s.fs.ignorePerms && !openPermission(s.fs.userDB(), info.n, info.uname, proto.Owrite) {
+		return lerror(t.Tag, proto.EACCES), nil
+	}
+	if s.fs.CreateDir == nil {
+		return lerror(t.Tag, proto.EOPNOTSUPP), nil
+	}
+	new, err := s.fs.CreateDir(s.fs, dir, info.uname, t.Name, (t.Mode&0777)|proto.DMDIR, uint8(proto.Oread))
+	if err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
+	}
+	return &proto.RMkdir{proto.Header{proto.Rmkdir, t.Tag}, new.Stat().Qid}, nil
+}
+
+// child looks up name in the directory referred to by fid, returning
+// a fidInfo for it, or the error number to report.
+func (c *conn) child(fid uint32, name string) (*fidInfo, uint32) {
+	i, ok := c.fids.Load(fid)
+	if !ok {
+		return nil, proto.EBADF
+	}
+	info := i.(*fidInfo)
+	dir, ok := info.n.(Dir)
+	if !ok {
+		return nil, proto.ENOTDIR
+	}
+	n, ok := dir.Children()[name]
+	if !ok {
+		return nil, proto.ENOENT
+	}
+	return info.deriveInfo(n), 0
+}
+
+// rename renames the node referred to by info to name within newdir.
+// Nodes can only be renamed within their own directory.
+func (s *server) rename(tag uint16, info *fidInfo, newdir FSNode, name string) proto.FCall {
+	if info.n.Parent() != newdir {
+		return lerror(tag, proto.EXDEV)
+	}
+	newstat := proto.NullStat()
+	newstat.Name = name
+	if err := s.wstat(info, &newstat); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, tag}, err.Error(), 0}
+	}
+	return nil
+}
+
+func (s *server) Rename(gc go9p.Conn, t *proto.TRename) (proto.FCall, error) {
+	c := gc.(*conn)
+	i, ok := c.fids.Load(t.Fid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	d, ok := c.fids.Load(t.Dfid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	if resp := s.rename(t.Tag, i.(*fidInfo), d.(*fidInfo).n, t.Name); resp != nil {
+		return resp, nil
+	}
+	return &proto.RRename{proto.Header{proto.Rrename, t.Tag}}, nil
+}
+
+func (s *server) Renameat(gc go9p.Conn, t *proto.TRenameat) (proto.FCall, error) {
+	c := gc.(*conn)
+	info, ecode := c.child(t.Olddirfid, t.Oldname)
+	if info == nil {
+		return lerror(t.Tag, ecode), nil
+	}
+	d, ok := c.fids.Load(t.Newdirfid)
+	if !ok {
+		return lerror(t.Tag, proto.EBADF), nil
+	}
+	if resp := s.rename(t.Tag, info, d.(*fidInfo).n, t.Newname); resp != nil {
+		return resp, nil
+	}
+	return &proto.RRenameat{proto.Header{proto.Rrenameat, t.Tag}}, nil
+}
+
+func (s *server) Unlinkat(gc go9p.Conn, t *proto.TUnlinkat) (proto.FCall, error) {
+	c := gc.(*conn)
+	info, ecode := c.child(t.Dirfid, t.Name)
+	if info == nil {
+		return lerror(t.Tag, ecode), nil
+	}
+	_, isDir := info.n.(Dir)
+	if isDir && t.Flags&proto.AtRemovedir == 0 {
+		return lerror(t.Tag, proto.EISDIR), nil
+	}
+	if !isDir && t.Flags&proto.AtRemovedir != 0 {
+		return lerror(t.Tag, proto.ENOTDIR), nil
+	}
+	if err := s.remove(info); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
+	}
+	return &proto.RUnlinkat{proto.Header{proto.Runlinkat, t.Tag}}, nil
+}
@@ -1,6 +1,9 @@
 package fs
 
 import (
+	"bytes"
+
+	"github.com/knusbaum/go9p"
 	"github.com/knusbaum/go9p/proto"
 )
 
@@ -25,6 +28,17 @@ func NewDynamicFile(s *proto.Stat, genContent func() []byte) *DynamicFile {
 	}
 }
 
+// NewMetricsFile creates a DynamicFile holding the statistics counted
+// by m, in the Prometheus text format. Each open sees the statistics as
+// they were at the time.
+func NewMetricsFile(s *proto.Stat, m *go9p.Metrics) *DynamicFile {
+	return NewDynamicFile(s, func() []byte {
+		var b bytes.Buffer
+		m.WriteTo(&b)
+		return b.Bytes()
+	})
+}
+
 func (f *DynamicFile) Open(fid uint64, omode proto.Mode) error {
 	f.Lock()
 	defer f.Unlock()
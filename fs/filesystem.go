@@ -17,10 +17,10 @@
 package fs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"strings"
 	"sync"
 	"time"
@@ -64,6 +64,30 @@ type File interface {
 	Close(fid uint64) error
 }
 
+// A Caller describes the client on whose behalf a ContextFile method
+// is called.
+type Caller struct {
+	Fid   uint64 // The fid, as passed to the File methods.
+	Uname string // The name of the user the fid belongs to.
+}
+
+// ContextFile is a File whose operations can be abandoned. If a File
+// implements ContextFile, the server calls OpenContext, ReadContext and
+// WriteContext rather than Open, Read and Write. The context is
+// cancelled if the client flushes the request, or the connection to the
+// client is lost, after which the result of the call is discarded. Files
+// that may block for a long time, like streams, should implement
+// ContextFile and return when the context is cancelled.
+//
+// Close is not given a context. It is always called for an open fid,
+// including when the connection is lost.
+type ContextFile interface {
+	File
+	OpenContext(ctx context.Context, c Caller, omode proto.Mode) error
+	ReadContext(ctx context.Context, c Caller, offset uint64, count uint64) ([]byte, error)
+	WriteContext(ctx context.Context, c Caller, offset uint64, data []byte) (uint32, error)
+}
+
 // Dir represents a directory within the Filesystem.
 type Dir interface {
 	FSNode
@@ -77,6 +101,17 @@ type ModDir interface {
 	DeleteChild(name string) error
 }
 
+// Renamer is a directory whose children can be renamed. The server
+// renames a node by calling RenameChild on its parent, if the parent
+// is a Renamer, and then calling WriteStat on the node with its new
+// name, so nodes that keep track of their own name or path can follow
+// the change. RenameChild must fail if a child named newname already
+// exists.
+type Renamer interface {
+	Dir
+	RenameChild(oldname, newname string) error
+}
+
 // FullPath is a helper function that assembles the names
 // of all the parent nodes of f into a full path string.
 func FullPath(f FSNode) string {
@@ -205,6 +240,7 @@ type FS struct {
 	RemoveFile  func(fs *FS, f FSNode) error
 	uid         uint64 // uid for generating Qids.
 	ignorePerms bool   // When true, the server will ignore user/group permissions
+	users       UserDB // Group membership for permission checks.
 	// doAuth bool
 	authFunc func(s io.ReadWriter) (string, error)
 	sync.RWMutex
@@ -337,17 +373,28 @@ func IgnorePermissions() Option {
 	}
 }
 
+// WithUserDB configures the groups used by the server to check permissions.
+// By default, every user is the only member of a group of the same name.
+func WithUserDB(db UserDB) Option {
+	return func(fs *FS) {
+		fs.users = db
+	}
+}
+
+// userDB returns the UserDB used for fs's permission checks.
+func (fs *FS) userDB() UserDB {
+	if fs.users == nil {
+		return StaticUserDB(nil)
+	}
+	return fs.users
+}
+
 func Plan9Auth(s io.ReadWriter) (string, error) {
-	log.Println("STARTING LIBAUTH PROXY")
-	defer log.Println("FINISHED LIBAUTH PROXY")
 	ai, err := libauth.Proxy(s, "proto=p9any role=server")
 	if err != nil {
-		log.Printf("Authentication Error: %s", err)
 		return "", err
-	} else {
-		log.Printf("AuthInfo: [Cuid: %s, Suid: %s, Cap: %s]", ai.Cuid, ai.Suid, ai.Cap)
-		return ai.Cuid, nil
 	}
+	return ai.Cuid, nil
 }
 
 // Generic SASL authentication
@@ -374,7 +421,6 @@ func PlainAuth(userpass map[string]string) func(io.ReadWriter) (string, error) {
 
 		for {
 			var ba [4096]byte
-			log.Printf("READ1\n")
 			n, err := s.Read(ba[:])
 			if err != nil {
 				return "", err
@@ -382,14 +428,11 @@ func PlainAuth(userpass map[string]string) func(io.ReadWriter) (string, error) {
 			bs := ba[:n]
 			challenge, done, err := auth.Next(bs)
 			if err != nil {
-				log.Printf("ERROR: %s\n", err)
 				return "", err
 			}
 			if done {
-				log.Printf("SUCCESS!\n")
 				return "TODO", nil
 			}
-			log.Printf("WRITE1\n")
 			s.Write(challenge)
 		}
 	}
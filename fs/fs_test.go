@@ -1,8 +1,19 @@
 package fs
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/knusbaum/go9p"
 	"github.com/knusbaum/go9p/proto"
 
 	"github.com/stretchr/testify/assert"
@@ -92,3 +103,679 @@ func TestStaticFile(t *testing.T) {
 	err = f.Close(0)
 	assert.NoError(err)
 }
+
+func TestStaticFileLength(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	f := NewStaticFile(fs.NewStat("file", "user", "user", 0666), []byte("data"))
+	root.AddChild(f)
+
+	_, err := f.Write(0, MaxStaticLength, []byte("x"))
+	assert.Error(err)
+	_, err = f.Write(0, math.MaxUint64, []byte("x"))
+	assert.Error(err)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go go9p.ServeReadWriter(sr, sw, fs.Server())
+	rpc := func(call proto.FCall) proto.FCall {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "user", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"file"}}))
+
+	// A client cannot make the server allocate a huge file.
+	stat := proto.NullStat()
+	stat.Length = 1 << 62
+	assert.IsType(&proto.RError{}, rpc(&proto.TWstat{proto.Header{proto.Twstat, 1}, 1, stat}))
+	assert.Equal([]byte("data"), f.Data)
+
+	stat.Length = 8
+	assert.IsType(&proto.RWstat{}, rpc(&proto.TWstat{proto.Header{proto.Twstat, 1}, 1, stat}))
+	assert.Equal([]byte("data\x00\x00\x00\x00"), f.Data)
+}
+
+func TestDotL(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777,
+		WithCreateDir(CreateStaticDir),
+		WithRemoveFile(RMFile),
+	)
+	root.AddChild(NewStaticFile(fs.NewStat("file", "user", "user", 0644), []byte("Hello, World!\n")))
+
+	srv, ok := fs.Server().(go9p.LSrv)
+	assert.True(ok)
+	c := srv.NewConn()
+	h := func(t uint8) proto.Header { return proto.Header{t, 1} }
+
+	resp, err := srv.Version(c, &proto.TRVersion{h(proto.Tversion), 8192, "9P2000.L"})
+	assert.NoError(err)
+	assert.Equal("9P2000.L", resp.(*proto.TRVersion).Version)
+
+	resp, err = srv.Attach(c, &proto.TAttach{h(proto.Tattach), 0, ^uint32(0), "user", "", 1000})
+	assert.NoError(err)
+	assert.IsType(&proto.RAttach{}, resp)
+
+	resp, err = srv.Getattr(c, &proto.TGetattr{h(proto.Tgetattr), 0, proto.GetattrBasic})
+	assert.NoError(err)
+	attr := resp.(*proto.RGetattr)
+	assert.Equal(uint32(040777), attr.Mode)
+	assert.Equal(uint32(1000), attr.Uid)
+
+	resp, err = srv.Mkdir(c, &proto.TMkdir{h(proto.Tmkdir), 0, "dir", 0755, 1000})
+	assert.NoError(err)
+	assert.IsType(&proto.RMkdir{}, resp)
+
+	resp, err = srv.Walk(c, &proto.TWalk{h(proto.Twalk), 0, 1, 0, nil})
+	assert.NoError(err)
+	resp, err = srv.Lopen(c, &proto.TLopen{h(proto.Tlopen), 1, proto.LOrdonly | proto.LOdirectory})
+	assert.NoError(err)
+	assert.IsType(&proto.RLopen{}, resp)
+	resp, err = srv.Readdir(c, &proto.TReaddir{h(proto.Treaddir), 1, 0, 8192})
+	assert.NoError(err)
+	rd := resp.(*proto.RReaddir)
+	ents, err := proto.ParseDirents(rd.Data)
+	assert.NoError(err)
+	assert.Len(ents, 2)
+	resp, err = srv.Readdir(c, &proto.TReaddir{h(proto.Treaddir), 1, ents[1].Offset, 8192})
+	assert.NoError(err)
+	assert.Equal(uint32(0), resp.(*proto.RReaddir).Count)
+
+	resp, err = srv.Renameat(c, &proto.TRenameat{h(proto.Trenameat), 0, "file", 0, "renamed"})
+	assert.NoError(err)
+	assert.IsType(&proto.RRenameat{}, resp)
+	assert.Contains(root.Children(), "renamed")
+
+	resp, err = srv.Walk(c, &proto.TWalk{h(proto.Twalk), 0, 2, 1, []string{"renamed"}})
+	assert.NoError(err)
+	resp, err = srv.Walk(c, &proto.TWalk{h(proto.Twalk), 0, 3, 1, []string{"renamed"}})
+	assert.NoError(err)
+	resp, err = srv.Lock(c, &proto.TLock{h(proto.Tlock), 2, proto.LockTypeWrlck, 0, 0, 0, 1, "a"})
+	assert.NoError(err)
+	assert.Equal(uint8(proto.LockSuccess), resp.(*proto.RLock).Status)
+	resp, err = srv.Lock(c, &proto.TLock{h(proto.Tlock), 3, proto.LockTypeRdlck, 0, 0, 10, 2, "b"})
+	assert.NoError(err)
+	assert.Equal(uint8(proto.LockBlocked), resp.(*proto.RLock).Status)
+	resp, err = srv.Clunk(c, &proto.TClunk{h(proto.Tclunk), 2})
+	assert.NoError(err)
+	resp, err = srv.Lock(c, &proto.TLock{h(proto.Tlock), 3, proto.LockTypeRdlck, 0, 0, 10, 2, "b"})
+	assert.NoError(err)
+	assert.Equal(uint8(proto.LockSuccess), resp.(*proto.RLock).Status)
+
+	resp, err = srv.Unlinkat(c, &proto.TUnlinkat{h(proto.Tunlinkat), 0, "dir", 0})
+	assert.NoError(err)
+	assert.Equal(uint32(proto.EISDIR), resp.(*proto.RLerror).Ecode)
+	resp, err = srv.Unlinkat(c, &proto.TUnlinkat{h(proto.Tunlinkat), 0, "dir", proto.AtRemovedir})
+	assert.NoError(err)
+	assert.IsType(&proto.RUnlinkat{}, resp)
+	assert.NotContains(root.Children(), "dir")
+}
+
+type blockingFile struct {
+	*StaticFile
+	unblock chan struct{}
+}
+
+func (f *blockingFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	<-f.unblock
+	return f.StaticFile.Read(fid, offset, count)
+}
+
+func TestFlush(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	f := &blockingFile{
+		StaticFile: NewStaticFile(fs.NewStat("file", "user", "user", 0644), []byte("Hello, World!\n")),
+		unblock:    make(chan struct{}),
+	}
+	root.AddChild(f)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go go9p.ServeReadWriter(sr, sw, fs.Server())
+	rpc := func(call proto.FCall) proto.FCall {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "user", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"file"}}))
+	assert.IsType(&proto.ROpen{}, rpc(&proto.TOpen{proto.Header{proto.Topen, 1}, 1, proto.Oread}))
+
+	// The read blocks, so the flush must be answered first, and the
+	// read never answered.
+	_, err := cw.Write((&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 100}).Compose())
+	assert.NoError(err)
+	resp := rpc(&proto.TFlush{proto.Header{proto.Tflush, 3}, 2})
+	assert.Equal(&proto.RFlush{proto.Header{proto.Rflush, 3}}, resp)
+
+	close(f.unblock)
+	resp = rpc(&proto.TClunk{proto.Header{proto.Tclunk, 2}, 1})
+	assert.Equal(&proto.RClunk{proto.Header{proto.Rclunk, 2}}, resp)
+}
+
+type cancelFile struct {
+	*StaticFile
+	callers   chan Caller
+	cancelled chan struct{}
+}
+
+func (f *cancelFile) OpenContext(ctx context.Context, c Caller, omode proto.Mode) error {
+	return f.Open(c.Fid, omode)
+}
+
+func (f *cancelFile) ReadContext(ctx context.Context, c Caller, offset uint64, count uint64) ([]byte, error) {
+	f.callers <- c
+	<-ctx.Done()
+	f.cancelled <- struct{}{}
+	return nil, ctx.Err()
+}
+
+func (f *cancelFile) WriteContext(ctx context.Context, c Caller, offset uint64, data []byte) (uint32, error) {
+	return f.Write(c.Fid, offset, data)
+}
+
+func TestContextFile(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	f := &cancelFile{
+		StaticFile: NewStaticFile(fs.NewStat("file", "user", "user", 0644), nil),
+		callers:    make(chan Caller, 2),
+		cancelled:  make(chan struct{}, 2),
+	}
+	root.AddChild(f)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go go9p.ServeReadWriter(sr, sw, fs.Server())
+	rpc := func(call proto.FCall) proto.FCall {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+	waitCancel := func() {
+		select {
+		case <-f.cancelled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("read was not cancelled")
+		}
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "glenda", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"file"}}))
+	assert.IsType(&proto.ROpen{}, rpc(&proto.TOpen{proto.Header{proto.Topen, 1}, 1, proto.Oread}))
+
+	// A flush cancels the read's context.
+	_, err := cw.Write((&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 100}).Compose())
+	assert.NoError(err)
+	c := <-f.callers
+	assert.Equal("glenda", c.Uname)
+	assert.Equal(uint64(1), c.Fid&0xFFFFFFFF)
+	assert.Equal(&proto.RFlush{proto.Header{proto.Rflush, 3}}, rpc(&proto.TFlush{proto.Header{proto.Tflush, 3}, 2}))
+	waitCancel()
+
+	// So does losing the connection.
+	_, err = cw.Write((&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 100}).Compose())
+	assert.NoError(err)
+	<-f.callers
+	cw.Close()
+	waitCancel()
+}
+
+func TestListenFileFlush(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	f := NewListenFile(fs.NewStat("listen", "user", "user", 0666))
+	root.AddChild(f)
+	l := (*ListenFileListener)(f)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go go9p.ServeReadWriter(sr, sw, fs.Server())
+	rpc := func(call proto.FCall) proto.FCall {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "user", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"listen"}}))
+	assert.IsType(&proto.ROpen{}, rpc(&proto.TOpen{proto.Header{proto.Topen, 1}, 1, proto.Ordwr}))
+	conn, err := l.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+
+	// A read waiting for the other end can be flushed.
+	_, err = cw.Write((&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 100}).Compose())
+	assert.NoError(err)
+	assert.Equal(&proto.RFlush{proto.Header{proto.Rflush, 3}}, rpc(&proto.TFlush{proto.Header{proto.Tflush, 3}, 2}))
+
+	// What the flushed read would have returned goes to the next one.
+	go conn.Write([]byte("hello"))
+	resp := rpc(&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 3})
+	assert.Equal(&proto.RRead{proto.Header{proto.Rread, 2}, 3, []byte("hel")}, resp)
+	resp = rpc(&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 100})
+	assert.Equal(&proto.RRead{proto.Header{proto.Rread, 2}, 2, []byte("lo")}, resp)
+
+	// So can an open waiting for Accept, once the backlog is full.
+	for fid := uint32(2); fid < 12; fid++ {
+		assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, fid, 1, []string{"listen"}}))
+		assert.IsType(&proto.ROpen{}, rpc(&proto.TOpen{proto.Header{proto.Topen, 1}, fid, proto.Ordwr}))
+	}
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 12, 1, []string{"listen"}}))
+	_, err = cw.Write((&proto.TOpen{proto.Header{proto.Topen, 2}, 12, proto.Ordwr}).Compose())
+	assert.NoError(err)
+	assert.Equal(&proto.RFlush{proto.Header{proto.Rflush, 3}}, rpc(&proto.TFlush{proto.Header{proto.Tflush, 3}, 2}))
+	// The abandoned open is undone.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		f.m.RLock()
+		n := len(f.conns)
+		f.m.RUnlock()
+		if n == 11 || time.Now().After(deadline) {
+			assert.Equal(11, n)
+			break
+		}
+	}
+}
+
+type jitterFile struct {
+	*StaticFile
+	writes []string
+}
+
+func (f *jitterFile) Write(fid uint64, offset uint64, data []byte) (uint32, error) {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+	f.Lock()
+	f.writes = append(f.writes, string(data))
+	f.Unlock()
+	return uint32(len(data)), nil
+}
+
+func TestFidOrder(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	f := &jitterFile{StaticFile: NewStaticFile(fs.NewStat("file", "user", "user", 0666), nil)}
+	root.AddChild(f)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go go9p.ServeReadWriter(sr, sw, fs.Server())
+	rpc := func(call proto.FCall) proto.FCall {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "user", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"file"}}))
+	assert.IsType(&proto.ROpen{}, rpc(&proto.TOpen{proto.Header{proto.Topen, 1}, 1, proto.Owrite}))
+
+	// Send every write before reading any reply.
+	const count = 50
+	var expected []string
+	go func() {
+		for i := 0; i < count; i++ {
+			data := []byte(fmt.Sprintf("write %d", i))
+			_, err := cw.Write((&proto.TWrite{proto.Header{proto.Twrite, uint16(i + 2)}, 1, 0, uint32(len(data)), data}).Compose())
+			assert.NoError(err)
+		}
+	}()
+	for i := 0; i < count; i++ {
+		expected = append(expected, fmt.Sprintf("write %d", i))
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		assert.IsType(&proto.RWrite{}, resp)
+	}
+	f.Lock()
+	assert.Equal(expected, f.writes)
+	f.Unlock()
+}
+
+func TestFidOrderRelease(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	f := &cancelFile{
+		StaticFile: NewStaticFile(fs.NewStat("file", "user", "user", 0644), nil),
+		callers:    make(chan Caller, 2),
+		cancelled:  make(chan struct{}, 2),
+	}
+	root.AddChild(f)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	srv := &go9p.Server{Srv: fs.Server(), MaxInflight: 2}
+	go srv.ServeReadWriter(sr, sw)
+	defer cw.Close()
+	send := func(call proto.FCall) {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+	}
+	rpc := func(call proto.FCall) proto.FCall {
+		send(call)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "user", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"file"}}))
+	assert.IsType(&proto.ROpen{}, rpc(&proto.TOpen{proto.Header{proto.Topen, 1}, 1, proto.Oread}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 2, 1, []string{"file"}}))
+
+	// The walk uses fids 1 and 2, so it waits for the read on fid 1,
+	// and the read and stat after it wait for the walk. Once the first
+	// read is flushed, the walk's leaving releases both. The second
+	// read blocks, and the stat must not wait behind it.
+	send(&proto.TRead{proto.Header{proto.Tread, 2}, 1, 0, 100})
+	<-f.callers
+	send(&proto.TWalk{proto.Header{proto.Twalk, 3}, 1, 2, 0, nil})
+	send(&proto.TRead{proto.Header{proto.Tread, 4}, 1, 0, 100})
+	send(&proto.TStat{proto.Header{proto.Tstat, 5}, 2})
+	send(&proto.TFlush{proto.Header{proto.Tflush, 6}, 2})
+
+	tags := make(chan uint16)
+	go func() {
+		for {
+			resp, err := proto.ParseCall(cr)
+			if err != nil {
+				close(tags)
+				return
+			}
+			tags <- resp.GetTag()
+		}
+	}()
+	seen := make(map[uint16]bool)
+	for !seen[5] {
+		select {
+		case tag, ok := <-tags:
+			if !ok {
+				t.Fatal("connection closed")
+			}
+			seen[tag] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("a request released with a blocked one waited behind it")
+		}
+	}
+	assert.True(seen[6])
+	assert.False(seen[4])
+
+	<-f.callers
+	send(&proto.TFlush{proto.Header{proto.Tflush, 7}, 4})
+	assert.Equal(uint16(7), <-tags)
+}
+
+func TestUserDB(t *testing.T) {
+	assert := assert.New(t)
+	users, err := ParseUsers(strings.NewReader(`
+-1:adm:adm:glenda
+1:sys:glenda:bob
+2:staff::alice,glenda
+`))
+	assert.NoError(err)
+	fs, root := NewFS("adm", "adm", 0777, WithUserDB(users))
+	root.AddChild(NewStaticFile(fs.NewStat("f", "carol", "sys", 0640), []byte("Hello, World!\n")))
+
+	srv := fs.Server()
+	h := func(t uint8) proto.Header { return proto.Header{t, 1} }
+	attach := func(user string) go9p.Conn {
+		c := srv.NewConn()
+		_, err := srv.Version(c, &proto.TRVersion{h(proto.Tversion), 8192, "9P2000"})
+		assert.NoError(err)
+		resp, _ := srv.Attach(c, &proto.TAttach{h(proto.Tattach), 0, ^uint32(0), user, "", proto.NoUid})
+		assert.IsType(&proto.RAttach{}, resp)
+		resp, _ = srv.Walk(c, &proto.TWalk{h(proto.Twalk), 0, 1, 1, []string{"f"}})
+		assert.IsType(&proto.RWalk{}, resp)
+		return c
+	}
+	wstat := func(user string, mode uint32, gid string) proto.FCall {
+		st := proto.NullStat()
+		st.Mode = mode
+		st.Gid = gid
+		resp, _ := srv.Wstat(attach(user), &proto.TWstat{h(proto.Twstat), 1, st})
+		return resp
+	}
+
+	// Group members get the group permissions.
+	resp, _ := srv.Open(attach("bob"), &proto.TOpen{h(proto.Topen), 1, proto.Oread})
+	assert.IsType(&proto.ROpen{}, resp)
+	resp, _ = srv.Open(attach("alice"), &proto.TOpen{h(proto.Topen), 1, proto.Oread})
+	assert.IsType(&proto.RError{}, resp)
+
+	// The leader of the file's group may change its mode, but other
+	// members may not.
+	assert.IsType(&proto.RError{}, wstat("bob", 0660, ""))
+	assert.IsType(&proto.RWstat{}, wstat("glenda", 0660, ""))
+	assert.Equal(uint32(0660), root.Children()["f"].Stat().Mode)
+
+	// The owner may change the group to one they are a member of, and
+	// the leader of the file's group to one they lead. Every member of
+	// staff leads it, since it has no leader.
+	assert.IsType(&proto.RError{}, wstat("carol", math.MaxUint32, "adm"))
+	assert.IsType(&proto.RError{}, wstat("glenda", math.MaxUint32, "adm"))
+	assert.IsType(&proto.RWstat{}, wstat("glenda", math.MaxUint32, "staff"))
+	assert.Equal("staff", root.Children()["f"].Stat().Gid)
+	assert.IsType(&proto.RWstat{}, wstat("alice", math.MaxUint32, "alice"))
+
+	groups, err := ParseGroups(strings.NewReader("wheel:x:10:root,glenda\nusers:x:100:\n"))
+	assert.NoError(err)
+	assert.True(groups.IsMember("glenda", "wheel"))
+	assert.True(groups.IsLeader("glenda", "wheel"))
+	assert.False(groups.IsMember("glenda", "users"))
+	assert.True(groups.IsMember("glenda", "glenda"))
+}
+
+func TestOpenFlags(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777, WithRemoveFile(RMFile))
+	excl := NewStaticFile(fs.NewStat("excl", "user", "user", proto.DMEXCL|0666), nil)
+	log := NewStaticFile(fs.NewStat("log", "user", "user", proto.DMAPPEND|0666), []byte("abc"))
+	trunc := NewStaticFile(fs.NewStat("trunc", "user", "user", 0644), []byte("abc"))
+	tmp := NewStaticFile(fs.NewStat("tmp", "user", "user", 0666), nil)
+	ro := NewStaticDir(fs.NewStat("ro", "user", "user", proto.DMDIR|0555))
+	root.AddChild(excl)
+	root.AddChild(log)
+	// The file truncates itself on open, unless it is wrapped.
+	root.AddChild(&WrappedFile{File: trunc, OpenF: func(uint64, proto.Mode) error { return nil }})
+	root.AddChild(tmp)
+	root.AddChild(ro)
+	ro.AddChild(NewStaticFile(fs.NewStat("f", "user", "user", 0666), nil))
+
+	srv := fs.Server()
+	h := func(t uint8) proto.Header { return proto.Header{t, 1} }
+	c := srv.NewConn()
+	srv.Version(c, &proto.TRVersion{h(proto.Tversion), 8192, "9P2000"})
+	attach := func(fid uint32, user string) {
+		resp, _ := srv.Attach(c, &proto.TAttach{h(proto.Tattach), fid, ^uint32(0), user, "", proto.NoUid})
+		assert.IsType(&proto.RAttach{}, resp)
+	}
+	open := func(fid, newfid uint32, mode proto.Mode, path ...string) proto.FCall {
+		resp, _ := srv.Walk(c, &proto.TWalk{h(proto.Twalk), fid, newfid, uint16(len(path)), path})
+		assert.IsType(&proto.RWalk{}, resp)
+		resp, _ = srv.Open(c, &proto.TOpen{h(proto.Topen), newfid, mode})
+		return resp
+	}
+	clunk := func(fid uint32) {
+		srv.Clunk(c, &proto.TClunk{h(proto.Tclunk), fid})
+	}
+	attach(0, "user")
+	attach(1, "other")
+
+	// Exclusive use files may be open only once at a time.
+	assert.IsType(&proto.ROpen{}, open(0, 2, proto.Oread, "excl"))
+	assert.IsType(&proto.RError{}, open(0, 3, proto.Oread, "excl"))
+	clunk(2)
+	assert.IsType(&proto.ROpen{}, open(0, 3, proto.Oread, "excl"))
+	clunk(3)
+
+	// Writes to append only files go to the end.
+	assert.IsType(&proto.ROpen{}, open(0, 2, proto.Owrite, "log"))
+	resp, _ := srv.Write(c, &proto.TWrite{h(proto.Twrite), 2, 0, 3, []byte("def")})
+	assert.IsType(&proto.RWrite{}, resp)
+	assert.Equal("abcdef", string(log.Data))
+	clunk(2)
+
+	// Truncating requires write permission.
+	assert.IsType(&proto.RError{}, open(1, 2, proto.Oread|proto.Otrunc, "trunc"))
+	assert.Equal("abc", string(trunc.Data))
+	assert.IsType(&proto.ROpen{}, open(0, 2, proto.Oread|proto.Otrunc, "trunc"))
+	assert.Empty(trunc.Data)
+	clunk(2)
+
+	// ORCLOSE requires permission to remove the file, and removes it
+	// when the fid is clunked.
+	assert.IsType(&proto.RError{}, open(0, 2, proto.Oread|proto.Orclose, "ro", "f"))
+	assert.IsType(&proto.ROpen{}, open(0, 2, proto.Oread|proto.Orclose, "tmp"))
+	assert.Contains(root.Children(), "tmp")
+	clunk(2)
+	assert.NotContains(root.Children(), "tmp")
+}
+
+func TestParentPermissions(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777, WithRemoveFile(RMFile))
+	d := NewStaticDir(fs.NewStat("d", "user", "user", proto.DMDIR|0755))
+	private := NewStaticDir(fs.NewStat("private", "user", "user", proto.DMDIR|0700))
+	root.AddChild(d)
+	root.AddChild(private)
+	d.AddChild(NewStaticFile(fs.NewStat("f", "other", "other", 0666), nil))
+	d.AddChild(NewStaticFile(fs.NewStat("g", "user", "user", 0666), nil))
+	private.AddChild(NewStaticFile(fs.NewStat("x", "user", "user", 0666), nil))
+
+	srv := fs.Server()
+	h := func(t uint8) proto.Header { return proto.Header{t, 1} }
+	c := srv.NewConn()
+	srv.Version(c, &proto.TRVersion{h(proto.Tversion), 8192, "9P2000"})
+	srv.Attach(c, &proto.TAttach{h(proto.Tattach), 0, ^uint32(0), "user", "", proto.NoUid})
+	srv.Attach(c, &proto.TAttach{h(proto.Tattach), 1, ^uint32(0), "other", "", proto.NoUid})
+	walk := func(fid, newfid uint32, path ...string) proto.FCall {
+		resp, _ := srv.Walk(c, &proto.TWalk{h(proto.Twalk), fid, newfid, uint16(len(path)), path})
+		return resp
+	}
+	rename := func(fid uint32, name string) proto.FCall {
+		st := proto.NullStat()
+		st.Name = name
+		resp, _ := srv.Wstat(c, &proto.TWstat{h(proto.Twstat), fid, st})
+		return resp
+	}
+
+	// Walking requires search permission on each directory.
+	assert.IsType(&proto.RWalk{}, walk(1, 2, "private"))
+	assert.IsType(&proto.RError{}, walk(1, 3, "private", "x"))
+	assert.IsType(&proto.RError{}, walk(2, 3, "x"))
+	assert.IsType(&proto.RWalk{}, walk(0, 3, "private", "x"))
+
+	// Renaming and removing require write permission on the directory,
+	// whatever the permissions of the file.
+	assert.IsType(&proto.RWalk{}, walk(1, 4, "d", "f"))
+	assert.IsType(&proto.RError{}, rename(4, "h"))
+	resp, _ := srv.Remove(c, &proto.TRemove{h(proto.Tremove), 4})
+	assert.IsType(&proto.RError{}, resp)
+	assert.Contains(d.Children(), "f")
+
+	// Names may not be reused.
+	assert.IsType(&proto.RWalk{}, walk(0, 4, "d", "f"))
+	resp = rename(4, "g")
+	if assert.IsType(&proto.RError{}, resp) {
+		assert.Equal(uint32(proto.EEXIST), proto.ErrnoFor(resp.(*proto.RError).Ename))
+	}
+	assert.IsType(&proto.RWstat{}, rename(4, "h"))
+	assert.Contains(d.Children(), "h")
+	resp, _ = srv.Remove(c, &proto.TRemove{h(proto.Tremove), 4})
+	assert.IsType(&proto.RRemove{}, resp)
+	assert.NotContains(d.Children(), "h")
+}
+
+func TestRenameChild(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	for i := 0; i < 10; i++ {
+		root.AddChild(NewStaticFile(fs.NewStat(fmt.Sprint(i), "user", "user", 0666), nil))
+	}
+
+	// Only one of the renames to the same name succeeds.
+	var wg sync.WaitGroup
+	var renamed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if root.RenameChild(fmt.Sprint(i), "target") == nil {
+				atomic.AddInt32(&renamed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(int32(1), renamed)
+	children := root.Children()
+	assert.Len(children, 10)
+	if assert.Contains(children, "target") {
+		assert.Equal("target", children["target"].Stat().Name)
+	}
+	assert.Error(root.RenameChild("nothing", "something"))
+}
+
+type fixedLengthFile struct {
+	*StaticFile
+}
+
+func (f *fixedLengthFile) WriteStat(s *proto.Stat) error {
+	if s.Length != f.Stat().Length {
+		return errors.New("length cannot change")
+	}
+	return f.StaticFile.WriteStat(s)
+}
+
+func TestWstatAtomic(t *testing.T) {
+	assert := assert.New(t)
+	fs, root := NewFS("user", "user", 0777)
+	root.AddChild(&fixedLengthFile{NewStaticFile(fs.NewStat("file", "user", "user", 0666), []byte("data"))})
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go go9p.ServeReadWriter(sr, sw, fs.Server())
+	rpc := func(call proto.FCall) proto.FCall {
+		_, err := cw.Write(call.Compose())
+		assert.NoError(err)
+		resp, err := proto.ParseCall(cr)
+		assert.NoError(err)
+		return resp
+	}
+
+	assert.IsType(&proto.TRVersion{}, rpc(&proto.TRVersion{proto.Header{proto.Tversion, 0}, 8192, "9P2000"}))
+	assert.IsType(&proto.RAttach{}, rpc(&proto.TAttach{proto.Header{proto.Tattach, 1}, 0, ^uint32(0), "user", "", proto.NoUid}))
+	assert.IsType(&proto.RWalk{}, rpc(&proto.TWalk{proto.Header{proto.Twalk, 1}, 0, 1, 1, []string{"file"}}))
+
+	// A rename with a change the file rejects is not made.
+	stat := proto.NullStat()
+	stat.Name = "renamed"
+	stat.Length = 0
+	assert.IsType(&proto.RError{}, rpc(&proto.TWstat{proto.Header{proto.Twstat, 1}, 1, stat}))
+	children := root.Children()
+	assert.Contains(children, "file")
+	assert.NotContains(children, "renamed")
+
+	stat.Length = math.MaxUint64
+	assert.IsType(&proto.RWstat{}, rpc(&proto.TWstat{proto.Header{proto.Twstat, 1}, 1, stat}))
+	assert.Contains(root.Children(), "renamed")
+}
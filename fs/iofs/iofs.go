@@ -0,0 +1,275 @@
+// Package iofs serves the contents of an io/fs.FS, such as an embed.FS,
+// a zip.Reader or an fstest.MapFS, as a read-only 9p filesystem.
+//
+// The root of an io/fs.FS is used as the Root of an fs.FS:
+//
+//	var exportFS fs.FS
+//	exportFS.Root = iofs.NewDir(os.DirFS("/usr/share/doc"), "glenda", "glenda")
+//	go9p.Serve("localhost:9999", exportFS.Server())
+package iofs
+
+import (
+	"errors"
+	"hash/crc64"
+	"io"
+	iofs "io/fs"
+	"log"
+	"path"
+	"sync"
+
+	"github.com/knusbaum/go9p/fs"
+	"github.com/knusbaum/go9p/proto"
+)
+
+// tree is the io/fs.FS shared by the nodes of one filesystem, along with
+// the owner reported for all of them.
+type tree struct {
+	fsys iofs.FS
+	uid  string
+	gid  string
+}
+
+// Dir is an fs.Dir for a directory of an io/fs.FS. Path is the name of
+// the directory in the io/fs.FS, "." for its root.
+type Dir struct {
+	t    *tree
+	Path string
+}
+
+// File is an fs.File for a file of an io/fs.FS. It can only be opened
+// for reading.
+type File struct {
+	t     *tree
+	Path  string
+	opens map[uint64]*openFile
+	sync.Mutex
+}
+
+var _ fs.Dir = &Dir{}
+var _ fs.File = &File{}
+
+// NewDir returns the root directory of fsys. All of the files are owned by
+// the user uid and the group gid, since io/fs.FS has no owners.
+func NewDir(fsys iofs.FS, uid, gid string) *Dir {
+	return &Dir{t: &tree{fsys: fsys, uid: uid, gid: gid}, Path: "."}
+}
+
+func (t *tree) node(p string, isDir bool) fs.FSNode {
+	if isDir {
+		return &Dir{t: t, Path: p}
+	}
+	return &File{t: t, Path: p, opens: make(map[uint64]*openFile)}
+}
+
+var crc64Table = crc64.MakeTable(0xC96C5795D7870F42)
+
+// stat returns the Stat of the file p.
+func (t *tree) stat(p string) proto.Stat {
+	info, err := iofs.Stat(t.fsys, p)
+	if err != nil {
+		log.Printf("Failed to stat %s: %s", p, err)
+		return proto.Stat{}
+	}
+	st := Stat(info)
+	st.Qid.Uid = crc64.Checksum([]byte(p), crc64Table)
+	st.Uid = t.uid
+	st.Gid = t.gid
+	if p == "." {
+		st.Name = "/"
+	}
+	return st
+}
+
+func parent(t *tree, p string) fs.Dir {
+	if p == "." {
+		return nil
+	}
+	return &Dir{t: t, Path: path.Dir(p)}
+}
+
+var errReadOnly = errors.New("read-only file system")
+
+func (d *Dir) Stat() proto.Stat {
+	return d.t.stat(d.Path)
+}
+
+func (d *Dir) WriteStat(s *proto.Stat) error {
+	return errReadOnly
+}
+
+func (d *Dir) SetParent(p fs.Dir) {
+}
+
+func (d *Dir) Parent() fs.Dir {
+	return parent(d.t, d.Path)
+}
+
+func (d *Dir) Children() map[string]fs.FSNode {
+	entries, err := iofs.ReadDir(d.t.fsys, d.Path)
+	if err != nil {
+		log.Printf("Failed to list path %s: %s", d.Path, err)
+		return nil
+	}
+	m := make(map[string]fs.FSNode)
+	for _, e := range entries {
+		m[e.Name()] = d.t.node(path.Join(d.Path, e.Name()), e.IsDir())
+	}
+	return m
+}
+
+func (f *File) Stat() proto.Stat {
+	return f.t.stat(f.Path)
+}
+
+func (f *File) WriteStat(s *proto.Stat) error {
+	return errReadOnly
+}
+
+func (f *File) SetParent(p fs.Dir) {
+}
+
+func (f *File) Parent() fs.Dir {
+	return parent(f.t, f.Path)
+}
+
+// An openFile is a File opened for one fid. pos is the offset of the
+// next Read from f, for files that cannot seek.
+type openFile struct {
+	f   iofs.File
+	pos int64
+}
+
+func (f *File) Open(fid uint64, omode proto.Mode) error {
+	if omode&0x0F != proto.Oread && omode&0x0F != proto.Oexec || omode&(proto.Otrunc|proto.Orclose) != 0 {
+		return errReadOnly
+	}
+	file, err := f.t.fsys.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.opens[fid] = &openFile{f: file}
+	return nil
+}
+
+// Read reads from the file at offset. Files that are not io.ReaderAt or
+// io.Seeker are read in sequence, and reopened if a client reads from an
+// earlier offset.
+func (f *File) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	f.Lock()
+	file := f.opens[fid]
+	f.Unlock()
+	if file == nil {
+		return nil, errors.New("File not open.")
+	}
+	bs := make([]byte, count)
+	var n int
+	var err error
+	switch r := file.f.(type) {
+	case io.ReaderAt:
+		n, err = r.ReadAt(bs, int64(offset))
+	case io.ReadSeeker:
+		if _, err = r.Seek(int64(offset), io.SeekStart); err == nil {
+			n, err = io.ReadFull(r, bs)
+		}
+	default:
+		if err = f.seek(fid, file, int64(offset)); err == nil {
+			n, err = io.ReadFull(file.f, bs)
+			file.pos += int64(n)
+		}
+	}
+	if n > 0 {
+		return bs[:n], nil
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// seek moves file, open for fid, to offset by reading from it, reopening
+// it first if offset is behind it.
+func (f *File) seek(fid uint64, file *openFile, offset int64) error {
+	if offset < file.pos {
+		nf, err := f.t.fsys.Open(f.Path)
+		if err != nil {
+			return err
+		}
+		file.f.Close()
+		file.f = nf
+		file.pos = 0
+	}
+	n, err := io.CopyN(io.Discard, file.f, offset-file.pos)
+	file.pos += n
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (f *File) Write(fid uint64, offset uint64, data []byte) (uint32, error) {
+	return 0, errReadOnly
+}
+
+func (f *File) Close(fid uint64) error {
+	f.Lock()
+	file := f.opens[fid]
+	delete(f.opens, fid)
+	f.Unlock()
+	if file == nil {
+		return nil
+	}
+	return file.f.Close()
+}
+
+// modeBits maps the mode bits of an io/fs.FileMode to those of a
+// proto.Stat.
+var modeBits = []struct {
+	mode iofs.FileMode
+	dm   uint32
+}{
+	{iofs.ModeDir, proto.DMDIR},
+	{iofs.ModeAppend, proto.DMAPPEND},
+	{iofs.ModeExclusive, proto.DMEXCL},
+	{iofs.ModeTemporary, proto.DMTMP},
+	{iofs.ModeSymlink, proto.DMSYMLINK},
+	{iofs.ModeDevice, proto.DMDEVICE},
+	{iofs.ModeNamedPipe, proto.DMNAMEDPIPE},
+	{iofs.ModeSocket, proto.DMSOCKET},
+	{iofs.ModeSetuid, proto.DMSETUID},
+	{iofs.ModeSetgid, proto.DMSETGID},
+}
+
+// Mode returns the Mode of a proto.Stat equivalent to m.
+func Mode(m iofs.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	for _, b := range modeBits {
+		if m&b.mode != 0 {
+			mode |= b.dm
+		}
+	}
+	return mode
+}
+
+// Stat returns the proto.Stat describing info. Its Qid has the type of
+// the file and uses the modification time as the version, but has no
+// path, and it has no owner.
+func Stat(info iofs.FileInfo) proto.Stat {
+	mode := Mode(info.Mode())
+	st := proto.Stat{
+		Qid: proto.Qid{
+			Qtype: uint8(mode >> 24),
+			Vers:  uint32(info.ModTime().Unix()),
+		},
+		Mode:   mode,
+		Atime:  uint32(info.ModTime().Unix()),
+		Mtime:  uint32(info.ModTime().Unix()),
+		Length: uint64(info.Size()),
+		Name:   info.Name(),
+	}
+	if info.IsDir() {
+		st.Length = 0
+	}
+	return st
+}
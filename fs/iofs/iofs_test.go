@@ -0,0 +1,111 @@
+package iofs
+
+import (
+	"io"
+	iofs "io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/knusbaum/go9p"
+	"github.com/knusbaum/go9p/client"
+	"github.com/knusbaum/go9p/fs"
+	"github.com/knusbaum/go9p/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+type TwoPipe struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (t *TwoPipe) Close() error {
+	t.PipeReader.Close()
+	t.PipeWriter.Close()
+	return nil
+}
+
+// streamFS hides the ReadAt and Seek methods of the files of an
+// iofs.FS, so they can only be read in sequence.
+type streamFS struct {
+	iofs.FS
+}
+
+type streamFile struct {
+	iofs.File
+}
+
+func (s streamFS) Open(name string) (iofs.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.(iofs.ReadDirFile); ok {
+		return f, nil
+	}
+	return streamFile{f}, nil
+}
+
+func serve(t *testing.T, fsys iofs.FS) *client.Client {
+	var exportFS fs.FS
+	exportFS.Root = NewDir(fsys, "glenda", "glenda")
+	p1r, p1w := io.Pipe()
+	p2r, p2w := io.Pipe()
+	go go9p.ServeReadWriter(p1r, p2w, exportFS.Server())
+	c, err := client.NewClient(&TwoPipe{p2r, p1w}, "glenda", "", client.WithMsize(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestIOFS(t *testing.T) {
+	mtime := time.Unix(1234567890, 0)
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	mfs := fstest.MapFS{
+		"hello":       {Data: []byte("Hello, World!"), Mode: 0444, ModTime: mtime},
+		"dir/big":     {Data: data, Mode: 0644, ModTime: mtime},
+		"dir/sub/x":   {Data: []byte("x"), Mode: 0400, ModTime: mtime},
+		"dir/special": {Data: []byte("y"), Mode: iofs.ModeAppend | iofs.ModeTemporary | 0600, ModTime: mtime},
+	}
+
+	for name, fsys := range map[string]iofs.FS{"ReaderAt": mfs, "Stream": streamFS{mfs}} {
+		t.Run(name, func(t *testing.T) {
+			c := serve(t, fsys)
+			assert.NoError(t, fstest.TestFS(client.NewFS(c), "hello", "dir/big", "dir/sub/x", "dir/special"))
+
+			st, err := c.Stat("/dir/special")
+			if assert.NoError(t, err) {
+				assert.Equal(t, proto.DMAPPEND|proto.DMTMP|0600, st.Mode)
+				assert.Equal(t, uint32(mtime.Unix()), st.Mtime)
+				assert.Equal(t, "glenda", st.Uid)
+			}
+			st2, err := c.Stat("/dir/special")
+			if assert.NoError(t, err) {
+				assert.Equal(t, st.Qid, st2.Qid)
+			}
+
+			// Reads from an earlier offset start the file over.
+			f, err := c.Open("/dir/big", proto.Oread)
+			if assert.NoError(t, err) {
+				bs := make([]byte, 10)
+				n, err := f.ReadAt(bs, 5000)
+				assert.NoError(t, err)
+				assert.Equal(t, data[5000:5000+n], bs[:n])
+				n, err = f.ReadAt(bs, 100)
+				assert.NoError(t, err)
+				assert.Equal(t, data[100:100+n], bs[:n])
+				f.Close()
+			}
+
+			_, err = c.Open("/hello", proto.Owrite)
+			assert.Error(t, err)
+			_, err = c.Create("/new", 0644)
+			assert.Error(t, err)
+			assert.Error(t, c.Remove("/hello"))
+		})
+	}
+}
@@ -1,9 +1,9 @@
 package fs
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"sync"
 	"time"
@@ -33,13 +33,25 @@ type fileConn struct {
 	inWriter  *io.PipeWriter
 
 	m sync.Mutex
+
+	// rm serializes reads. A read that is abandoned leaves its read of
+	// outReader in pending, and the data it gets is kept in rest for
+	// the next one.
+	rm      sync.Mutex
+	pending chan readResult
+	rest    []byte
+}
+
+type readResult struct {
+	data []byte
+	err  error
 }
 
 type addr9p struct {
 	resource string
 }
 
-var _ File = &ListenFile{}
+var _ ContextFile = &ListenFile{}
 var _ net.Listener = &ListenFileListener{}
 var _ net.Conn = &fileConn{}
 var _ net.Addr = &addr9p{}
@@ -59,8 +71,14 @@ func (f *ListenFile) connForFid(fid uint64) *fileConn {
 }
 
 func (f *ListenFile) Open(fid uint64, omode proto.Mode) error {
+	return f.OpenContext(context.Background(), Caller{Fid: fid}, omode)
+}
+
+// OpenContext waits until the connection is queued for Accept, or ctx is
+// done.
+func (f *ListenFile) OpenContext(ctx context.Context, c Caller, omode proto.Mode) error {
+	fid := c.Fid
 	f.m.Lock()
-	log.Printf("OPEN [%d]\n", fid)
 	if f.closed {
 		f.m.Unlock()
 		return fmt.Errorf("Server closed the connection.")
@@ -76,17 +94,34 @@ func (f *ListenFile) Open(fid uint64, omode proto.Mode) error {
 	}
 	f.conns[fid] = conn
 	f.m.Unlock()
-	f.incoming <- conn
-	return nil
+	select {
+	case f.incoming <- conn:
+		return nil
+	case <-ctx.Done():
+		// The open failed, so fid is not closed.
+		f.m.Lock()
+		delete(f.conns, fid)
+		f.m.Unlock()
+		conn.Close()
+		return ctx.Err()
+	}
 }
 
 func (f *ListenFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	return f.ReadContext(context.Background(), Caller{Fid: fid}, offset, count)
+}
+
+func (f *ListenFile) ReadContext(ctx context.Context, c Caller, offset uint64, count uint64) ([]byte, error) {
 	//log.Printf("READ [%d]", fid)
-	conn := f.connForFid(fid)
+	conn := f.connForFid(c.Fid)
 	if conn == nil {
 		return nil, fmt.Errorf("Bad FID")
 	}
-	return conn.handleRead(count)
+	return conn.handleRead(ctx, count)
+}
+
+func (f *ListenFile) WriteContext(ctx context.Context, c Caller, offset uint64, data []byte) (uint32, error) {
+	return f.Write(c.Fid, offset, data)
 }
 
 func (f *ListenFile) Write(fid uint64, offset uint64, data []byte) (uint32, error) {
@@ -181,13 +216,41 @@ func (c *fileConn) SetWriteDeadline(t time.Time) error {
 	return fmt.Errorf("TODO")
 }
 
-func (c *fileConn) handleRead(count uint64) ([]byte, error) {
-	buff := make([]byte, count)
-	n, err := c.outReader.Read(buff)
-	if err == io.EOF {
-		err = nil
+// handleRead reads at most count bytes written to c, giving up when ctx
+// is done.
+func (c *fileConn) handleRead(ctx context.Context, count uint64) ([]byte, error) {
+	c.rm.Lock()
+	defer c.rm.Unlock()
+	if len(c.rest) == 0 {
+		if c.pending == nil {
+			// A pipe read cannot be interrupted, so it is made in
+			// the background.
+			pending := make(chan readResult, 1)
+			go func() {
+				buff := make([]byte, count)
+				n, err := c.outReader.Read(buff)
+				pending <- readResult{buff[:n], err}
+			}()
+			c.pending = pending
+		}
+		select {
+		case r := <-c.pending:
+			c.pending = nil
+			if r.err != nil && r.err != io.EOF {
+				return r.data, r.err
+			}
+			c.rest = r.data
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	n := uint64(len(c.rest))
+	if n > count {
+		n = count
 	}
-	return buff[:n], err
+	data := c.rest[:n]
+	c.rest = c.rest[n:]
+	return data, nil
 }
 
 func (c *fileConn) handleWrite(data []byte) (uint32, error) {
@@ -0,0 +1,141 @@
+package fs
+
+import (
+	"sync"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// byteLock is a POSIX-style byte range lock held on a file through a
+// 9P2000.L TLock request.
+type byteLock struct {
+	lockType uint8
+	start    uint64
+	length   uint64 // 0 means the lock extends to the end of the file.
+	procID   uint32
+	clientID string
+	fid      uint64 // connection fid the lock was taken through.
+}
+
+func (l *byteLock) end() uint64 {
+	if l.length == 0 {
+		return ^uint64(0)
+	}
+	return l.start + l.length - 1
+}
+
+func (l *byteLock) overlaps(o *byteLock) bool {
+	return l.start <= o.end() && o.start <= l.end()
+}
+
+func (l *byteLock) sameOwner(o *byteLock) bool {
+	return l.procID == o.procID && l.clientID == o.clientID
+}
+
+func (l *byteLock) conflicts(o *byteLock) bool {
+	if l.sameOwner(o) || !l.overlaps(o) {
+		return false
+	}
+	return l.lockType == proto.LockTypeWrlck || o.lockType == proto.LockTypeWrlck
+}
+
+// lockTable tracks the byte range locks held on files, keyed by
+// Qid.Path. Locks are advisory, and never block. A client asking to
+// wait for a lock is told it is blocked, and is expected to retry.
+type lockTable struct {
+	sync.Mutex
+	locks map[uint64][]*byteLock
+}
+
+// lock attempts to acquire or release (for LockTypeUnlck) l on the file
+// with Qid.Path path, returning one of the proto.Lock* status values.
+func (t *lockTable) lock(path uint64, l *byteLock) uint8 {
+	t.Lock()
+	defer t.Unlock()
+	if t.locks == nil {
+		t.locks = make(map[uint64][]*byteLock)
+	}
+	held := t.locks[path]
+	if l.lockType != proto.LockTypeUnlck {
+		for _, h := range held {
+			if h.conflicts(l) {
+				return proto.LockBlocked
+			}
+		}
+	}
+	kept := held[:0]
+	for _, h := range held {
+		if !(h.sameOwner(l) && h.overlaps(l)) {
+			kept = append(kept, h)
+		}
+	}
+	if l.lockType != proto.LockTypeUnlck {
+		kept = append(kept, l)
+	}
+	if len(kept) == 0 {
+		delete(t.locks, path)
+	} else {
+		t.locks[path] = kept
+	}
+	return proto.LockSuccess
+}
+
+// conflicting returns a lock held on the file with Qid.Path path that
+// would prevent l from being acquired, or nil if there is none.
+func (t *lockTable) conflicting(path uint64, l *byteLock) *byteLock {
+	t.Lock()
+	defer t.Unlock()
+	for _, h := range t.locks[path] {
+		if h.conflicts(l) {
+			return h
+		}
+	}
+	return nil
+}
+
+// release drops all locks taken through the connection fid fid.
+func (t *lockTable) release(fid uint64) {
+	t.Lock()
+	defer t.Unlock()
+	for path, held := range t.locks {
+		kept := held[:0]
+		for _, h := range held {
+			if h.fid != fid {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.locks, path)
+		} else {
+			t.locks[path] = kept
+		}
+	}
+}
+
+// exclTable tracks the open DMEXCL files, keyed by Qid.Path. An
+// exclusive use file may be open by only one fid at a time.
+type exclTable struct {
+	sync.Mutex
+	open map[uint64]bool
+}
+
+// acquire marks the file with Qid.Path path open, returning false if it
+// is already open.
+func (t *exclTable) acquire(path uint64) bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.open[path] {
+		return false
+	}
+	if t.open == nil {
+		t.open = make(map[uint64]bool)
+	}
+	t.open[path] = true
+	return true
+}
+
+func (t *exclTable) release(path uint64) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.open, path)
+}
@@ -10,17 +10,12 @@ const (
 	ugo_other = iota
 )
 
-func userInGroup(user string, group string) bool {
-	// For now groups and users are equivalent.
-	return user == group
-}
-
-func userRelation(user string, f FSNode) uint8 {
+func userRelation(db UserDB, user string, f FSNode) uint8 {
 	st := f.Stat()
 	if user == st.Uid {
 		return ugo_user
 	}
-	if userInGroup(user, st.Gid) {
+	if db.IsMember(user, st.Gid) {
 		return ugo_group
 	}
 	return ugo_other
@@ -50,8 +45,8 @@ func omodePermits(perm uint8, omode proto.Mode) bool {
 	return false
 }
 
-func openPermission(f FSNode, user string, omode proto.Mode) bool {
-	switch userRelation(user, f) {
+func openPermission(db UserDB, f FSNode, user string, omode proto.Mode) bool {
+	switch userRelation(db, user, f) {
 	case ugo_user:
 		return omodePermits(uint8(f.Stat().Mode>>6)&0x07, omode)
 		break
@@ -15,7 +15,7 @@ type Dir struct {
 	Path string
 }
 
-var _ fs.Dir = &Dir{}
+var _ fs.Renamer = &Dir{}
 
 func (f *Dir) Parent() fs.Dir {
 	if f.Path == "/" {
@@ -60,34 +60,75 @@ func (f *Dir) Stat() proto.Stat {
 }
 
 func (f *Dir) WriteStat(s *proto.Stat) error {
-	current := f.Stat()
-	if s.Mode != current.Mode {
-		return os.Chmod(f.Path, os.FileMode(s.Mode))
+	if err := rename(&f.Path, s.Name); err != nil {
+		return err
 	}
-	if s.Length != current.Length {
-		return os.Truncate(f.Path, int64(s.Length))
+	return writeStat(f.Path, f.Stat(), s)
+}
+
+// rename renames the file at *p to name, and updates *p. If the file has
+// already been renamed, by its Dir's RenameChild, only *p is updated.
+func rename(p *string, name string) error {
+	if name == "" || name == path.Base(*p) {
+		return nil
 	}
-	if s.Name != current.Name {
-		dir := path.Dir(f.Path)
-		newPath := path.Join(dir, s.Name)
-		err := os.Rename(f.Path, newPath)
-		if err != nil {
+	dir := path.Dir(*p)
+	if _, err := os.Lstat(*p); err == nil {
+		if err := (&Dir{dir}).RenameChild(path.Base(*p), name); err != nil {
 			return err
 		}
-		f.Path = newPath
-		return nil
 	}
+	*p = path.Join(dir, name)
+	return nil
+}
+
+// writeStat applies the changes between current, the Stat of the file at
+// p, and s, other than the name.
+func writeStat(p string, current proto.Stat, s *proto.Stat) error {
 	if s.Uid != current.Uid {
-		//log.Printf("OLD Uid: %s NEW Uid: %s\n", current.Uid, s.Uid)
 		return fmt.Errorf("Owner change not implemented")
 	}
 	if s.Gid != current.Gid {
-		//log.Printf("OLD Gid: %s NEW Gid: %s\n", current.Gid, s.Gid)
 		return fmt.Errorf("Group change not implemented")
 	}
+	if s.Mode != current.Mode {
+		if err := os.Chmod(p, os.FileMode(s.Mode)); err != nil {
+			return err
+		}
+	}
+	if s.Length != current.Length {
+		return os.Truncate(p, int64(s.Length))
+	}
 	return nil
 }
 
+// RenameChild renames the file or directory oldname in d to newname. It
+// fails if newname already exists.
+func (d *Dir) RenameChild(oldname, newname string) error {
+	oldPath := path.Join(d.Path, oldname)
+	newPath := path.Join(d.Path, newname)
+	info, err := os.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		// Unlike renaming, linking fails if newPath exists, so the check
+		// is atomic.
+		err := os.Link(oldPath, newPath)
+		if err == nil {
+			return os.Remove(oldPath)
+		}
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists", newname)
+		}
+	}
+	// Directories cannot be linked, nor can files on some filesystems.
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("%s already exists", newname)
+	}
+	return os.Rename(oldPath, newPath)
+}
+
 func (d *Dir) Children() map[string]fs.FSNode {
 	f, err := os.Open(d.Path)
 	defer f.Close()
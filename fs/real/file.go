@@ -1,7 +1,6 @@
 package real
 
 import (
-	"fmt"
 	"hash/crc64"
 	"io"
 	"log"
@@ -62,32 +61,10 @@ func (f *File) Stat() proto.Stat {
 }
 
 func (f *File) WriteStat(s *proto.Stat) error {
-	current := f.Stat()
-	if s.Mode != current.Mode {
-		return os.Chmod(f.Path, os.FileMode(s.Mode))
-	}
-	if s.Length != current.Length {
-		return os.Truncate(f.Path, int64(s.Length))
-	}
-	if s.Name != current.Name {
-		dir := path.Dir(f.Path)
-		newPath := path.Join(dir, s.Name)
-		err := os.Rename(f.Path, newPath)
-		if err != nil {
-			return err
-		}
-		f.Path = newPath
-		return nil
-	}
-	if s.Uid != current.Uid {
-		//log.Printf("OLD Uid: %s NEW Uid: %s\n", current.Uid, s.Uid)
-		return fmt.Errorf("Owner change not implemented")
-	}
-	if s.Gid != current.Gid {
-		//log.Printf("OLD Gid: %s NEW Gid: %s\n", current.Gid, s.Gid)
-		return fmt.Errorf("Group change not implemented")
+	if err := rename(&f.Path, s.Name); err != nil {
+		return err
 	}
-	return nil
+	return writeStat(f.Path, f.Stat(), s)
 }
 
 func convertFlag(mode proto.Mode) int {
@@ -2,10 +2,12 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math"
+	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/knusbaum/go9p"
 	"github.com/knusbaum/go9p/proto"
@@ -16,6 +18,7 @@ type fidInfo struct {
 	openMode   proto.Mode
 	openOffset uint64
 	uname      string // uname inherited during walk.
+	excl       bool   // Holds the DMEXCL file open.
 	extra      interface{}
 }
 
@@ -36,10 +39,13 @@ func (i *fidInfo) deriveInfo(n FSNode) *fidInfo {
 }
 
 type conn struct {
-	connID uint32
-	fids   sync.Map
-	tags   sync.Map
-	msize  uint32
+	server  *server
+	connID  uint32
+	fids    sync.Map
+	tags    sync.Map
+	msize   uint32
+	dialect proto.Dialect
+	nuname  uint32 // numeric uid sent by a 9P2000.u or 9P2000.L attach.
 }
 
 type ctxCancel struct {
@@ -66,6 +72,21 @@ func (c *conn) TagContext(tag uint16) context.Context {
 	return ctxc.ctx
 }
 
+// Close clunks every fid the client left behind, so that open Files
+// are closed when the connection ends.
+func (c *conn) Close() error {
+	var err error
+	c.fids.Range(func(k, v interface{}) bool {
+		fid := k.(uint32)
+		c.fids.Delete(fid)
+		if cerr := c.server.clunk(c, fid, v.(*fidInfo)); cerr != nil && err == nil {
+			err = cerr
+		}
+		return true
+	})
+	return err
+}
+
 func (c *conn) DropContext(tag uint16) {
 	v, ok := c.tags.Load(tag)
 	if !ok {
@@ -76,40 +97,126 @@ func (c *conn) DropContext(tag uint16) {
 	ctxc.cancel()
 }
 
+// iounit returns the largest read or write that fits in a message.
+func (c *conn) iounit() uint32 {
+	if c.msize <= proto.IOHdrSize {
+		return proto.IOUnit
+	}
+	return c.msize - proto.IOHdrSize
+}
+
+// tagContext returns the context of the request with tag tag, without
+// creating one if the request has none.
+func (c *conn) tagContext(tag uint16) context.Context {
+	v, ok := c.tags.Load(tag)
+	if !ok {
+		return context.Background()
+	}
+	return v.(*ctxCancel).ctx
+}
+
+// openFile opens f for fid, preferring OpenContext if f is a ContextFile.
+func (c *conn) openFile(tag uint16, fid uint32, info *fidInfo, f File, mode proto.Mode) error {
+	if cf, ok := f.(ContextFile); ok {
+		return cf.OpenContext(c.tagContext(tag), Caller{c.toConnFid(fid), info.uname}, mode)
+	}
+	return f.Open(c.toConnFid(fid), mode)
+}
+
+// readFile reads from f for fid, preferring ReadContext if f is a
+// ContextFile.
+func (c *conn) readFile(tag uint16, fid uint32, info *fidInfo, f File, offset, count uint64) ([]byte, error) {
+	if cf, ok := f.(ContextFile); ok {
+		return cf.ReadContext(c.tagContext(tag), Caller{c.toConnFid(fid), info.uname}, offset, count)
+	}
+	return f.Read(c.toConnFid(fid), offset, count)
+}
+
+// writeFile writes to f for fid, preferring WriteContext if f is a
+// ContextFile.
+func (c *conn) writeFile(tag uint16, fid uint32, info *fidInfo, f File, offset uint64, data []byte) (uint32, error) {
+	if cf, ok := f.(ContextFile); ok {
+		return cf.WriteContext(c.tagContext(tag), Caller{c.toConnFid(fid), info.uname}, offset, data)
+	}
+	return f.Write(c.toConnFid(fid), offset, data)
+}
+
+// nobody is the numeric id reported for users and groups that have none.
+const nobody = 65534
+
+// numericID maps the user or group name to a numeric id for the
+// dialects that carry them. uname is the user the connection is acting for.
+func (c *conn) numericID(uname, name string) uint32 {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id)
+	}
+	if name == uname && c.nuname != proto.NoUid {
+		return c.nuname
+	}
+	return nobody
+}
+
+// stat returns the Stat of n, with the numeric ids filled in when
+// speaking 9P2000.u.
+func (c *conn) stat(uname string, n FSNode) proto.Stat {
+	st := n.Stat()
+	if c.dialect == proto.DotU {
+		st.NUid = c.numericID(uname, st.Uid)
+		st.NGid = c.numericID(uname, st.Gid)
+		st.NMuid = c.numericID(uname, st.Muid)
+	}
+	return st
+}
+
 type server struct {
 	fs         *FS
 	currConnId uint32
+	locks      lockTable
+	excl       exclTable
 }
 
 // Server returns a go9p.Srv instance which will
-// serve the 9p2000 protocol.
+// serve the 9p2000 protocol. Clients may also negotiate 9P2000.u,
+// and since the returned value implements go9p.LSrv, 9P2000.L.
 func (fs *FS) Server() go9p.Srv {
 	return &server{fs: fs}
 }
 
+// Ordering makes the requests on each fid be handled in the order they
+// arrive, which Files such as streams depend on.
+func (s *server) Ordering() go9p.Ordering {
+	return go9p.FidOrdered
+}
+
 func (s *server) NewConn() go9p.Conn {
-	s.currConnId += 1
-	return &conn{connID: s.currConnId}
+	id := atomic.AddUint32(&s.currConnId, 1)
+	return &conn{server: s, connID: id, nuname: proto.NoUid}
 }
 
 func (_ *server) Version(gc go9p.Conn, t *proto.TRVersion) (proto.FCall, error) {
-	var reply proto.TRVersion
-	if t.Type == proto.Tversion && t.Version == "9P2000" {
-		if t.Msize > proto.MaxMsgLen {
-			t.Msize = proto.MaxMsgLen
-		}
-		gc.(*conn).msize = t.Msize
-		reply = *t
-		reply.Type = proto.Rversion
-		return &reply, nil
-	} else {
+	if t.Type != proto.Tversion {
 		return nil, fmt.Errorf("Cannot reply to type %d\n", t.Type)
 	}
+	reply := *t
+	reply.Type = proto.Rversion
+	d, ok := proto.DialectOf(t.Version)
+	if !ok {
+		reply.Version = "unknown"
+		return &reply, nil
+	}
+	if t.Msize > proto.MaxMsize {
+		reply.Msize = proto.MaxMsize
+	}
+	c := gc.(*conn)
+	c.msize = reply.Msize
+	c.dialect = d
+	reply.Version = d.Version()
+	return &reply, nil
 }
 
 func (s *server) Auth(gc go9p.Conn, t *proto.TAuth) (proto.FCall, error) {
 	if s.fs.authFunc == nil {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Authentication Not Supported."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Authentication Not Supported.", proto.EOPNOTSUPP}, nil
 	}
 	c := gc.(*conn)
 
@@ -121,13 +228,12 @@ func (s *server) Auth(gc go9p.Conn, t *proto.TAuth) (proto.FCall, error) {
 
 	err := authFile.Open(c.toConnFid(t.Afid), proto.Ordwr)
 	if err != nil {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 	}
 	info := &fidInfo{
 		n:        authFile,
 		openMode: proto.Ordwr,
 	}
-	log.Printf("Storing info in C: %p, t.Afid: %d\n", c, t.Afid)
 	c.fids.Store(t.Afid, info)
 
 	go func() {
@@ -145,26 +251,30 @@ func (s *server) Auth(gc go9p.Conn, t *proto.TAuth) (proto.FCall, error) {
 
 func (s *server) Attach(gc go9p.Conn, t *proto.TAttach) (proto.FCall, error) {
 	c := gc.(*conn)
+	if t.NUname != proto.NoUid {
+		c.nuname = t.NUname
+		if t.Uname == "" {
+			t.Uname = strconv.FormatUint(uint64(t.NUname), 10)
+		}
+	}
 
 	if s.fs.authFunc == nil {
-		log.Printf("%s attached", t.Uname)
 		c.fids.Store(t.Fid, newFidInfo(t.Uname, s.fs.Root))
 		return &proto.RAttach{proto.Header{proto.Rattach, t.Tag}, s.fs.Root.Stat().Qid}, nil
 	}
 
-	log.Printf("Loading info from C: %p, t.Afid: %d\n", c, t.Afid)
 	i, ok := c.fids.Load(t.Afid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Not Authenticated."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Not Authenticated.", proto.EACCES}, nil
 	}
 	info := i.(*fidInfo)
 	if err, ok := info.extra.(error); ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 	}
 
 	authName, ok := info.extra.(string)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Not Authenticated."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Not Authenticated.", proto.EACCES}, nil
 	}
 	// TODO: For some reason, these don't seem to need to match.
 	// User is authenticated as ai.Cuid, *not* necessarily as t.Uname.
@@ -179,10 +289,15 @@ func (s *server) Walk(gc go9p.Conn, t *proto.TWalk) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 	file := info.n
+	// Walking out of or within a directory requires permission to search
+	// it.
+	if t.Nwname > 0 && !s.searchPermission(info, file) {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied.", proto.EACCES}, nil
+	}
 	if t.Nwname > 0 && t.Wname[0] == ".." {
 		parent := file.Parent()
 		if parent != nil {
@@ -205,57 +320,72 @@ func (s *server) Walk(gc go9p.Conn, t *proto.TWalk) (proto.FCall, error) {
 	qids := make([]proto.Qid, 0)
 	for i := 0; i < int(t.Nwname); i++ {
 		if dir, ok := file.(Dir); ok {
+			if i > 0 && !s.searchPermission(info, dir) {
+				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied.", proto.EACCES}, nil
+			}
 			file, ok = dir.Children()[t.Wname[i]]
 			if !ok {
 				if s.fs.WalkFail == nil {
-					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "No such path"}, nil
+					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "No such path", proto.ENOENT}, nil
 				}
 				f, err := s.fs.WalkFail(s.fs, dir, t.Wname[i])
 				if err != nil {
-					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 				}
 				if f == nil {
-					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "No such path"}, nil
+					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "No such path", proto.ENOENT}, nil
 				}
 				modDir, ok := dir.(ModDir)
 				if !ok {
-					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, fmt.Sprintf("%s does not support modification.", FullPath(dir))}, nil
+					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, fmt.Sprintf("%s does not support modification.", FullPath(dir)), proto.EOPNOTSUPP}, nil
 				}
 				err = modDir.AddChild(f)
 				if err != nil {
-					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+					return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 				}
 				file = f
 			}
 			qids = append(qids, file.Stat().Qid)
 		} else {
-			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "No such path"}, nil
+			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "No such path", proto.ENOENT}, nil
 		}
 	}
 	c.fids.Store(t.Newfid, info.deriveInfo(file))
 	return &proto.RWalk{proto.Header{proto.Rwalk, t.Tag}, uint16(len(qids)), qids}, nil
 }
 
+// searchPermission reports whether info.uname may walk within n, if n is
+// a directory.
+func (s *server) searchPermission(info *fidInfo, n FSNode) bool {
+	if _, ok := n.(Dir); !ok || s.fs.ignorePerms {
+		return true
+	}
+	return openPermission(s.fs.userDB(), n, info.uname, proto.Oexec)
+}
+
 func (s *server) Open(gc go9p.Conn, t *proto.TOpen) (proto.FCall, error) {
 	c := gc.(*conn)
 	//info, ok := c.fids[t.Fid]
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 	if info.openMode != proto.None {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Fid already open."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Fid already open.", proto.EBADF}, nil
+	}
+	if !s.fs.ignorePerms && !openPermission(s.fs.userDB(), info.n, info.uname, t.Mode&0x0F) {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied.", proto.EACCES}, nil
 	}
-	if !s.fs.ignorePerms && !openPermission(info.n, info.uname, t.Mode&0x0F) {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+	if err := s.checkOpenFlags(info, t.Mode); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 	}
 
 	switch n := info.n.(type) {
 	case Dir:
 		if (t.Mode&0x0F) == proto.Owrite ||
 			(t.Mode&0x0F) == proto.Ordwr {
-			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot write to directory."}, nil
+			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot write to directory.", proto.EISDIR}, nil
 		}
 		children := n.Children()
 		cl := make([]FSNode, 0)
@@ -264,26 +394,32 @@ func (s *server) Open(gc go9p.Conn, t *proto.TOpen) (proto.FCall, error) {
 		}
 		info.extra = cl
 	case File:
-		err := n.Open(c.toConnFid(t.Fid), t.Mode)
+		err := s.open(c, t.Tag, t.Fid, info, n, t.Mode)
 		if err != nil {
-			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 		}
 	}
 	info.openMode = t.Mode
 	info.openOffset = info.n.Stat().Length
 
-	return &proto.ROpen{proto.Header{proto.Ropen, t.Tag}, info.n.Stat().Qid, proto.IOUnit}, nil
+	return &proto.ROpen{proto.Header{proto.Ropen, t.Tag}, info.n.Stat().Qid, c.iounit()}, nil
 }
 
 func (s *server) Create(gc go9p.Conn, t *proto.TCreate) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
-	if !s.fs.ignorePerms && !openPermission(info.n, info.uname, proto.Owrite) {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+	if !s.fs.ignorePerms && !openPermission(s.fs.userDB(), info.n, info.uname, proto.Owrite) {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied.", proto.EACCES}, nil
+	}
+	if t.Perm&(proto.DMSYMLINK|proto.DMDEVICE|proto.DMNAMEDPIPE|proto.DMSOCKET) != 0 {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot create special files.", proto.EOPNOTSUPP}, nil
+	}
+	if err := s.checkOpenFlags(nil, proto.Mode(t.Mode)); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 	}
 
 	if dir, ok := info.n.(Dir); ok {
@@ -303,26 +439,79 @@ func (s *server) Create(gc go9p.Conn, t *proto.TCreate) (proto.FCall, error) {
 			}
 		}
 		if err != nil {
-			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 		}
 		info = info.deriveInfo(new)
 		info.openMode = proto.Mode(t.Mode)
 		info.openOffset = 0
 		c.fids.Store(t.Fid, info)
 		if f, ok := new.(File); ok {
-			err := f.Open(c.toConnFid(t.Fid), proto.Mode(t.Mode))
+			err := s.open(c, t.Tag, t.Fid, info, f, info.openMode)
 			if err != nil {
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+				info.openMode = proto.None
+				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 			}
 		}
-		return &proto.RCreate{proto.Header{proto.Rcreate, t.Tag}, new.Stat().Qid, proto.IOUnit}, nil
+		return &proto.RCreate{proto.Header{proto.Rcreate, t.Tag}, new.Stat().Qid, c.iounit()}, nil
 	} else if f, ok := info.n.(File); ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, f.Stat().Name + ": IS A FILE Not a directory"}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, f.Stat().Name + ": IS A FILE Not a directory", proto.ENOTDIR}, nil
 	} else {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, info.n.Stat().Name + ": Not a directory"}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, info.n.Stat().Name + ": Not a directory", proto.ENOTDIR}, nil
 	}
 }
 
+// checkOpenFlags checks that the node referred to by info may be opened
+// with the flags in mode by info.uname. OTRUNC requires write permission
+// on the node, and ORCLOSE requires write permission on its parent,
+// since it removes the node. Files being created need no permission,
+// and info is nil.
+func (s *server) checkOpenFlags(info *fidInfo, mode proto.Mode) error {
+	if mode&proto.Orclose != 0 {
+		if s.fs.RemoveFile == nil {
+			return errors.New("Cannot delete files.")
+		}
+		if info != nil && !s.fs.ignorePerms {
+			parent := info.n.Parent()
+			if parent == nil || !openPermission(s.fs.userDB(), parent, info.uname, proto.Owrite) {
+				return errors.New("Permission denied.")
+			}
+		}
+	}
+	if mode&proto.Otrunc != 0 && info != nil && !s.fs.ignorePerms {
+		if !openPermission(s.fs.userDB(), info.n, info.uname, proto.Owrite) {
+			return errors.New("Permission denied.")
+		}
+	}
+	return nil
+}
+
+// open opens f for fid with mode, enforcing DMEXCL and OTRUNC, which
+// are handled by the server for every File.
+func (s *server) open(c *conn, tag uint16, fid uint32, info *fidInfo, f File, mode proto.Mode) error {
+	st := f.Stat()
+	if st.Mode&proto.DMEXCL != 0 {
+		if !s.excl.acquire(st.Qid.Uid) {
+			return errors.New("Exclusive use file already open.")
+		}
+		info.excl = true
+	}
+	err := c.openFile(tag, fid, info, f, mode)
+	if err == nil && mode&proto.Otrunc != 0 {
+		// Files may truncate themselves when opened.
+		if st = f.Stat(); st.Length != 0 {
+			st.Length = 0
+			if err = f.WriteStat(&st); err != nil {
+				f.Close(c.toConnFid(fid))
+			}
+		}
+	}
+	if err != nil && info.excl {
+		s.excl.release(st.Qid.Uid)
+		info.excl = false
+	}
+	return err
+}
+
 func (_ *server) Read(gc go9p.Conn, t *proto.TRead) (proto.FCall, error) {
 	c := gc.(*conn)
 	if t.Count > c.msize-11 {
@@ -330,7 +519,7 @@ func (_ *server) Read(gc go9p.Conn, t *proto.TRead) (proto.FCall, error) {
 	}
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 
@@ -339,23 +528,23 @@ func (_ *server) Read(gc go9p.Conn, t *proto.TRead) (proto.FCall, error) {
 	if openmode != proto.Oread &&
 		openmode != proto.Ordwr &&
 		openmode != proto.Oexec {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "1File not opened."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "1File not opened.", proto.EBADF}, nil
 	}
 
 	switch n := info.n.(type) {
 	case File:
-		data, err := n.Read(c.toConnFid(t.Fid), t.Offset, uint64(t.Count))
+		data, err := c.readFile(t.Tag, t.Fid, info, n, t.Offset, uint64(t.Count))
 		if err != nil {
-			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 		}
 		return &proto.RRead{proto.Header{proto.Rread, t.Tag}, uint32(len(data)), data}, nil
 	case Dir:
-		return readDir(t, info), nil
+		return readDir(c, t, info), nil
 	}
-	return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "2File not opened."}, nil
+	return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "2File not opened.", proto.EBADF}, nil
 }
 
-func readDir(t *proto.TRead, info *fidInfo) proto.FCall {
+func readDir(c *conn, t *proto.TRead, info *fidInfo) proto.FCall {
 	contents := make([]byte, 0)
 	children := info.extra.([]FSNode)
 
@@ -363,9 +552,9 @@ func readDir(t *proto.TRead, info *fidInfo) proto.FCall {
 
 	// determine which child to start with based on read offset.
 	startIndex := -1
-	for i, c := range children {
-		st := c.Stat()
-		nextLength := uint64(st.ComposeLength())
+	for i, child := range children {
+		st := c.stat(info.uname, child)
+		nextLength := uint64(st.ComposeLengthDialect(c.dialect))
 		if length+nextLength > t.Offset {
 			startIndex = i
 			break
@@ -379,45 +568,50 @@ func readDir(t *proto.TRead, info *fidInfo) proto.FCall {
 	}
 
 	for _, f := range children[startIndex:] {
-		st := f.Stat()
-		nextLength := uint32(st.ComposeLength())
+		st := c.stat(info.uname, f)
+		nextLength := uint32(st.ComposeLengthDialect(c.dialect))
 		if uint32(len(contents))+nextLength > t.Count {
 			break
 		}
-		contents = append(contents, st.Compose()...)
+		contents = st.AppendComposeDialect(contents, c.dialect)
 	}
 	return &proto.RRead{proto.Header{proto.Rread, t.Tag}, uint32(len(contents)), contents}
 }
 
-func (_ *server) Write(gc go9p.Conn, t *proto.TWrite) (proto.FCall, error) {
+func (s *server) Write(gc go9p.Conn, t *proto.TWrite) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
 		// TODO: Handle Auth
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 
 	if (info.openMode&0x0F) != proto.Owrite &&
 		(info.openMode&0x0F) != proto.Ordwr {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "File not opened for write."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "File not opened for write.", proto.EBADF}, nil
 	} else if (info.n.Stat().Mode & proto.DMDIR) != 0 {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot write to directory."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot write to directory.", proto.EISDIR}, nil
 	}
 
 	offset := t.Offset
+	if st := info.n.Stat(); st.Mode&proto.DMAPPEND != 0 {
+		// Writes to append only files go to the end, whatever the
+		// offset.
+		offset = st.Length
+	}
 	if f, ok := info.n.(File); ok {
-		n, err := f.Write(c.toConnFid(t.Fid), offset, t.Data)
+		n, err := c.writeFile(t.Tag, t.Fid, info, f, offset, t.Data)
 		if err != nil {
-			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+			return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 		}
 		return &proto.RWrite{proto.Header{proto.Rwrite, t.Tag}, n}, nil
 	} else {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot write to directory."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Cannot write to directory.", proto.EISDIR}, nil
 	}
 }
 
-func (_ *server) Clunk(gc go9p.Conn, t *proto.TClunk) (proto.FCall, error) {
+func (s *server) Clunk(gc go9p.Conn, t *proto.TClunk) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	c.fids.Delete(t.Fid)
@@ -426,51 +620,88 @@ func (_ *server) Clunk(gc go9p.Conn, t *proto.TClunk) (proto.FCall, error) {
 	}
 	info := i.(*fidInfo)
 
-	if info.openMode != proto.None {
-		if f, ok := info.n.(File); ok {
-			err := f.Close(c.toConnFid(t.Fid))
-			if err != nil {
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
-			}
-		}
+	if err := s.clunk(c, t.Fid, info); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 	}
 	return &proto.RClunk{proto.Header{proto.Rclunk, t.Tag}}, nil
 }
 
+// clunk releases the resources held by fid, which has already been
+// removed from c.fids.
+func (s *server) clunk(c *conn, fid uint32, info *fidInfo) error {
+	s.locks.release(c.toConnFid(fid))
+	if info.openMode == proto.None {
+		return nil
+	}
+	var err error
+	if f, ok := info.n.(File); ok {
+		err = f.Close(c.toConnFid(fid))
+	}
+	if info.excl {
+		s.excl.release(info.n.Stat().Qid.Uid)
+	}
+	if info.openMode&proto.Orclose != 0 {
+		// Permission to remove was checked when the fid was opened.
+		if rerr := s.fs.RemoveFile(s.fs, info.n); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
 func (s *server) Remove(gc go9p.Conn, t *proto.TRemove) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	c.fids.Delete(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 
-	if !s.fs.ignorePerms && !openPermission(info.n, info.uname, proto.Owrite) {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
-	}
-
-	var err error
-	if s.fs.RemoveFile != nil {
-		err = s.fs.RemoveFile(s.fs, info.n)
-	} else {
-		err = fmt.Errorf("Cannot delete files.")
+	// The fid is clunked even if the remove fails.
+	err := s.remove(info)
+	if err == nil {
+		info.openMode &^= proto.Orclose
 	}
+	s.clunk(c, t.Fid, info)
 	if err != nil {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
 	}
 	return &proto.RRemove{proto.Header{proto.Rremove, t.Tag}}, nil
 }
 
+// remove removes the node referred to by info, on behalf of info.uname,
+// who must have write permission in its parent directory.
+func (s *server) remove(info *fidInfo) error {
+	if !s.fs.ignorePerms && !s.parentPermission(info) {
+		return errors.New("Permission denied.")
+	}
+	if s.fs.RemoveFile == nil {
+		return errors.New("Cannot delete files.")
+	}
+	return s.fs.RemoveFile(s.fs, info.n)
+}
+
+// parentPermission reports whether info.uname may write in the parent
+// directory of the node referred to by info, to remove or rename it. The
+// root has no parent, and cannot be removed or renamed.
+func (s *server) parentPermission(info *fidInfo) bool {
+	parent := info.n.Parent()
+	if parent == nil {
+		return false
+	}
+	return openPermission(s.fs.userDB(), parent, info.uname, proto.Owrite)
+}
+
 func (_ *server) Stat(gc go9p.Conn, t *proto.TStat) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 
-	return &proto.RStat{proto.Header{proto.Rstat, t.Tag}, info.n.Stat()}, nil
+	return &proto.RStat{proto.Header{proto.Rstat, t.Tag}, c.stat(info.uname, info.n)}, nil
 }
 
 /* The name can be changed by anyone with write permission in
@@ -513,56 +744,81 @@ func (s *server) Wstat(gc go9p.Conn, t *proto.TWstat) (proto.FCall, error) {
 	c := gc.(*conn)
 	i, ok := c.fids.Load(t.Fid)
 	if !ok {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid."}, nil
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Bad Fid.", proto.EBADF}, nil
 	}
 	info := i.(*fidInfo)
 
+	if c.dialect == proto.DotU && len(t.Stat.Gid) == 0 && t.Stat.NGid != proto.NoUid {
+		t.Stat.Gid = strconv.FormatUint(uint64(t.Stat.NGid), 10)
+	}
+	if err := s.wstat(info, &t.Stat); err != nil {
+		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error(), 0}, nil
+	}
+	return &proto.RWstat{proto.Header{proto.Rwstat, t.Tag}}, nil
+}
+
+// wstat applies newstat to the node referred to by info, on behalf of
+// info.uname, following the rules described above.
+func (s *server) wstat(info *fidInfo, newstat *proto.Stat) error {
 	stat := info.n.Stat()
-	newstat := &t.Stat
-	relation := userRelation(info.uname, info.n)
+	db := s.fs.userDB()
+	relation := userRelation(db, info.uname, info.n)
+	// The owner and the leader of the file's group may change its mode,
+	// mtime and group.
+	owner := relation == ugo_user
+	leader := db.IsLeader(info.uname, stat.Gid)
 
 	{
 		// Need to check all this stuff before we change *ANYTHING*
 		// The server needs to accept ALL the changes or none of them.
-		if len(newstat.Name) != 0 {
-			if !s.fs.ignorePerms && relation != ugo_user {
-				log.Println("Can't change name. Not owner.")
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+		if len(newstat.Name) != 0 && newstat.Name != stat.Name {
+			if !s.fs.ignorePerms && !s.parentPermission(info) {
+				return errors.New("Permission denied.")
+			}
+			if parent := info.n.Parent(); parent != nil {
+				if _, ok := parent.Children()[newstat.Name]; ok {
+					return errors.New("File already exists.")
+				}
 			}
 		}
 
 		if newstat.Length != math.MaxUint64 && newstat.Length != stat.Length {
-			if !s.fs.ignorePerms && !openPermission(info.n, info.uname, proto.Owrite) {
-				log.Printf("Can't alter length. Don't have write permission. OLD: %d, NEW: %d\n", stat.Length, newstat.Length)
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+			if !s.fs.ignorePerms && !openPermission(s.fs.userDB(), info.n, info.uname, proto.Owrite) {
+				return errors.New("Permission denied.")
 			}
 		}
 
 		if newstat.Mode != math.MaxUint32 && newstat.Mode != stat.Mode {
-			if !s.fs.ignorePerms && relation != ugo_user {
-				log.Printf("Can't alter mode. Not owner. OLD: %#o, NEW: %#o\n", stat.Mode, newstat.Mode)
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+			if !s.fs.ignorePerms && !owner && !leader {
+				return errors.New("Permission denied.")
 			}
 		}
 
 		if newstat.Mtime != math.MaxUint32 && newstat.Mtime != stat.Mtime {
-			if !s.fs.ignorePerms && relation != ugo_user {
-				log.Println("Can't alter mtime. Not owner.")
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+			if !s.fs.ignorePerms && !owner && !leader {
+				return errors.New("Permission denied.")
 			}
 		}
 
-		if len(newstat.Gid) != 0 {
-			if !s.fs.ignorePerms && (info.n.Stat().Uid != info.uname ||
-				!userInGroup(info.uname, newstat.Gid)) {
-				log.Println("Can't changegroup. Not owner or not member of new group.")
-				return &proto.RError{proto.Header{proto.Rerror, t.Tag}, "Permission denied."}, nil
+		if len(newstat.Gid) != 0 && newstat.Gid != stat.Gid {
+			if !s.fs.ignorePerms &&
+				!(owner && db.IsMember(info.uname, newstat.Gid)) &&
+				!(leader && db.IsLeader(info.uname, newstat.Gid)) {
+				return errors.New("Permission denied.")
 			}
 		}
 	}
 
 	// Do the changes.
-	if len(newstat.Name) != 0 {
+	oldName := stat.Name
+	var renamer Renamer
+	if len(newstat.Name) != 0 && newstat.Name != stat.Name {
+		if r, ok := info.n.Parent().(Renamer); ok {
+			if err := r.RenameChild(stat.Name, newstat.Name); err != nil {
+				return err
+			}
+			renamer = r
+		}
 		stat.Name = newstat.Name
 	}
 
@@ -584,8 +840,12 @@ func (s *server) Wstat(gc go9p.Conn, t *proto.TWstat) (proto.FCall, error) {
 	}
 
 	if err := info.n.WriteStat(&stat); err != nil {
-		return &proto.RError{proto.Header{proto.Rerror, t.Tag}, err.Error()}, nil
+		if renamer != nil {
+			// The node rejected the other changes, so the rename is
+			// undone too.
+			renamer.RenameChild(stat.Name, oldName)
+		}
+		return err
 	}
-	return &proto.RWstat{proto.Header{proto.Rwstat, t.Tag}}, nil
-
+	return nil
 }
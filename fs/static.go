@@ -16,6 +16,11 @@ type StaticFile struct {
 	Data []byte
 }
 
+// MaxStaticLength is the largest length a client may extend a
+// StaticFile to, by writing or with a wstat, since its Data is held in
+// memory.
+var MaxStaticLength uint64 = 1 << 30
+
 // NewStaticFile returns a StaticFile that contains the
 // byte slice data.
 func NewStaticFile(s *proto.Stat, data []byte) *StaticFile {
@@ -33,6 +38,23 @@ func (f *StaticFile) Stat() proto.Stat {
 	return f.fStat
 }
 
+// WriteStat sets the file's Stat. Changing its Length truncates or
+// extends Data.
+func (f *StaticFile) WriteStat(s *proto.Stat) error {
+	f.Lock()
+	defer f.Unlock()
+	if s.Length > MaxStaticLength && s.Length > uint64(len(f.Data)) {
+		return fmt.Errorf("Length %d is larger than %d.", s.Length, MaxStaticLength)
+	}
+	if s.Length < uint64(len(f.Data)) {
+		f.Data = f.Data[:s.Length]
+	} else if s.Length > uint64(len(f.Data)) {
+		f.Data = append(f.Data, make([]byte, s.Length-uint64(len(f.Data)))...)
+	}
+	f.fStat = *s
+	return nil
+}
+
 func (f *StaticFile) Open(fid uint64, omode proto.Mode) error {
 	if omode&proto.Otrunc > 0 {
 		f.Lock()
@@ -60,8 +82,11 @@ func (f *StaticFile) Write(fid uint64, offset uint64, data []byte) (uint32, erro
 	defer f.Unlock()
 	flen := uint64(len(f.Data))
 	count := uint64(len(data))
-	if offset+count > flen {
+	if offset > flen || offset+count > flen {
 		newlen := offset + count
+		if offset > MaxStaticLength || newlen > MaxStaticLength {
+			return 0, fmt.Errorf("Writing at %d is past the largest length, %d.", offset, MaxStaticLength)
+		}
 		f.fStat.Length = newlen
 		// TODO: Maybe this can be optimized
 		f.Data = append(f.Data, make([]byte, newlen-flen)...)
@@ -157,6 +182,31 @@ func (d *StaticDir) DeleteChild(name string) error {
 	return nil
 }
 
+// RenameChild renames the child named oldname to newname. It fails if
+// there is already a child named newname.
+func (d *StaticDir) RenameChild(oldname, newname string) error {
+	if oldname == newname {
+		return nil
+	}
+	d.Lock()
+	defer d.Unlock()
+	var child FSNode
+	for _, c := range d.children {
+		switch c.Stat().Name {
+		case newname:
+			return fmt.Errorf("%s already exists", newname)
+		case oldname:
+			child = c
+		}
+	}
+	if child == nil {
+		return fmt.Errorf("%s does not exist", oldname)
+	}
+	stat := child.Stat()
+	stat.Name = newname
+	return child.WriteStat(&stat)
+}
+
 // CreateStaticFile is a function meant to be passed to WithCreateFile.
 // It will add an empty StaticFile to the FS whenever a client attempts to
 // create a file.
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -65,14 +66,22 @@ func (f *StreamFile) Open(fid uint64, omode proto.Mode) error {
 	return nil
 }
 
+func (f *StreamFile) OpenContext(ctx context.Context, c Caller, omode proto.Mode) error {
+	return f.Open(c.Fid, omode)
+}
+
 func (f *StreamFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	return f.ReadContext(context.Background(), Caller{Fid: fid}, offset, count)
+}
+
+func (f *StreamFile) ReadContext(ctx context.Context, c Caller, offset uint64, count uint64) ([]byte, error) {
 	bs := make([]byte, count)
-	r, ok := f.fidReader[fid]
+	r, ok := f.fidReader[c.Fid]
 	if !ok {
 		// This really shouldn't happen.
 		return nil, fmt.Errorf("Failed to read stream. Not opened for read.")
 	}
-	n, err := r.Read(bs)
+	n, err := readStream(ctx, r, bs)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +93,10 @@ func (f *StreamFile) Write(fid uint64, offset uint64, data []byte) (uint32, erro
 	return 0, errors.New("Cannot write to this stream.")
 }
 
+func (f *StreamFile) WriteContext(ctx context.Context, c Caller, offset uint64, data []byte) (uint32, error) {
+	return f.Write(c.Fid, offset, data)
+}
+
 func (f *StreamFile) Close(fid uint64) error {
 	r, ok := f.fidReader[fid]
 	if ok {
@@ -104,14 +117,22 @@ func (f *BiDiStreamFile) Open(fid uint64, omode proto.Mode) error {
 	return nil
 }
 
+func (f *BiDiStreamFile) OpenContext(ctx context.Context, c Caller, omode proto.Mode) error {
+	return f.Open(c.Fid, omode)
+}
+
 func (f *BiDiStreamFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	return f.ReadContext(context.Background(), Caller{Fid: fid}, offset, count)
+}
+
+func (f *BiDiStreamFile) ReadContext(ctx context.Context, c Caller, offset uint64, count uint64) ([]byte, error) {
 	bs := make([]byte, count)
-	r, ok := f.fidReader[fid]
+	r, ok := f.fidReader[c.Fid]
 	if !ok {
 		// This really shouldn't happen.
 		return nil, fmt.Errorf("Failed to read stream. Server error.")
 	}
-	n, err := r.Read(bs)
+	n, err := readStream(ctx, r, bs)
 	if err != nil {
 		return nil, err
 	}
@@ -120,12 +141,16 @@ func (f *BiDiStreamFile) Read(fid uint64, offset uint64, count uint64) ([]byte,
 }
 
 func (f *BiDiStreamFile) Write(fid uint64, offset uint64, data []byte) (uint32, error) {
-	r, ok := f.fidReader[fid]
+	return f.WriteContext(context.Background(), Caller{Fid: fid}, offset, data)
+}
+
+func (f *BiDiStreamFile) WriteContext(ctx context.Context, c Caller, offset uint64, data []byte) (uint32, error) {
+	r, ok := f.fidReader[c.Fid]
 	if !ok {
 		// This really shouldn't happen.
 		return 0, fmt.Errorf("Failed to write stream. Server error.")
 	}
-	n, err := r.Write(data)
+	n, err := writeStream(ctx, r, data)
 	return uint32(n), err
 }
 
@@ -175,14 +200,22 @@ func (f *PipeFile) Open(fid uint64, omode proto.Mode) error {
 	return nil
 }
 
+func (f *PipeFile) OpenContext(ctx context.Context, c Caller, omode proto.Mode) error {
+	return f.Open(c.Fid, omode)
+}
+
 func (f *PipeFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error) {
+	return f.ReadContext(context.Background(), Caller{Fid: fid}, offset, count)
+}
+
+func (f *PipeFile) ReadContext(ctx context.Context, c Caller, offset uint64, count uint64) ([]byte, error) {
 	bs := make([]byte, count)
-	s, ok := f.fidReader[fid]
+	s, ok := f.fidReader[c.Fid]
 	if !ok {
 		// This really shouldn't happen.
 		return nil, fmt.Errorf("Failed to read stream. Server error.")
 	}
-	n, err := s.srw.Read(bs)
+	n, err := readStream(ctx, s.srw, bs)
 	if err != nil {
 		return nil, err
 	}
@@ -191,12 +224,16 @@ func (f *PipeFile) Read(fid uint64, offset uint64, count uint64) ([]byte, error)
 }
 
 func (f *PipeFile) Write(fid uint64, offset uint64, data []byte) (uint32, error) {
-	s, ok := f.fidReader[fid]
+	return f.WriteContext(context.Background(), Caller{Fid: fid}, offset, data)
+}
+
+func (f *PipeFile) WriteContext(ctx context.Context, c Caller, offset uint64, data []byte) (uint32, error) {
+	s, ok := f.fidReader[c.Fid]
 	if !ok {
 		// This really shouldn't happen.
 		return 0, fmt.Errorf("Failed to write stream. Server error.")
 	}
-	n, err := s.srw.Write(data)
+	n, err := writeStream(ctx, s.srw, data)
 	return uint32(n), err
 }
 
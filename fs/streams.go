@@ -1,7 +1,7 @@
 package fs
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"log"
 	"os"
@@ -32,6 +32,36 @@ type StreamReadWriter interface {
 	Write(p []byte) (n int, err error)
 }
 
+// contextReader is implemented by StreamReaders whose blocking reads
+// can be abandoned. See readStream.
+type contextReader interface {
+	ReadContext(ctx context.Context, p []byte) (n int, err error)
+}
+
+// contextWriter is implemented by StreamReadWriters whose blocking
+// writes can be abandoned. See writeStream.
+type contextWriter interface {
+	WriteContext(ctx context.Context, p []byte) (n int, err error)
+}
+
+// readStream reads from r, giving up with ctx.Err() if ctx is cancelled
+// and r supports it.
+func readStream(ctx context.Context, r StreamReader, p []byte) (int, error) {
+	if cr, ok := r.(contextReader); ok {
+		return cr.ReadContext(ctx, p)
+	}
+	return r.Read(p)
+}
+
+// writeStream writes to w, giving up with ctx.Err() if ctx is cancelled
+// and w supports it.
+func writeStream(ctx context.Context, w StreamReadWriter, p []byte) (int, error) {
+	if cw, ok := w.(contextWriter); ok {
+		return cw.WriteContext(ctx, p)
+	}
+	return w.Write(p)
+}
+
 type chanReader struct {
 	read         chan []byte
 	write        chan []byte
@@ -41,6 +71,10 @@ type chanReader struct {
 }
 
 func (r *chanReader) Read(p []byte) (n int, err error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *chanReader) ReadContext(ctx context.Context, p []byte) (n int, err error) {
 	for len(p) > 0 {
 		if len(r.unread) == 0 {
 			if n > 0 {
@@ -54,7 +88,15 @@ func (r *chanReader) Read(p []byte) (n int, err error) {
 					return
 				}
 			} else {
-				bs, ok := <-r.read
+				var (
+					bs []byte
+					ok bool
+				)
+				select {
+				case bs, ok = <-r.read:
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				}
 				if !ok {
 					// Return 0, nil on EOF.
 					// Returning io.EOF will cause RError response,
@@ -76,6 +118,10 @@ func (r *chanReader) Read(p []byte) (n int, err error) {
 }
 
 func (r *chanReader) Write(p []byte) (n int, err error) {
+	return r.WriteContext(context.Background(), p)
+}
+
+func (r *chanReader) WriteContext(ctx context.Context, p []byte) (n int, err error) {
 	bs := make([]byte, len(p))
 	copy(bs, p)
 	select {
@@ -87,6 +133,8 @@ func (r *chanReader) Write(p []byte) (n int, err error) {
 			return len(p), nil
 		case <-r.writerClosed:
 			return 0, io.EOF
+		case <-ctx.Done():
+			return 0, ctx.Err()
 		}
 	}
 }
@@ -223,7 +271,6 @@ func (s *baseStream) Close() error {
 		return nil
 	}
 	for _, reader := range s.readers {
-		fmt.Printf("Closing Reader\n")
 		reader.Close()
 	}
 	s.readers = nil
@@ -362,6 +409,10 @@ type fileReader struct {
 }
 
 func (r *fileReader) Read(p []byte) (n int, err error) {
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *fileReader) ReadContext(ctx context.Context, p []byte) (n int, err error) {
 	if !r.live {
 		return 0, io.EOF
 	}
@@ -379,6 +430,8 @@ func (r *fileReader) Read(p []byte) (n int, err error) {
 				return 0, io.EOF
 			}
 		case <-r.t.C:
+		case <-ctx.Done():
+			return 0, ctx.Err()
 		}
 	}
 }
@@ -521,7 +574,15 @@ type singleStreamReader struct {
 }
 
 func (r *singleStreamReader) Read(p []byte) (n int, err error) {
-	<-r.ss.readsem
+	return r.ReadContext(context.Background(), p)
+}
+
+func (r *singleStreamReader) ReadContext(ctx context.Context, p []byte) (n int, err error) {
+	select {
+	case <-r.ss.readsem:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
 	select {
 	case <-r.ss.closed:
 		return 0, nil
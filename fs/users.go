@@ -0,0 +1,179 @@
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// UserDB answers questions about users and groups for permission
+// checks. Every user is also a group of the same name, of which they are
+// the only member and the leader.
+//
+// IsMember reports whether user belongs to group. Members of a file's
+// group are granted the group permissions of the file.
+//
+// IsLeader reports whether user is a leader of group. The leader of a
+// file's group may change its mode, mtime and group, as the owner may.
+type UserDB interface {
+	IsMember(user, group string) bool
+	IsLeader(user, group string) bool
+}
+
+// Group describes the members of a group in a StaticUserDB.
+type Group struct {
+	// Leader is the group's leader. If Leader is empty, every member of
+	// the group is a leader.
+	Leader  string
+	Members []string
+}
+
+// StaticUserDB is a UserDB holding a fixed set of groups, keyed by
+// group name. A nil StaticUserDB holds no groups but those of each user,
+// and is the UserDB used by an FS if none is configured.
+type StaticUserDB map[string]Group
+
+func (db StaticUserDB) IsMember(user, group string) bool {
+	if user == group {
+		return true
+	}
+	g, ok := db[group]
+	if !ok {
+		return false
+	}
+	if g.Leader == user {
+		return true
+	}
+	for _, m := range g.Members {
+		if m == user {
+			return true
+		}
+	}
+	return false
+}
+
+func (db StaticUserDB) IsLeader(user, group string) bool {
+	g, ok := db[group]
+	if !ok {
+		return user == group
+	}
+	if g.Leader == "" {
+		return db.IsMember(user, group)
+	}
+	return g.Leader == user
+}
+
+// ParseUsers reads a Plan 9 users file, such as /adm/users, from r. Each
+// line of the file has the form
+//
+//	id:name:leader:members
+//
+// where members is a comma separated list of users. See users(6).
+func ParseUsers(r io.Reader) (StaticUserDB, error) {
+	db := make(StaticUserDB)
+	err := parseLines(r, func(fields []string) error {
+		if len(fields) != 4 {
+			return fmt.Errorf("expected 4 fields, got %d", len(fields))
+		}
+		db[fields[1]] = Group{Leader: fields[2], Members: splitList(fields[3])}
+		return nil
+	})
+	return db, err
+}
+
+// ParseGroups reads a Unix group file, such as /etc/group, from r. Each
+// line of the file has the form
+//
+//	name:password:gid:members
+//
+// Unix groups have no leader, so every member is a leader.
+func ParseGroups(r io.Reader) (StaticUserDB, error) {
+	db := make(StaticUserDB)
+	err := parseLines(r, func(fields []string) error {
+		if len(fields) != 4 {
+			return fmt.Errorf("expected 4 fields, got %d", len(fields))
+		}
+		g := db[fields[0]]
+		g.Members = append(g.Members, splitList(fields[3])...)
+		db[fields[0]] = g
+		return nil
+	})
+	return db, err
+}
+
+// LoadUsers returns a StaticUserDB holding the users file at path. See
+// ParseUsers.
+func LoadUsers(path string) (StaticUserDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseUsers(f)
+}
+
+// HostUserDB returns a StaticUserDB holding the groups of the host, read
+// from /etc/group. Users also belong to their primary group, from
+// /etc/passwd.
+func HostUserDB() (StaticUserDB, error) {
+	f, err := os.Open("/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := ParseGroups(f)
+	if err != nil {
+		return nil, err
+	}
+	gids := make(map[string]string)
+	f.Seek(0, io.SeekStart)
+	parseLines(f, func(fields []string) error {
+		if len(fields) >= 3 {
+			gids[fields[2]] = fields[0]
+		}
+		return nil
+	})
+
+	pf, err := os.Open("/etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	defer pf.Close()
+	err = parseLines(pf, func(fields []string) error {
+		if len(fields) < 4 {
+			return fmt.Errorf("expected at least 4 fields, got %d", len(fields))
+		}
+		if name, ok := gids[fields[3]]; ok {
+			g := db[name]
+			g.Members = append(g.Members, fields[0])
+			db[name] = g
+		}
+		return nil
+	})
+	return db, err
+}
+
+// parseLines calls f with the colon separated fields of each line of r,
+// skipping blank lines and comments.
+func parseLines(r io.Reader, f func(fields []string) error) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := f(strings.Split(line, ":")); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	return s.Err()
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
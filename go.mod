@@ -1,6 +1,6 @@
 module github.com/knusbaum/go9p
 
-go 1.13
+go 1.16
 
 require (
 	9fans.net/go v0.0.2
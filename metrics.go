@@ -0,0 +1,299 @@
+package go9p
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// LatencyBuckets are the upper bounds of the buckets of the latency
+// histograms kept by Metrics.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// A Histogram counts observed latencies. Counts[i] is the number of
+// latencies no greater than LatencyBuckets[i]; the last element counts
+// every latency.
+type Histogram struct {
+	Counts []uint64
+	Sum    time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(LatencyBuckets)+1)
+	}
+	for i, b := range LatencyBuckets {
+		if d <= b {
+			h.Counts[i]++
+		}
+	}
+	h.Counts[len(LatencyBuckets)]++
+	h.Sum += d
+}
+
+func (h Histogram) copy() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// CallStats are the statistics of requests of a single message type.
+type CallStats struct {
+	Count   uint64 // Requests answered.
+	Errors  uint64 // Requests answered with Rerror or Rlerror.
+	Latency Histogram
+}
+
+// ConnStats are the statistics of a single connection.
+type ConnStats struct {
+	Requests uint64
+	Errors   uint64
+	OpenFids int64
+}
+
+// A MetricsSnapshot is a copy of the statistics kept by Metrics.
+type MetricsSnapshot struct {
+	// Calls holds the statistics of each message type, keyed by the
+	// name of the request type, such as "Tread".
+	Calls map[string]CallStats
+	// Conns holds the statistics of each open connection, keyed by
+	// connection id.
+	Conns            map[uint64]ConnStats
+	TotalConnections uint64
+	OpenFids         int64
+	// Failures counts Events of kind EventError.
+	Failures uint64
+}
+
+// Metrics counts the requests, errors, latencies, connections and open
+// fids of a server or client. Metrics is a Tracer, and is updated from
+// the Events passed to it. It may be set as the Metrics of a Server, or
+// passed to a client with client.WithMetrics. A Metrics should not be
+// shared between servers and clients, since the two see requests from
+// opposite ends.
+type Metrics struct {
+	mu       sync.Mutex
+	calls    map[uint8]*CallStats
+	conns    map[uint64]*ConnStats
+	total    uint64
+	failures uint64
+}
+
+// NewMetrics returns a new Metrics with no requests counted.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		calls: make(map[uint8]*CallStats),
+		conns: make(map[uint64]*ConnStats),
+	}
+}
+
+func (m *Metrics) conn(id uint64) *ConnStats {
+	c, ok := m.conns[id]
+	if !ok {
+		c = &ConnStats{}
+		m.conns[id] = c
+	}
+	return c
+}
+
+func (m *Metrics) Trace(e *Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch e.Kind {
+	case EventConnect:
+		m.conn(e.Conn)
+		m.total++
+	case EventDisconnect:
+		delete(m.conns, e.Conn)
+	case EventError:
+		m.failures++
+	case EventSend, EventReceive:
+		// Only responses carry their request. Servers send them, and
+		// clients receive them.
+		if e.Request == nil {
+			return
+		}
+		t := e.Request.GetType()
+		cs, ok := m.calls[t]
+		if !ok {
+			cs = &CallStats{}
+			m.calls[t] = cs
+		}
+		c := m.conn(e.Conn)
+		cs.Count++
+		c.Requests++
+		cs.Latency.observe(e.Latency)
+		switch e.Call.(type) {
+		case *proto.RError, *proto.RLerror:
+			cs.Errors++
+			c.Errors++
+		}
+		c.OpenFids += fidDelta(e.Request, e.Call)
+	}
+}
+
+// fidDelta returns the change in the number of fids in use made by req,
+// answered by resp.
+func fidDelta(req, resp proto.FCall) int64 {
+	switch r := req.(type) {
+	case *proto.TClunk, *proto.TRemove:
+		// The fid is clunked even if the remove fails.
+		return -1
+	case *proto.TAuth:
+		if _, ok := resp.(*proto.RAuth); ok {
+			return 1
+		}
+	case *proto.TAttach:
+		if _, ok := resp.(*proto.RAttach); ok {
+			return 1
+		}
+	case *proto.TWalk:
+		if rw, ok := resp.(*proto.RWalk); ok && r.Newfid != r.Fid && len(rw.Wqid) == len(r.Wname) {
+			return 1
+		}
+	case *proto.TXattrwalk:
+		if _, ok := resp.(*proto.RXattrwalk); ok {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Snapshot returns a copy of the statistics counted so far.
+func (m *Metrics) Snapshot() *MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &MetricsSnapshot{
+		Calls:            make(map[string]CallStats),
+		Conns:            make(map[uint64]ConnStats),
+		TotalConnections: m.total,
+		Failures:         m.failures,
+	}
+	for t, cs := range m.calls {
+		c := *cs
+		c.Latency = cs.Latency.copy()
+		s.Calls[proto.TypeName(t)] = c
+	}
+	for id, c := range m.conns {
+		s.Conns[id] = *c
+		s.OpenFids += c.OpenFids
+	}
+	return s
+}
+
+// WriteTo writes the statistics in m to w in the Prometheus text
+// exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	s := m.Snapshot()
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	types := make([]string, 0, len(s.Calls))
+	for t := range s.Calls {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	conns := make([]uint64, 0, len(s.Conns))
+	for id := range s.Conns {
+		conns = append(conns, id)
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i] < conns[j] })
+
+	cw.printf("# TYPE go9p_requests_total counter\n")
+	for _, t := range types {
+		cw.printf("go9p_requests_total{type=%q} %d\n", t, s.Calls[t].Count)
+	}
+	cw.printf("# TYPE go9p_errors_total counter\n")
+	for _, t := range types {
+		cw.printf("go9p_errors_total{type=%q} %d\n", t, s.Calls[t].Errors)
+	}
+	cw.printf("# TYPE go9p_request_duration_seconds histogram\n")
+	for _, t := range types {
+		h := s.Calls[t].Latency
+		for i, b := range LatencyBuckets {
+			cw.printf("go9p_request_duration_seconds_bucket{type=%q,le=%q} %d\n", t, seconds(b), h.Counts[i])
+		}
+		cw.printf("go9p_request_duration_seconds_bucket{type=%q,le=\"+Inf\"} %d\n", t, h.Counts[len(LatencyBuckets)])
+		cw.printf("go9p_request_duration_seconds_sum{type=%q} %s\n", t, seconds(h.Sum))
+		cw.printf("go9p_request_duration_seconds_count{type=%q} %d\n", t, h.Counts[len(LatencyBuckets)])
+	}
+	cw.printf("# TYPE go9p_connection_requests_total counter\n")
+	for _, id := range conns {
+		cw.printf("go9p_connection_requests_total{conn=\"%d\"} %d\n", id, s.Conns[id].Requests)
+	}
+	cw.printf("# TYPE go9p_connection_errors_total counter\n")
+	for _, id := range conns {
+		cw.printf("go9p_connection_errors_total{conn=\"%d\"} %d\n", id, s.Conns[id].Errors)
+	}
+	cw.printf("# TYPE go9p_connection_open_fids gauge\n")
+	for _, id := range conns {
+		cw.printf("go9p_connection_open_fids{conn=\"%d\"} %d\n", id, s.Conns[id].OpenFids)
+	}
+	cw.printf("# TYPE go9p_open_fids gauge\ngo9p_open_fids %d\n", s.OpenFids)
+	cw.printf("# TYPE go9p_connections gauge\ngo9p_connections %d\n", len(s.Conns))
+	cw.printf("# TYPE go9p_connections_total counter\ngo9p_connections_total %d\n", s.TotalConnections)
+	cw.printf("# TYPE go9p_failures_total counter\ngo9p_failures_total %d\n", s.Failures)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// countWriter counts the bytes written through it, and remembers the
+// first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+type multiTracer []Tracer
+
+func (ts multiTracer) Trace(e *Event) {
+	for _, t := range ts {
+		t.Trace(e)
+	}
+}
+
+// MultiTracer returns a Tracer that passes each Event to all of ts in
+// turn. Nil Tracers are skipped.
+func MultiTracer(ts ...Tracer) Tracer {
+	var m multiTracer
+	for _, t := range ts {
+		if t != nil {
+			m = append(m, t)
+		}
+	}
+	if len(m) == 1 {
+		return m[0]
+	}
+	return m
+}
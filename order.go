@@ -0,0 +1,174 @@
+package go9p
+
+import (
+	"sync"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// Ordering selects the order in which a connection's requests are
+// handled relative to each other.
+type Ordering int
+
+const (
+	// DefaultOrdering uses the Ordering chosen by the Srv, if it
+	// implements Orderer, and Unordered otherwise.
+	DefaultOrdering Ordering = iota
+	// Unordered requests may be handled in any order, and at the same
+	// time.
+	Unordered
+	// FidOrdered requests that use the same fid are handled one at a
+	// time, in the order they were received. Requests on different fids
+	// are still handled at the same time.
+	FidOrdered
+)
+
+// An Orderer is a Srv that chooses the Ordering of its requests. The
+// servers built by the fs package are FidOrdered.
+type Orderer interface {
+	Ordering() Ordering
+}
+
+// resolve returns the Ordering to use for srv.
+func (o Ordering) resolve(srv Srv) Ordering {
+	if o != DefaultOrdering {
+		return o
+	}
+	if or, ok := srv.(Orderer); ok {
+		if o := or.Ordering(); o != DefaultOrdering {
+			return o
+		}
+	}
+	return Unordered
+}
+
+// requestFids returns the fids used by call.
+func requestFids(call proto.FCall) []uint32 {
+	switch c := call.(type) {
+	case *proto.TAuth:
+		return []uint32{c.Afid}
+	case *proto.TAttach:
+		return []uint32{c.Fid, c.Afid}
+	case *proto.TWalk:
+		return []uint32{c.Fid, c.Newfid}
+	case *proto.TOpen:
+		return []uint32{c.Fid}
+	case *proto.TCreate:
+		return []uint32{c.Fid}
+	case *proto.TRead:
+		return []uint32{c.Fid}
+	case *proto.TWrite:
+		return []uint32{c.Fid}
+	case *proto.TClunk:
+		return []uint32{c.Fid}
+	case *proto.TRemove:
+		return []uint32{c.Fid}
+	case *proto.TStat:
+		return []uint32{c.Fid}
+	case *proto.TWstat:
+		return []uint32{c.Fid}
+	case *proto.TStatfs:
+		return []uint32{c.Fid}
+	case *proto.TLopen:
+		return []uint32{c.Fid}
+	case *proto.TLcreate:
+		return []uint32{c.Fid}
+	case *proto.TSymlink:
+		return []uint32{c.Fid}
+	case *proto.TMknod:
+		return []uint32{c.Dfid}
+	case *proto.TRename:
+		return []uint32{c.Fid, c.Dfid}
+	case *proto.TReadlink:
+		return []uint32{c.Fid}
+	case *proto.TGetattr:
+		return []uint32{c.Fid}
+	case *proto.TSetattr:
+		return []uint32{c.Fid}
+	case *proto.TXattrwalk:
+		return []uint32{c.Fid, c.Newfid}
+	case *proto.TXattrcreate:
+		return []uint32{c.Fid}
+	case *proto.TReaddir:
+		return []uint32{c.Fid}
+	case *proto.TFsync:
+		return []uint32{c.Fid}
+	case *proto.TLock:
+		return []uint32{c.Fid}
+	case *proto.TGetlock:
+		return []uint32{c.Fid}
+	case *proto.TLink:
+		return []uint32{c.Dfid, c.Fid}
+	case *proto.TMkdir:
+		return []uint32{c.Dfid}
+	case *proto.TRenameat:
+		return []uint32{c.Olddirfid, c.Newdirfid}
+	case *proto.TUnlinkat:
+		return []uint32{c.Dirfid}
+	}
+	return nil
+}
+
+// noFid is the fid sent in place of an absent one, such as the afid of
+// an attach without authentication.
+const noFid = ^uint32(0)
+
+// fidOrder serializes the requests on a connection that use the same
+// fid. A request is only handed to a worker once the previous request on
+// each of its fids has finished, so that requests waiting for their turn
+// do not hold workers that requests on other fids could use.
+type fidOrder struct {
+	sync.Mutex
+	last map[uint32]*turn
+}
+
+// turn is a request's place in the order.
+type turn struct {
+	req     *request
+	fids    []uint32
+	pending int     // The requests before this one that have not left.
+	next    []*turn // The requests waiting for this one to leave.
+}
+
+func newFidOrder() *fidOrder {
+	return &fidOrder{last: make(map[uint32]*turn)}
+}
+
+// enter places r after the requests already entered, and reports whether
+// it is r's turn already. Otherwise, r is returned by leave once its turn
+// comes. enter must be called in the order requests are received.
+func (o *fidOrder) enter(r *request) bool {
+	o.Lock()
+	defer o.Unlock()
+	t := &turn{req: r, fids: requestFids(r.call)}
+	r.turn = t
+	for i, fid := range t.fids {
+		if fid == noFid || (i > 0 && fid == t.fids[0]) {
+			continue
+		}
+		if prev, ok := o.last[fid]; ok {
+			t.pending++
+			prev.next = append(prev.next, t)
+		}
+		o.last[fid] = t
+	}
+	return t.pending == 0
+}
+
+// leave ends t's turn, and returns the requests whose turn has come.
+func (o *fidOrder) leave(t *turn) []*request {
+	o.Lock()
+	defer o.Unlock()
+	for _, fid := range t.fids {
+		if o.last[fid] == t {
+			delete(o.last, fid)
+		}
+	}
+	var ready []*request
+	for _, n := range t.next {
+		if n.pending--; n.pending == 0 {
+			ready = append(ready, n.req)
+		}
+	}
+	return ready
+}
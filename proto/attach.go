@@ -10,11 +10,14 @@ type TAttach struct {
 	Afid  uint32
 	Uname string
 	Aname string
+	// NUname is the numeric id of the user, sent by clients speaking
+	// 9P2000.u or 9P2000.L. It is NoUid if the client did not send one.
+	NUname uint32
 }
 
 func (attach *TAttach) String() string {
-	return fmt.Sprintf("tattach: [%s, fid: %d, afid: %d, uname: %s, aname: %s]",
-		&attach.Header, attach.Fid, attach.Afid, attach.Uname, attach.Aname)
+	return fmt.Sprintf("tattach: [%s, fid: %d, afid: %d, uname: %s, aname: %s, n_uname: %d]",
+		&attach.Header, attach.Fid, attach.Afid, attach.Uname, attach.Aname, attach.NUname)
 }
 
 func (attach *TAttach) parse(buff []byte) ([]byte, error) {
@@ -22,15 +25,39 @@ func (attach *TAttach) parse(buff []byte) ([]byte, error) {
 	attach.Afid, buff = fromLittleE32(buff)
 	attach.Uname, buff = fromString(buff)
 	attach.Aname, buff = fromString(buff)
+	attach.NUname = NoUid
+	if len(buff) >= 4 {
+		attach.NUname, buff = fromLittleE32(buff)
+	}
 	return buff, nil
 }
 
 func (attach *TAttach) Compose() []byte {
+	return attach.AppendCompose(nil)
+}
+
+func (attach *TAttach) AppendCompose(dst []byte) []byte {
 	// size[4] Tattach tag[2] fid[4] afid[4] uname[s] aname[s]
 	length := 4 + 1 + 2 + 4 + 4 +
 		(2 + len(attach.Uname)) + (2 + len(attach.Aname))
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = attach.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(attach.Tag, buffer)
+	buffer = toLittleE32(attach.Fid, buffer)
+	buffer = toLittleE32(attach.Afid, buffer)
+	buffer = toString(attach.Uname, buffer)
+	buffer = toString(attach.Aname, buffer)
+	return buff
+}
+
+func (attach *TAttach) appendComposeDialect(dst []byte, d Dialect) []byte {
+	// size[4] Tattach tag[2] fid[4] afid[4] uname[s] aname[s] n_uname[4]
+	length := 4 + 1 + 2 + 4 + 4 +
+		(2 + len(attach.Uname)) + (2 + len(attach.Aname)) + 4
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = attach.Type
@@ -40,6 +67,7 @@ func (attach *TAttach) Compose() []byte {
 	buffer = toLittleE32(attach.Afid, buffer)
 	buffer = toString(attach.Uname, buffer)
 	buffer = toString(attach.Aname, buffer)
+	buffer = toLittleE32(attach.NUname, buffer)
 	return buff
 }
 
@@ -62,16 +90,18 @@ func (attach *RAttach) parse(buff []byte) ([]byte, error) {
 }
 
 func (attach *RAttach) Compose() []byte {
+	return attach.AppendCompose(nil)
+}
+
+func (attach *RAttach) AppendCompose(dst []byte) []byte {
 	// size[4] Rattach tag[2] qid[13]
 	length := 4 + 1 + 2 + 13
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = attach.Type
 	buffer = buffer[1:]
 	buffer = toLittleE16(attach.Tag, buffer)
-	qidbuff := attach.Qid.Compose()
-	copy(buffer, qidbuff)
+	buffer = toQid(&attach.Qid, buffer)
 	return buff
 }
@@ -9,26 +9,53 @@ type TAuth struct {
 	Afid  uint32
 	Uname string
 	Aname string
+	// NUname is the numeric id of the user, sent by clients speaking
+	// 9P2000.u or 9P2000.L. It is NoUid if the client did not send one.
+	NUname uint32
 }
 
 func (auth *TAuth) String() string {
-	return fmt.Sprintf("tauth: [%s, afid: %d, uname: %s, aname: %s]",
-		&auth.Header, auth.Afid, auth.Uname, auth.Aname)
+	return fmt.Sprintf("tauth: [%s, afid: %d, uname: %s, aname: %s, n_uname: %d]",
+		&auth.Header, auth.Afid, auth.Uname, auth.Aname, auth.NUname)
 }
 
 func (auth *TAuth) parse(buff []byte) ([]byte, error) {
 	auth.Afid, buff = fromLittleE32(buff)
 	auth.Uname, buff = fromString(buff)
 	auth.Aname, buff = fromString(buff)
+	auth.NUname = NoUid
+	if len(buff) >= 4 {
+		auth.NUname, buff = fromLittleE32(buff)
+	}
 	return buff, nil
 }
 
 func (auth *TAuth) Compose() []byte {
+	return auth.AppendCompose(nil)
+}
+
+func (auth *TAuth) AppendCompose(dst []byte) []byte {
 	// size[4] Tauth tag[2] afid[4] uname[s] aname[s]
 	var length uint32 = uint32(4 + 1 + 2 + 4 +
 		(2 + len(auth.Uname)) + (2 + len(auth.Aname)))
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, int(length))
+
+	buffer = toLittleE32(length, buffer)
+	buffer[0] = auth.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(auth.Tag, buffer)
+	buffer = toLittleE32(auth.Afid, buffer)
+	buffer = toString(auth.Uname, buffer)
+	buffer = toString(auth.Aname, buffer)
+
+	return buff
+}
+
+func (auth *TAuth) appendComposeDialect(dst []byte, d Dialect) []byte {
+	// size[4] Tauth tag[2] afid[4] uname[s] aname[s] n_uname[4]
+	var length uint32 = uint32(4 + 1 + 2 + 4 +
+		(2 + len(auth.Uname)) + (2 + len(auth.Aname)) + 4)
+	buff, buffer := grow(dst, int(length))
 
 	buffer = toLittleE32(length, buffer)
 	buffer[0] = auth.Type
@@ -37,6 +64,7 @@ func (auth *TAuth) Compose() []byte {
 	buffer = toLittleE32(auth.Afid, buffer)
 	buffer = toString(auth.Uname, buffer)
 	buffer = toString(auth.Aname, buffer)
+	buffer = toLittleE32(auth.NUname, buffer)
 
 	return buff
 }
@@ -60,16 +88,18 @@ func (auth *RAuth) parse(buff []byte) ([]byte, error) {
 }
 
 func (auth *RAuth) Compose() []byte {
+	return auth.AppendCompose(nil)
+}
+
+func (auth *RAuth) AppendCompose(dst []byte) []byte {
 	// size[4] Rauth tag[2] aqid[13]
 	length := 4 + 1 + 2 + 13
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = auth.Type
 	buffer = buffer[1:]
 	buffer = toLittleE16(auth.Tag, buffer)
-	qidbuffer := auth.Aqid.Compose()
-	copy(buffer, qidbuffer)
+	buffer = toQid(&auth.Aqid, buffer)
 	return buff
 }
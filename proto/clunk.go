@@ -17,10 +17,13 @@ func (clunk *TClunk) parse(buff []byte) ([]byte, error) {
 }
 
 func (clunk *TClunk) Compose() []byte {
+	return clunk.AppendCompose(nil)
+}
+
+func (clunk *TClunk) AppendCompose(dst []byte) []byte {
 	// size[4] Tclunk tag[2] fid[4]
 	length := 4 + 1 + 2 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = clunk.Type
@@ -43,10 +46,13 @@ func (clunk *RClunk) parse(buff []byte) ([]byte, error) {
 }
 
 func (clunk *RClunk) Compose() []byte {
+	return clunk.AppendCompose(nil)
+}
+
+func (clunk *RClunk) AppendCompose(dst []byte) []byte {
 	// size[4] Rclunk tag[2]
 	length := 4 + 1 + 2
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = clunk.Type
@@ -8,11 +8,14 @@ type TCreate struct {
 	Name string
 	Perm uint32
 	Mode uint8
+	// Extension describes special files (see DMSYMLINK and DMDEVICE)
+	// on 9P2000.u connections.
+	Extension string
 }
 
 func (create *TCreate) String() string {
-	return fmt.Sprintf("tcreate: [%s, fid: %d, name: %s, perm: %o, mode: %d]",
-		&create.Header, create.Fid, create.Name, create.Perm, create.Mode)
+	return fmt.Sprintf("tcreate: [%s, fid: %d, name: %s, perm: %o, mode: %d, extension: %s]",
+		&create.Header, create.Fid, create.Name, create.Perm, create.Mode, create.Extension)
 }
 
 func (create *TCreate) parse(buff []byte) ([]byte, error) {
@@ -21,14 +24,20 @@ func (create *TCreate) parse(buff []byte) ([]byte, error) {
 	create.Perm, buff = fromLittleE32(buff)
 	create.Mode = buff[0]
 	buff = buff[1:]
+	if len(buff) >= 2 {
+		create.Extension, buff = fromString(buff)
+	}
 	return buff, nil
 }
 
 func (create *TCreate) Compose() []byte {
+	return create.AppendCompose(nil)
+}
+
+func (create *TCreate) AppendCompose(dst []byte) []byte {
 	// size[4] Tcreate tag[2] fid[4] name[s] perm[4] mode[1]
 	length := 4 + 1 + 2 + 4 + (2 + len(create.Name)) + 4 + 1
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = create.Type
@@ -42,6 +51,27 @@ func (create *TCreate) Compose() []byte {
 	return buff
 }
 
+func (create *TCreate) appendComposeDialect(dst []byte, d Dialect) []byte {
+	if d != DotU {
+		return create.AppendCompose(dst)
+	}
+	// size[4] Tcreate tag[2] fid[4] name[s] perm[4] mode[1] extension[s]
+	length := 4 + 1 + 2 + 4 + (2 + len(create.Name)) + 4 + 1 + (2 + len(create.Extension))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = create.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(create.Tag, buffer)
+	buffer = toLittleE32(create.Fid, buffer)
+	buffer = toString(create.Name, buffer)
+	buffer = toLittleE32(create.Perm, buffer)
+	buffer[0] = create.Mode
+	buffer = buffer[1:]
+	buffer = toString(create.Extension, buffer)
+	return buff
+}
+
 type RCreate struct {
 	Header
 	Qid    Qid
@@ -64,18 +94,19 @@ func (create *RCreate) parse(buff []byte) ([]byte, error) {
 }
 
 func (create *RCreate) Compose() []byte {
+	return create.AppendCompose(nil)
+}
+
+func (create *RCreate) AppendCompose(dst []byte) []byte {
 	// size[4] Rcreate tag[2] qid[13] iounit[4]
 	length := 4 + 1 + 2 + 13 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = create.Type
 	buffer = buffer[1:]
 	buffer = toLittleE16(create.Tag, buffer)
-	qidbuff := create.Qid.Compose()
-	copy(buffer, qidbuff)
-	buffer = buffer[len(qidbuff):]
+	buffer = toQid(&create.Qid, buffer)
 	buffer = toLittleE32(create.Iounit, buffer)
 	return buff
 }
@@ -0,0 +1,101 @@
+package proto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error numbers carried by 9P2000.L Rlerror messages. These are the Linux
+// values, since those are what clients speaking the dialect expect.
+const (
+	EPERM        = 1
+	ENOENT       = 2
+	EIO          = 5
+	EBADF        = 9
+	EAGAIN       = 11
+	EACCES       = 13
+	EBUSY        = 16
+	EEXIST       = 17
+	EXDEV        = 18
+	ENOTDIR      = 20
+	EISDIR       = 21
+	EINVAL       = 22
+	ENOSPC       = 28
+	ENAMETOOLONG = 36
+	ENOSYS       = 38
+	ENOTEMPTY    = 39
+	ENODATA      = 61
+	EOPNOTSUPP   = 95
+)
+
+var errnoNames = map[uint32]string{
+	EPERM:        "Operation not permitted",
+	ENOENT:       "No such file or directory",
+	EIO:          "Input/output error",
+	EBADF:        "Bad file descriptor",
+	EAGAIN:       "Resource temporarily unavailable",
+	EACCES:       "Permission denied",
+	EBUSY:        "Device or resource busy",
+	EEXIST:       "File exists",
+	EXDEV:        "Invalid cross-device link",
+	ENOTDIR:      "Not a directory",
+	EISDIR:       "Is a directory",
+	EINVAL:       "Invalid argument",
+	ENOSPC:       "No space left on device",
+	ENAMETOOLONG: "File name too long",
+	ENOSYS:       "Function not implemented",
+	ENOTEMPTY:    "Directory not empty",
+	ENODATA:      "No data available",
+	EOPNOTSUPP:   "Operation not supported",
+}
+
+// ErrnoString returns a human readable description of errno.
+func ErrnoString(errno uint32) string {
+	if s, ok := errnoNames[errno]; ok {
+		return s
+	}
+	return fmt.Sprintf("errno %d", errno)
+}
+
+// errnoPatterns maps fragments of 9P2000 error strings to error numbers.
+// The order matters: the first fragment found in an error string wins.
+var errnoPatterns = []struct {
+	fragment string
+	errno    uint32
+}{
+	{"permission denied", EACCES},
+	{"not permitted", EPERM},
+	{"no such", ENOENT},
+	{"does not exist", ENOENT},
+	{"not found", ENOENT},
+	{"already exists", EEXIST},
+	{"file exists", EEXIST},
+	{"not a directory", ENOTDIR},
+	{"is a directory", EISDIR},
+	{"to directory", EISDIR},
+	{"not empty", ENOTEMPTY},
+	{"bad fid", EBADF},
+	{"not open", EBADF},
+	{"does not support", EOPNOTSUPP},
+	{"not supported", EOPNOTSUPP},
+	{"not implemented", ENOSYS},
+	{"cannot create", EOPNOTSUPP},
+	{"cannot delete", EOPNOTSUPP},
+	{"name too long", ENAMETOOLONG},
+	{"exclusive use", EBUSY},
+	{"no space", ENOSPC},
+}
+
+// ErrnoFor guesses an error number for a 9P2000 error string, so that
+// errors produced for 9P2000 clients can be reported to clients of
+// dialects that carry error numbers instead. If nothing better can be
+// determined, EIO is returned.
+func ErrnoFor(ename string) uint32 {
+	lower := strings.ToLower(ename)
+	for _, p := range errnoPatterns {
+		if strings.Contains(lower, p.fragment) {
+			return p.errno
+		}
+	}
+	return EIO
+}
@@ -7,29 +7,56 @@ import (
 type RError struct {
 	Header
 	Ename string
+	// Errno is the error number sent along with Ename on 9P2000.u
+	// connections. It is 0 if no error number was sent.
+	Errno uint32
 }
 
 func (error *RError) String() string {
-	return fmt.Sprintf("rerror: [%s, ename: %s]",
-		&error.Header, error.Ename)
+	return fmt.Sprintf("rerror: [%s, ename: %s, errno: %d]",
+		&error.Header, error.Ename, error.Errno)
 }
 
 func (error *RError) parse(buff []byte) ([]byte, error) {
 	error.Ename, buff = fromString(buff)
+	if len(buff) >= 4 {
+		error.Errno, buff = fromLittleE32(buff)
+	}
 	return buff, nil
 }
 
 func (error *RError) Compose() []byte {
+	return error.AppendCompose(nil)
+}
+
+func (error *RError) AppendCompose(dst []byte) []byte {
 	// size[4] Rerror tag[2] ename[s]
 	length := 4 + 1 + 2 + (2 + len(error.Ename))
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = error.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(error.Tag, buffer)
+	buffer = toString(error.Ename, buffer)
+
+	return buff
+}
+
+func (error *RError) appendComposeDialect(dst []byte, d Dialect) []byte {
+	if d != DotU {
+		return error.AppendCompose(dst)
+	}
+	// size[4] Rerror tag[2] ename[s] errno[4]
+	length := 4 + 1 + 2 + (2 + len(error.Ename)) + 4
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = error.Type
 	buffer = buffer[1:]
 	buffer = toLittleE16(error.Tag, buffer)
 	buffer = toString(error.Ename, buffer)
+	buffer = toLittleE32(error.Errno, buffer)
 
 	return buff
 }
@@ -1,5 +1,5 @@
 // Package proto implements the 9p2000 protocol messages and the code required to
-// marshal the messages.
+// marshal the messages. The messages of the 9P2000.L dialect are also implemented.
 //
 // All the messages implement the FCall interface. Messages can be read from an
 // io.Reader with the ParseCall function.
@@ -13,6 +13,7 @@ package proto
 import (
 	"fmt"
 	"io"
+	"strconv"
 )
 
 // These constants represent the message types and belong
@@ -49,19 +50,120 @@ const (
 	Rwstat   = 127
 )
 
+// These are the additional message types defined by the 9P2000.L
+// dialect. A 9P2000.L connection also uses the 9P2000 messages above,
+// with the exception of Rerror, which is replaced by Rlerror.
 const (
-	MaxMsgLen = 65535 // 65k should be enough for anyone.
+	Tlerror      = 6 /* illegal */
+	Rlerror      = 7
+	Tstatfs      = 8
+	Rstatfs      = 9
+	Tlopen       = 12
+	Rlopen       = 13
+	Tlcreate     = 14
+	Rlcreate     = 15
+	Tsymlink     = 16
+	Rsymlink     = 17
+	Tmknod       = 18
+	Rmknod       = 19
+	Trename      = 20
+	Rrename      = 21
+	Treadlink    = 22
+	Rreadlink    = 23
+	Tgetattr     = 24
+	Rgetattr     = 25
+	Tsetattr     = 26
+	Rsetattr     = 27
+	Txattrwalk   = 30
+	Rxattrwalk   = 31
+	Txattrcreate = 32
+	Rxattrcreate = 33
+	Treaddir     = 40
+	Rreaddir     = 41
+	Tfsync       = 50
+	Rfsync       = 51
+	Tlock        = 52
+	Rlock        = 53
+	Tgetlock     = 54
+	Rgetlock     = 55
+	Tlink        = 70
+	Rlink        = 71
+	Tmkdir       = 72
+	Rmkdir       = 73
+	Trenameat    = 74
+	Rrenameat    = 75
+	Tunlinkat    = 76
+	Runlinkat    = 77
+)
+
+var typeNames = map[uint8]string{
+	Tversion: "Tversion", Rversion: "Rversion",
+	Tauth: "Tauth", Rauth: "Rauth",
+	Tattach: "Tattach", Rattach: "Rattach",
+	Terror: "Terror", Rerror: "Rerror",
+	Tflush: "Tflush", Rflush: "Rflush",
+	Twalk: "Twalk", Rwalk: "Rwalk",
+	Topen: "Topen", Ropen: "Ropen",
+	Tcreate: "Tcreate", Rcreate: "Rcreate",
+	Tread: "Tread", Rread: "Rread",
+	Twrite: "Twrite", Rwrite: "Rwrite",
+	Tclunk: "Tclunk", Rclunk: "Rclunk",
+	Tremove: "Tremove", Rremove: "Rremove",
+	Tstat: "Tstat", Rstat: "Rstat",
+	Twstat: "Twstat", Rwstat: "Rwstat",
+	Tlerror: "Tlerror", Rlerror: "Rlerror",
+	Tstatfs: "Tstatfs", Rstatfs: "Rstatfs",
+	Tlopen: "Tlopen", Rlopen: "Rlopen",
+	Tlcreate: "Tlcreate", Rlcreate: "Rlcreate",
+	Tsymlink: "Tsymlink", Rsymlink: "Rsymlink",
+	Tmknod: "Tmknod", Rmknod: "Rmknod",
+	Trename: "Trename", Rrename: "Rrename",
+	Treadlink: "Treadlink", Rreadlink: "Rreadlink",
+	Tgetattr: "Tgetattr", Rgetattr: "Rgetattr",
+	Tsetattr: "Tsetattr", Rsetattr: "Rsetattr",
+	Txattrwalk: "Txattrwalk", Rxattrwalk: "Rxattrwalk",
+	Txattrcreate: "Txattrcreate", Rxattrcreate: "Rxattrcreate",
+	Treaddir: "Treaddir", Rreaddir: "Rreaddir",
+	Tfsync: "Tfsync", Rfsync: "Rfsync",
+	Tlock: "Tlock", Rlock: "Rlock",
+	Tgetlock: "Tgetlock", Rgetlock: "Rgetlock",
+	Tlink: "Tlink", Rlink: "Rlink",
+	Tmkdir: "Tmkdir", Rmkdir: "Rmkdir",
+	Trenameat: "Trenameat", Rrenameat: "Rrenameat",
+	Tunlinkat: "Tunlinkat", Runlinkat: "Runlinkat",
+}
+
+// TypeName returns the name of the message type t, such as "Tread", or
+// a string holding its number if t is not a known type.
+func TypeName(t uint8) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+// NoUid is the numeric user or group id meaning "none", used in the
+// numeric id fields of the extended dialects.
+const NoUid = ^uint32(0)
+
+const (
+	MaxMsgLen = 65535   // The largest message ParseCall accepts.
+	MaxMsize  = 8 << 20 // The largest msize a connection may negotiate.
 )
 
 // FCall - the interface that all FCall types imlement. The String
 // function returns a human readable string representation of the
 // message. The Compose function returns a slice containing the 9p
 // message marshaled according the the 9P2000 protocol, ready to be
-// written to a stream.
+// written to a stream. AppendCompose appends the marshaled message to
+// dst and returns the extended slice, allocating only if dst is too
+// small.
 type FCall interface {
 	GetTag() uint16
+	GetType() uint8
 	String() string
 	Compose() []byte
+	AppendCompose(dst []byte) []byte
 	parse([]byte) ([]byte, error)
 }
 
@@ -75,6 +177,10 @@ func (fc *Header) GetTag() uint16 {
 	return fc.Tag
 }
 
+func (fc *Header) GetType() uint8 {
+	return fc.Type
+}
+
 func (fc *Header) String() string {
 	return fmt.Sprintf("tag: %d", fc.Tag)
 }
@@ -115,20 +221,28 @@ func (qid *Qid) parse(buff []byte) ([]byte, error) {
 
 func (qid *Qid) Compose() []byte {
 	buff := make([]byte, 13)
-	buffer := buff
-
-	buffer[0] = qid.Qtype
-	buffer = buffer[1:]
-	buffer = toLittleE32(qid.Vers, buffer)
-	buffer = toLittleE64(qid.Uid, buffer)
-
+	toQid(qid, buff)
 	return buff
 }
 
+func toQid(qid *Qid, buff []byte) []byte {
+	buff[0] = qid.Qtype
+	buff = buff[1:]
+	buff = toLittleE32(qid.Vers, buff)
+	return toLittleE64(qid.Uid, buff)
+}
+
 // ParseCall - Reads from a 9P2000 stream and parses an FCall from it.
 // On error, the protocol on the stream is in an unknown state and
 // the stream should be closed.
 func ParseCall(r io.Reader) (FCall, error) {
+	return ParseCallSize(r, MaxMsgLen)
+}
+
+// ParseCallSize is like ParseCall, but accepts messages of up to msize
+// bytes, which is normally the msize negotiated by Tversion. msize may
+// not exceed MaxMsize.
+func ParseCallSize(r io.Reader, msize uint32) (FCall, error) {
 	if r == nil {
 		return nil, &ParseError{"nil reader."}
 	}
@@ -141,12 +255,17 @@ func ParseCall(r io.Reader) (FCall, error) {
 
 	// We now have the length of the call.
 	length, _ := fromLittleE32(sizebuff)
-	if length > MaxMsgLen {
+	if length > msize || length > MaxMsize {
 		return nil, fmt.Errorf("Can't allocate %d bytes for message.", length)
 	}
+	if length < 7 {
+		return nil, &ParseError{"message too short."}
+	}
 
 	// Subtract 4 for uint32 length we read
-	buff := make([]byte, length-4)
+	pooled := getBuffer(int(length - 4))
+	defer PutBuffer(pooled)
+	buff := pooled
 	err = readBytes(r, buff)
 	if err != nil {
 		return nil, err
@@ -242,6 +361,123 @@ func ParseCall(r io.Reader) (FCall, error) {
 	case Rwstat:
 		fc = &RWstat{Header: h}
 		break
+	case Rlerror:
+		fc = &RLerror{Header: h}
+		break
+	case Tstatfs:
+		fc = &TStatfs{Header: h}
+		break
+	case Rstatfs:
+		fc = &RStatfs{Header: h}
+		break
+	case Tlopen:
+		fc = &TLopen{Header: h}
+		break
+	case Rlopen:
+		fc = &RLopen{Header: h}
+		break
+	case Tlcreate:
+		fc = &TLcreate{Header: h}
+		break
+	case Rlcreate:
+		fc = &RLcreate{Header: h}
+		break
+	case Tsymlink:
+		fc = &TSymlink{Header: h}
+		break
+	case Rsymlink:
+		fc = &RSymlink{Header: h}
+		break
+	case Tmknod:
+		fc = &TMknod{Header: h}
+		break
+	case Rmknod:
+		fc = &RMknod{Header: h}
+		break
+	case Trename:
+		fc = &TRename{Header: h}
+		break
+	case Rrename:
+		fc = &RRename{Header: h}
+		break
+	case Treadlink:
+		fc = &TReadlink{Header: h}
+		break
+	case Rreadlink:
+		fc = &RReadlink{Header: h}
+		break
+	case Tgetattr:
+		fc = &TGetattr{Header: h}
+		break
+	case Rgetattr:
+		fc = &RGetattr{Header: h}
+		break
+	case Tsetattr:
+		fc = &TSetattr{Header: h}
+		break
+	case Rsetattr:
+		fc = &RSetattr{Header: h}
+		break
+	case Txattrwalk:
+		fc = &TXattrwalk{Header: h}
+		break
+	case Rxattrwalk:
+		fc = &RXattrwalk{Header: h}
+		break
+	case Txattrcreate:
+		fc = &TXattrcreate{Header: h}
+		break
+	case Rxattrcreate:
+		fc = &RXattrcreate{Header: h}
+		break
+	case Treaddir:
+		fc = &TReaddir{Header: h}
+		break
+	case Rreaddir:
+		fc = &RReaddir{Header: h}
+		break
+	case Tfsync:
+		fc = &TFsync{Header: h}
+		break
+	case Rfsync:
+		fc = &RFsync{Header: h}
+		break
+	case Tlock:
+		fc = &TLock{Header: h}
+		break
+	case Rlock:
+		fc = &RLock{Header: h}
+		break
+	case Tgetlock:
+		fc = &TGetlock{Header: h}
+		break
+	case Rgetlock:
+		fc = &RGetlock{Header: h}
+		break
+	case Tlink:
+		fc = &TLink{Header: h}
+		break
+	case Rlink:
+		fc = &RLink{Header: h}
+		break
+	case Tmkdir:
+		fc = &TMkdir{Header: h}
+		break
+	case Rmkdir:
+		fc = &RMkdir{Header: h}
+		break
+	case Trenameat:
+		fc = &TRenameat{Header: h}
+		break
+	case Rrenameat:
+		fc = &RRenameat{Header: h}
+		break
+	case Tunlinkat:
+		fc = &TUnlinkat{Header: h}
+		break
+	case Runlinkat:
+		fc = &RUnlinkat{Header: h}
+		break
 	default:
 		return nil, &ParseError{fmt.Sprintf("Message type %d not implemented.", h.Type)}
 	}
@@ -18,10 +18,13 @@ func (flush *TFlush) parse(buff []byte) ([]byte, error) {
 }
 
 func (flush *TFlush) Compose() []byte {
+	return flush.AppendCompose(nil)
+}
+
+func (flush *TFlush) AppendCompose(dst []byte) []byte {
 	// size[4] Tflush tag[2] oldtag[2]
 	length := 4 + 1 + 2 + 2
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = flush.Type
@@ -44,10 +47,13 @@ func (flush *RFlush) parse(buff []byte) ([]byte, error) {
 }
 
 func (flush *RFlush) Compose() []byte {
+	return flush.AppendCompose(nil)
+}
+
+func (flush *RFlush) AppendCompose(dst []byte) []byte {
 	// size[4] Rflush tag[2]
 	length := 4 + 1 + 2
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = flush.Type
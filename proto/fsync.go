@@ -0,0 +1,69 @@
+package proto
+
+import "fmt"
+
+type TFsync struct {
+	Header
+	Fid      uint32
+	Datasync uint32
+}
+
+func (fsync *TFsync) String() string {
+	return fmt.Sprintf("tfsync: [%s, fid: %d, datasync: %d]",
+		&fsync.Header, fsync.Fid, fsync.Datasync)
+}
+
+func (fsync *TFsync) parse(buff []byte) ([]byte, error) {
+	fsync.Fid, buff = fromLittleE32(buff)
+	// Older clients do not send datasync.
+	if len(buff) >= 4 {
+		fsync.Datasync, buff = fromLittleE32(buff)
+	}
+	return buff, nil
+}
+
+func (fsync *TFsync) Compose() []byte {
+	return fsync.AppendCompose(nil)
+}
+
+func (fsync *TFsync) AppendCompose(dst []byte) []byte {
+	// size[4] Tfsync tag[2] fid[4] datasync[4]
+	length := 4 + 1 + 2 + 4 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = fsync.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(fsync.Tag, buffer)
+	buffer = toLittleE32(fsync.Fid, buffer)
+	buffer = toLittleE32(fsync.Datasync, buffer)
+	return buff
+}
+
+type RFsync struct {
+	Header
+}
+
+func (fsync *RFsync) String() string {
+	return fmt.Sprintf("rfsync: [%s]", &fsync.Header)
+}
+
+func (fsync *RFsync) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (fsync *RFsync) Compose() []byte {
+	return fsync.AppendCompose(nil)
+}
+
+func (fsync *RFsync) AppendCompose(dst []byte) []byte {
+	// size[4] Rfsync tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = fsync.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(fsync.Tag, buffer)
+	return buff
+}
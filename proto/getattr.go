@@ -0,0 +1,158 @@
+package proto
+
+import "fmt"
+
+// Bits for the RequestMask of TGetattr and the Valid field of RGetattr.
+const (
+	GetattrMode        = 0x00000001
+	GetattrNlink       = 0x00000002
+	GetattrUid         = 0x00000004
+	GetattrGid         = 0x00000008
+	GetattrRdev        = 0x00000010
+	GetattrAtime       = 0x00000020
+	GetattrMtime       = 0x00000040
+	GetattrCtime       = 0x00000080
+	GetattrIno         = 0x00000100
+	GetattrSize        = 0x00000200
+	GetattrBlocks      = 0x00000400
+	GetattrBtime       = 0x00000800
+	GetattrGen         = 0x00001000
+	GetattrDataVersion = 0x00002000
+	GetattrBasic       = 0x000007ff // Mask for fields up to Blocks
+	GetattrAll         = 0x00003fff // Mask for all fields above
+)
+
+type TGetattr struct {
+	Header
+	Fid         uint32
+	RequestMask uint64
+}
+
+func (getattr *TGetattr) String() string {
+	return fmt.Sprintf("tgetattr: [%s, fid: %d, request_mask: 0x%X]",
+		&getattr.Header, getattr.Fid, getattr.RequestMask)
+}
+
+func (getattr *TGetattr) parse(buff []byte) ([]byte, error) {
+	getattr.Fid, buff = fromLittleE32(buff)
+	getattr.RequestMask, buff = fromLittleE64(buff)
+	return buff, nil
+}
+
+func (getattr *TGetattr) Compose() []byte {
+	return getattr.AppendCompose(nil)
+}
+
+func (getattr *TGetattr) AppendCompose(dst []byte) []byte {
+	// size[4] Tgetattr tag[2] fid[4] request_mask[8]
+	length := 4 + 1 + 2 + 4 + 8
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = getattr.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(getattr.Tag, buffer)
+	buffer = toLittleE32(getattr.Fid, buffer)
+	buffer = toLittleE64(getattr.RequestMask, buffer)
+	return buff
+}
+
+type RGetattr struct {
+	Header
+	Valid       uint64
+	Qid         Qid
+	Mode        uint32
+	Uid         uint32
+	Gid         uint32
+	Nlink       uint64
+	Rdev        uint64
+	Size        uint64
+	Blksize     uint64
+	Blocks      uint64
+	AtimeSec    uint64
+	AtimeNsec   uint64
+	MtimeSec    uint64
+	MtimeNsec   uint64
+	CtimeSec    uint64
+	CtimeNsec   uint64
+	BtimeSec    uint64
+	BtimeNsec   uint64
+	Gen         uint64
+	DataVersion uint64
+}
+
+func (getattr *RGetattr) String() string {
+	return fmt.Sprintf("rgetattr: [%s, valid: 0x%X, qid: [%s], mode: %o, uid: %d, gid: %d, nlink: %d, rdev: %d, size: %d, blksize: %d, blocks: %d, atime: %d.%09d, mtime: %d.%09d, ctime: %d.%09d, btime: %d.%09d, gen: %d, data_version: %d]",
+		&getattr.Header, getattr.Valid, &getattr.Qid, getattr.Mode, getattr.Uid, getattr.Gid,
+		getattr.Nlink, getattr.Rdev, getattr.Size, getattr.Blksize, getattr.Blocks,
+		getattr.AtimeSec, getattr.AtimeNsec, getattr.MtimeSec, getattr.MtimeNsec,
+		getattr.CtimeSec, getattr.CtimeNsec, getattr.BtimeSec, getattr.BtimeNsec,
+		getattr.Gen, getattr.DataVersion)
+}
+
+func (getattr *RGetattr) parse(buff []byte) ([]byte, error) {
+	getattr.Valid, buff = fromLittleE64(buff)
+	buff, err := getattr.Qid.parse(buff)
+	if err != nil {
+		return nil, err
+	}
+	getattr.Mode, buff = fromLittleE32(buff)
+	getattr.Uid, buff = fromLittleE32(buff)
+	getattr.Gid, buff = fromLittleE32(buff)
+	getattr.Nlink, buff = fromLittleE64(buff)
+	getattr.Rdev, buff = fromLittleE64(buff)
+	getattr.Size, buff = fromLittleE64(buff)
+	getattr.Blksize, buff = fromLittleE64(buff)
+	getattr.Blocks, buff = fromLittleE64(buff)
+	getattr.AtimeSec, buff = fromLittleE64(buff)
+	getattr.AtimeNsec, buff = fromLittleE64(buff)
+	getattr.MtimeSec, buff = fromLittleE64(buff)
+	getattr.MtimeNsec, buff = fromLittleE64(buff)
+	getattr.CtimeSec, buff = fromLittleE64(buff)
+	getattr.CtimeNsec, buff = fromLittleE64(buff)
+	getattr.BtimeSec, buff = fromLittleE64(buff)
+	getattr.BtimeNsec, buff = fromLittleE64(buff)
+	getattr.Gen, buff = fromLittleE64(buff)
+	getattr.DataVersion, buff = fromLittleE64(buff)
+	return buff, nil
+}
+
+func (getattr *RGetattr) Compose() []byte {
+	return getattr.AppendCompose(nil)
+}
+
+func (getattr *RGetattr) AppendCompose(dst []byte) []byte {
+	// size[4] Rgetattr tag[2] valid[8] qid[13] mode[4] uid[4] gid[4]
+	// nlink[8] rdev[8] size[8] blksize[8] blocks[8]
+	// atime_sec[8] atime_nsec[8] mtime_sec[8] mtime_nsec[8]
+	// ctime_sec[8] ctime_nsec[8] btime_sec[8] btime_nsec[8]
+	// gen[8] data_version[8]
+	length := 4 + 1 + 2 + 8 + 13 + 4 + 4 + 4 + (8 * 15)
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = getattr.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(getattr.Tag, buffer)
+	buffer = toLittleE64(getattr.Valid, buffer)
+	buffer = toQid(&getattr.Qid, buffer)
+	buffer = toLittleE32(getattr.Mode, buffer)
+	buffer = toLittleE32(getattr.Uid, buffer)
+	buffer = toLittleE32(getattr.Gid, buffer)
+	buffer = toLittleE64(getattr.Nlink, buffer)
+	buffer = toLittleE64(getattr.Rdev, buffer)
+	buffer = toLittleE64(getattr.Size, buffer)
+	buffer = toLittleE64(getattr.Blksize, buffer)
+	buffer = toLittleE64(getattr.Blocks, buffer)
+	buffer = toLittleE64(getattr.AtimeSec, buffer)
+	buffer = toLittleE64(getattr.AtimeNsec, buffer)
+	buffer = toLittleE64(getattr.MtimeSec, buffer)
+	buffer = toLittleE64(getattr.MtimeNsec, buffer)
+	buffer = toLittleE64(getattr.CtimeSec, buffer)
+	buffer = toLittleE64(getattr.CtimeNsec, buffer)
+	buffer = toLittleE64(getattr.BtimeSec, buffer)
+	buffer = toLittleE64(getattr.BtimeNsec, buffer)
+	buffer = toLittleE64(getattr.Gen, buffer)
+	buffer = toLittleE64(getattr.DataVersion, buffer)
+	return buff
+}
@@ -0,0 +1,85 @@
+package proto
+
+import "fmt"
+
+type TLcreate struct {
+	Header
+	Fid   uint32
+	Name  string
+	Flags uint32
+	Mode  uint32
+	Gid   uint32
+}
+
+func (lcreate *TLcreate) String() string {
+	return fmt.Sprintf("tlcreate: [%s, fid: %d, name: %s, flags: 0%o, mode: %o, gid: %d]",
+		&lcreate.Header, lcreate.Fid, lcreate.Name, lcreate.Flags, lcreate.Mode, lcreate.Gid)
+}
+
+func (lcreate *TLcreate) parse(buff []byte) ([]byte, error) {
+	lcreate.Fid, buff = fromLittleE32(buff)
+	lcreate.Name, buff = fromString(buff)
+	lcreate.Flags, buff = fromLittleE32(buff)
+	lcreate.Mode, buff = fromLittleE32(buff)
+	lcreate.Gid, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (lcreate *TLcreate) Compose() []byte {
+	return lcreate.AppendCompose(nil)
+}
+
+func (lcreate *TLcreate) AppendCompose(dst []byte) []byte {
+	// size[4] Tlcreate tag[2] fid[4] name[s] flags[4] mode[4] gid[4]
+	length := 4 + 1 + 2 + 4 + (2 + len(lcreate.Name)) + 4 + 4 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lcreate.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lcreate.Tag, buffer)
+	buffer = toLittleE32(lcreate.Fid, buffer)
+	buffer = toString(lcreate.Name, buffer)
+	buffer = toLittleE32(lcreate.Flags, buffer)
+	buffer = toLittleE32(lcreate.Mode, buffer)
+	buffer = toLittleE32(lcreate.Gid, buffer)
+	return buff
+}
+
+type RLcreate struct {
+	Header
+	Qid    Qid
+	Iounit uint32
+}
+
+func (lcreate *RLcreate) String() string {
+	return fmt.Sprintf("rlcreate: [%s, qid: [%s], iounit: %d]",
+		&lcreate.Header, &lcreate.Qid, lcreate.Iounit)
+}
+
+func (lcreate *RLcreate) parse(buff []byte) ([]byte, error) {
+	buff, err := lcreate.Qid.parse(buff)
+	if err != nil {
+		return nil, err
+	}
+	lcreate.Iounit, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (lcreate *RLcreate) Compose() []byte {
+	return lcreate.AppendCompose(nil)
+}
+
+func (lcreate *RLcreate) AppendCompose(dst []byte) []byte {
+	// size[4] Rlcreate tag[2] qid[13] iounit[4]
+	length := 4 + 1 + 2 + 13 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lcreate.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lcreate.Tag, buffer)
+	buffer = toQid(&lcreate.Qid, buffer)
+	buffer = toLittleE32(lcreate.Iounit, buffer)
+	return buff
+}
@@ -0,0 +1,37 @@
+package proto
+
+import "fmt"
+
+// RLerror is the 9P2000.L replacement for RError. Rather than a string,
+// it carries an error number (see the E* constants).
+type RLerror struct {
+	Header
+	Ecode uint32
+}
+
+func (lerror *RLerror) String() string {
+	return fmt.Sprintf("rlerror: [%s, ecode: %d (%s)]",
+		&lerror.Header, lerror.Ecode, ErrnoString(lerror.Ecode))
+}
+
+func (lerror *RLerror) parse(buff []byte) ([]byte, error) {
+	lerror.Ecode, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (lerror *RLerror) Compose() []byte {
+	return lerror.AppendCompose(nil)
+}
+
+func (lerror *RLerror) AppendCompose(dst []byte) []byte {
+	// size[4] Rlerror tag[2] ecode[4]
+	length := 4 + 1 + 2 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lerror.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lerror.Tag, buffer)
+	buffer = toLittleE32(lerror.Ecode, buffer)
+	return buff
+}
@@ -0,0 +1,69 @@
+package proto
+
+import "fmt"
+
+type TLink struct {
+	Header
+	Dfid uint32
+	Fid  uint32
+	Name string
+}
+
+func (link *TLink) String() string {
+	return fmt.Sprintf("tlink: [%s, dfid: %d, fid: %d, name: %s]",
+		&link.Header, link.Dfid, link.Fid, link.Name)
+}
+
+func (link *TLink) parse(buff []byte) ([]byte, error) {
+	link.Dfid, buff = fromLittleE32(buff)
+	link.Fid, buff = fromLittleE32(buff)
+	link.Name, buff = fromString(buff)
+	return buff, nil
+}
+
+func (link *TLink) Compose() []byte {
+	return link.AppendCompose(nil)
+}
+
+func (link *TLink) AppendCompose(dst []byte) []byte {
+	// size[4] Tlink tag[2] dfid[4] fid[4] name[s]
+	length := 4 + 1 + 2 + 4 + 4 + (2 + len(link.Name))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = link.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(link.Tag, buffer)
+	buffer = toLittleE32(link.Dfid, buffer)
+	buffer = toLittleE32(link.Fid, buffer)
+	buffer = toString(link.Name, buffer)
+	return buff
+}
+
+type RLink struct {
+	Header
+}
+
+func (link *RLink) String() string {
+	return fmt.Sprintf("rlink: [%s]", &link.Header)
+}
+
+func (link *RLink) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (link *RLink) Compose() []byte {
+	return link.AppendCompose(nil)
+}
+
+func (link *RLink) AppendCompose(dst []byte) []byte {
+	// size[4] Rlink tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = link.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(link.Tag, buffer)
+	return buff
+}
@@ -0,0 +1,199 @@
+package proto
+
+import "fmt"
+
+// Lock types for TLock and TGetlock.
+const (
+	LockTypeRdlck = 0
+	LockTypeWrlck = 1
+	LockTypeUnlck = 2
+)
+
+// Flags for TLock.
+const (
+	LockFlagsBlock   = 1
+	LockFlagsReclaim = 2
+)
+
+// Status values for RLock.
+const (
+	LockSuccess = 0
+	LockBlocked = 1
+	LockError   = 2
+	LockGrace   = 3
+)
+
+type TLock struct {
+	Header
+	Fid      uint32
+	LockType uint8
+	Flags    uint32
+	Start    uint64
+	Length   uint64
+	ProcID   uint32
+	ClientID string
+}
+
+func (lock *TLock) String() string {
+	return fmt.Sprintf("tlock: [%s, fid: %d, type: %d, flags: %d, start: %d, length: %d, proc_id: %d, client_id: %s]",
+		&lock.Header, lock.Fid, lock.LockType, lock.Flags, lock.Start, lock.Length, lock.ProcID, lock.ClientID)
+}
+
+func (lock *TLock) parse(buff []byte) ([]byte, error) {
+	lock.Fid, buff = fromLittleE32(buff)
+	lock.LockType, buff = fromByte(buff)
+	lock.Flags, buff = fromLittleE32(buff)
+	lock.Start, buff = fromLittleE64(buff)
+	lock.Length, buff = fromLittleE64(buff)
+	lock.ProcID, buff = fromLittleE32(buff)
+	lock.ClientID, buff = fromString(buff)
+	return buff, nil
+}
+
+func (lock *TLock) Compose() []byte {
+	return lock.AppendCompose(nil)
+}
+
+func (lock *TLock) AppendCompose(dst []byte) []byte {
+	// size[4] Tlock tag[2] fid[4] type[1] flags[4] start[8] length[8] proc_id[4] client_id[s]
+	length := 4 + 1 + 2 + 4 + 1 + 4 + 8 + 8 + 4 + (2 + len(lock.ClientID))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lock.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lock.Tag, buffer)
+	buffer = toLittleE32(lock.Fid, buffer)
+	buffer[0] = lock.LockType
+	buffer = buffer[1:]
+	buffer = toLittleE32(lock.Flags, buffer)
+	buffer = toLittleE64(lock.Start, buffer)
+	buffer = toLittleE64(lock.Length, buffer)
+	buffer = toLittleE32(lock.ProcID, buffer)
+	buffer = toString(lock.ClientID, buffer)
+	return buff
+}
+
+type RLock struct {
+	Header
+	Status uint8
+}
+
+func (lock *RLock) String() string {
+	return fmt.Sprintf("rlock: [%s, status: %d]", &lock.Header, lock.Status)
+}
+
+func (lock *RLock) parse(buff []byte) ([]byte, error) {
+	lock.Status, buff = fromByte(buff)
+	return buff, nil
+}
+
+func (lock *RLock) Compose() []byte {
+	return lock.AppendCompose(nil)
+}
+
+func (lock *RLock) AppendCompose(dst []byte) []byte {
+	// size[4] Rlock tag[2] status[1]
+	length := 4 + 1 + 2 + 1
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lock.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lock.Tag, buffer)
+	buffer[0] = lock.Status
+	return buff
+}
+
+type TGetlock struct {
+	Header
+	Fid      uint32
+	LockType uint8
+	Start    uint64
+	Length   uint64
+	ProcID   uint32
+	ClientID string
+}
+
+func (getlock *TGetlock) String() string {
+	return fmt.Sprintf("tgetlock: [%s, fid: %d, type: %d, start: %d, length: %d, proc_id: %d, client_id: %s]",
+		&getlock.Header, getlock.Fid, getlock.LockType, getlock.Start, getlock.Length, getlock.ProcID, getlock.ClientID)
+}
+
+func (getlock *TGetlock) parse(buff []byte) ([]byte, error) {
+	getlock.Fid, buff = fromLittleE32(buff)
+	getlock.LockType, buff = fromByte(buff)
+	getlock.Start, buff = fromLittleE64(buff)
+	getlock.Length, buff = fromLittleE64(buff)
+	getlock.ProcID, buff = fromLittleE32(buff)
+	getlock.ClientID, buff = fromString(buff)
+	return buff, nil
+}
+
+func (getlock *TGetlock) Compose() []byte {
+	return getlock.AppendCompose(nil)
+}
+
+func (getlock *TGetlock) AppendCompose(dst []byte) []byte {
+	// size[4] Tgetlock tag[2] fid[4] type[1] start[8] length[8] proc_id[4] client_id[s]
+	length := 4 + 1 + 2 + 4 + 1 + 8 + 8 + 4 + (2 + len(getlock.ClientID))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = getlock.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(getlock.Tag, buffer)
+	buffer = toLittleE32(getlock.Fid, buffer)
+	buffer[0] = getlock.LockType
+	buffer = buffer[1:]
+	buffer = toLittleE64(getlock.Start, buffer)
+	buffer = toLittleE64(getlock.Length, buffer)
+	buffer = toLittleE32(getlock.ProcID, buffer)
+	buffer = toString(getlock.ClientID, buffer)
+	return buff
+}
+
+type RGetlock struct {
+	Header
+	LockType uint8
+	Start    uint64
+	Length   uint64
+	ProcID   uint32
+	ClientID string
+}
+
+func (getlock *RGetlock) String() string {
+	return fmt.Sprintf("rgetlock: [%s, type: %d, start: %d, length: %d, proc_id: %d, client_id: %s]",
+		&getlock.Header, getlock.LockType, getlock.Start, getlock.Length, getlock.ProcID, getlock.ClientID)
+}
+
+func (getlock *RGetlock) parse(buff []byte) ([]byte, error) {
+	getlock.LockType, buff = fromByte(buff)
+	getlock.Start, buff = fromLittleE64(buff)
+	getlock.Length, buff = fromLittleE64(buff)
+	getlock.ProcID, buff = fromLittleE32(buff)
+	getlock.ClientID, buff = fromString(buff)
+	return buff, nil
+}
+
+func (getlock *RGetlock) Compose() []byte {
+	return getlock.AppendCompose(nil)
+}
+
+func (getlock *RGetlock) AppendCompose(dst []byte) []byte {
+	// size[4] Rgetlock tag[2] type[1] start[8] length[8] proc_id[4] client_id[s]
+	length := 4 + 1 + 2 + 1 + 8 + 8 + 4 + (2 + len(getlock.ClientID))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = getlock.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(getlock.Tag, buffer)
+	buffer[0] = getlock.LockType
+	buffer = buffer[1:]
+	buffer = toLittleE64(getlock.Start, buffer)
+	buffer = toLittleE64(getlock.Length, buffer)
+	buffer = toLittleE32(getlock.ProcID, buffer)
+	buffer = toString(getlock.ClientID, buffer)
+	return buff
+}
@@ -0,0 +1,98 @@
+package proto
+
+import "fmt"
+
+// Flags for TLopen and TLcreate. These are the Linux open(2) flags.
+const (
+	LOrdonly    = 00000000
+	LOwronly    = 00000001
+	LOrdwr      = 00000002
+	LOaccmode   = 00000003
+	LOcreate    = 00000100
+	LOexcl      = 00000200
+	LOnoctty    = 00000400
+	LOtrunc     = 00001000
+	LOappend    = 00002000
+	LOnonblock  = 00004000
+	LOdsync     = 00010000
+	LOdirect    = 00040000
+	LOlargefile = 00100000
+	LOdirectory = 00200000
+	LOnofollow  = 00400000
+	LOnoatime   = 01000000
+	LOcloexec   = 02000000
+	LOsync      = 04000000
+)
+
+type TLopen struct {
+	Header
+	Fid   uint32
+	Flags uint32
+}
+
+func (lopen *TLopen) String() string {
+	return fmt.Sprintf("tlopen: [%s, fid: %d, flags: 0%o]",
+		&lopen.Header, lopen.Fid, lopen.Flags)
+}
+
+func (lopen *TLopen) parse(buff []byte) ([]byte, error) {
+	lopen.Fid, buff = fromLittleE32(buff)
+	lopen.Flags, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (lopen *TLopen) Compose() []byte {
+	return lopen.AppendCompose(nil)
+}
+
+func (lopen *TLopen) AppendCompose(dst []byte) []byte {
+	// size[4] Tlopen tag[2] fid[4] flags[4]
+	length := 4 + 1 + 2 + 4 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lopen.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lopen.Tag, buffer)
+	buffer = toLittleE32(lopen.Fid, buffer)
+	buffer = toLittleE32(lopen.Flags, buffer)
+	return buff
+}
+
+type RLopen struct {
+	Header
+	Qid    Qid
+	Iounit uint32
+}
+
+func (lopen *RLopen) String() string {
+	return fmt.Sprintf("rlopen: [%s, qid: [%s], iounit: %d]",
+		&lopen.Header, &lopen.Qid, lopen.Iounit)
+}
+
+func (lopen *RLopen) parse(buff []byte) ([]byte, error) {
+	buff, err := lopen.Qid.parse(buff)
+	if err != nil {
+		return nil, err
+	}
+	lopen.Iounit, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (lopen *RLopen) Compose() []byte {
+	return lopen.AppendCompose(nil)
+}
+
+func (lopen *RLopen) AppendCompose(dst []byte) []byte {
+	// size[4] Rlopen tag[2] qid[13] iounit[4]
+	length := 4 + 1 + 2 + 13 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = lopen.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(lopen.Tag, buffer)
+	buffer = toQid(&lopen.Qid, buffer)
+	buffer = toLittleE32(lopen.Iounit, buffer)
+	return buff
+}
@@ -3,6 +3,7 @@ package proto
 import (
 	"encoding/binary"
 	"io"
+	"net"
 )
 
 func readBytes(r io.Reader, buff []byte) error {
@@ -20,6 +21,13 @@ func readBytes(r io.Reader, buff []byte) error {
 	return nil
 }
 
+func fromByte(buff []byte) (uint8, []byte) {
+	if len(buff) < 1 {
+		return 0, nil
+	}
+	return buff[0], buff[1:]
+}
+
 func fromLittleE16(buff []byte) (uint16, []byte) {
 	if len(buff) < 2 {
 		return 0, nil
@@ -72,10 +80,52 @@ func toLittleE64(i uint64, buff []byte) []byte {
 
 func toString(s string, buff []byte) []byte {
 	buff = toLittleE16(uint16(len(s)), buff)
-	copy(buff, []byte(s))
+	copy(buff, s)
 	return buff[len(s):]
 }
 
+// grow extends dst by n zeroed bytes for a message to be composed into,
+// returning the extended slice and its last n bytes. If dst is nil, the
+// buffer is taken from the pool (see PutBuffer).
+func grow(dst []byte, n int) ([]byte, []byte) {
+	if dst == nil {
+		buff := getBuffer(n)
+		return buff, buff
+	}
+	l := len(dst)
+	if cap(dst)-l < n {
+		dst = append(dst, make([]byte, n)...)
+		return dst, dst[l:]
+	}
+	dst = dst[:l+n]
+	tail := dst[l:]
+	for i := range tail {
+		tail[i] = 0
+	}
+	return dst, tail
+}
+
+// vectorMin is the smallest payload written to a stream separately from
+// the rest of its message, rather than copied into the same buffer.
+const vectorMin = 4096
+
+// writeComposed composes fc into a pooled buffer and writes it to w.
+func writeComposed(w io.Writer, fc FCall) (int64, error) {
+	buff := fc.AppendCompose(nil)
+	n, err := w.Write(buff)
+	PutBuffer(buff)
+	return int64(n), err
+}
+
+// writeVectored writes head, a pooled buffer, followed by data to w,
+// with a single vectored write if w supports it.
+func writeVectored(w io.Writer, head, data []byte) (int64, error) {
+	bufs := net.Buffers{head, data}
+	n, err := bufs.WriteTo(w)
+	PutBuffer(head)
+	return n, err
+}
+
 type ParseError struct {
 	Err string
 }
@@ -0,0 +1,74 @@
+package proto
+
+import "fmt"
+
+type TMkdir struct {
+	Header
+	Dfid uint32
+	Name string
+	Mode uint32
+	Gid  uint32
+}
+
+func (mkdir *TMkdir) String() string {
+	return fmt.Sprintf("tmkdir: [%s, dfid: %d, name: %s, mode: %o, gid: %d]",
+		&mkdir.Header, mkdir.Dfid, mkdir.Name, mkdir.Mode, mkdir.Gid)
+}
+
+func (mkdir *TMkdir) parse(buff []byte) ([]byte, error) {
+	mkdir.Dfid, buff = fromLittleE32(buff)
+	mkdir.Name, buff = fromString(buff)
+	mkdir.Mode, buff = fromLittleE32(buff)
+	mkdir.Gid, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (mkdir *TMkdir) Compose() []byte {
+	return mkdir.AppendCompose(nil)
+}
+
+func (mkdir *TMkdir) AppendCompose(dst []byte) []byte {
+	// size[4] Tmkdir tag[2] dfid[4] name[s] mode[4] gid[4]
+	length := 4 + 1 + 2 + 4 + (2 + len(mkdir.Name)) + 4 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = mkdir.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(mkdir.Tag, buffer)
+	buffer = toLittleE32(mkdir.Dfid, buffer)
+	buffer = toString(mkdir.Name, buffer)
+	buffer = toLittleE32(mkdir.Mode, buffer)
+	buffer = toLittleE32(mkdir.Gid, buffer)
+	return buff
+}
+
+type RMkdir struct {
+	Header
+	Qid Qid
+}
+
+func (mkdir *RMkdir) String() string {
+	return fmt.Sprintf("rmkdir: [%s, qid: [%s]]", &mkdir.Header, &mkdir.Qid)
+}
+
+func (mkdir *RMkdir) parse(buff []byte) ([]byte, error) {
+	return mkdir.Qid.parse(buff)
+}
+
+func (mkdir *RMkdir) Compose() []byte {
+	return mkdir.AppendCompose(nil)
+}
+
+func (mkdir *RMkdir) AppendCompose(dst []byte) []byte {
+	// size[4] Rmkdir tag[2] qid[13]
+	length := 4 + 1 + 2 + 13
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = mkdir.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(mkdir.Tag, buffer)
+	buffer = toQid(&mkdir.Qid, buffer)
+	return buff
+}
@@ -0,0 +1,80 @@
+package proto
+
+import "fmt"
+
+type TMknod struct {
+	Header
+	Dfid  uint32
+	Name  string
+	Mode  uint32
+	Major uint32
+	Minor uint32
+	Gid   uint32
+}
+
+func (mknod *TMknod) String() string {
+	return fmt.Sprintf("tmknod: [%s, dfid: %d, name: %s, mode: %o, major: %d, minor: %d, gid: %d]",
+		&mknod.Header, mknod.Dfid, mknod.Name, mknod.Mode, mknod.Major, mknod.Minor, mknod.Gid)
+}
+
+func (mknod *TMknod) parse(buff []byte) ([]byte, error) {
+	mknod.Dfid, buff = fromLittleE32(buff)
+	mknod.Name, buff = fromString(buff)
+	mknod.Mode, buff = fromLittleE32(buff)
+	mknod.Major, buff = fromLittleE32(buff)
+	mknod.Minor, buff = fromLittleE32(buff)
+	mknod.Gid, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (mknod *TMknod) Compose() []byte {
+	return mknod.AppendCompose(nil)
+}
+
+func (mknod *TMknod) AppendCompose(dst []byte) []byte {
+	// size[4] Tmknod tag[2] dfid[4] name[s] mode[4] major[4] minor[4] gid[4]
+	length := 4 + 1 + 2 + 4 + (2 + len(mknod.Name)) + 4 + 4 + 4 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = mknod.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(mknod.Tag, buffer)
+	buffer = toLittleE32(mknod.Dfid, buffer)
+	buffer = toString(mknod.Name, buffer)
+	buffer = toLittleE32(mknod.Mode, buffer)
+	buffer = toLittleE32(mknod.Major, buffer)
+	buffer = toLittleE32(mknod.Minor, buffer)
+	buffer = toLittleE32(mknod.Gid, buffer)
+	return buff
+}
+
+type RMknod struct {
+	Header
+	Qid Qid
+}
+
+func (mknod *RMknod) String() string {
+	return fmt.Sprintf("rmknod: [%s, qid: [%s]]", &mknod.Header, &mknod.Qid)
+}
+
+func (mknod *RMknod) parse(buff []byte) ([]byte, error) {
+	return mknod.Qid.parse(buff)
+}
+
+func (mknod *RMknod) Compose() []byte {
+	return mknod.AppendCompose(nil)
+}
+
+func (mknod *RMknod) AppendCompose(dst []byte) []byte {
+	// size[4] Rmknod tag[2] qid[13]
+	length := 4 + 1 + 2 + 13
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = mknod.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(mknod.Tag, buffer)
+	buffer = toQid(&mknod.Qid, buffer)
+	return buff
+}
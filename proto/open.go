@@ -17,6 +17,10 @@ const (
 
 const (
 	IOUnit = 16384
+	// IOHdrSize is room enough for the header of a Twrite or Rread
+	// message. The data carried by a message is at most msize less
+	// IOHdrSize.
+	IOHdrSize = 24
 )
 
 type TOpen struct {
@@ -40,10 +44,13 @@ func (open *TOpen) parse(buff []byte) ([]byte, error) {
 }
 
 func (open *TOpen) Compose() []byte {
+	return open.AppendCompose(nil)
+}
+
+func (open *TOpen) AppendCompose(dst []byte) []byte {
 	// size[4] Topen tag[2] fid[4] mode[1]
 	length := 4 + 1 + 2 + 4 + 1
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = open.Type
@@ -76,18 +83,19 @@ func (open *ROpen) parse(buff []byte) ([]byte, error) {
 }
 
 func (open *ROpen) Compose() []byte {
+	return open.AppendCompose(nil)
+}
+
+func (open *ROpen) AppendCompose(dst []byte) []byte {
 	// size[4] Ropen tag[2] qid[13] iounit[4]
 	length := 4 + 1 + 2 + 13 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = open.Type
 	buffer = buffer[1:]
 	buffer = toLittleE16(open.Tag, buffer)
-	qidbuff := open.Qid.Compose()
-	copy(buffer, qidbuff)
-	buffer = buffer[len(qidbuff):]
+	buffer = toQid(&open.Qid, buffer)
 	buffer = toLittleE32(open.Iounit, buffer)
 	return buff
 }
@@ -0,0 +1,56 @@
+package proto
+
+import (
+	"sync"
+)
+
+// Buffers for composing and parsing messages come from pools, one for
+// each power of two size between minPooled and MaxMsize. Larger buffers
+// are allocated directly.
+const minPooled = 512
+
+var pools [15]sync.Pool // minPooled << 14 == MaxMsize
+
+// poolIndex returns the index of the pool holding buffers with capacity
+// size, rounding up if round is true, or -1 if there is no such pool.
+func poolIndex(size int, round bool) int {
+	class := minPooled
+	for i := range pools {
+		if size == class || (round && size < class) {
+			return i
+		}
+		if class >= MaxMsize {
+			break
+		}
+		class <<= 1
+	}
+	return -1
+}
+
+// getBuffer returns a zeroed buffer of length n.
+func getBuffer(n int) []byte {
+	i := poolIndex(n, true)
+	if i < 0 {
+		return make([]byte, n)
+	}
+	if b, ok := pools[i].Get().([]byte); ok {
+		b = b[:n]
+		for j := range b {
+			b[j] = 0
+		}
+		return b
+	}
+	return make([]byte, n, minPooled<<uint(i))
+}
+
+// PutBuffer returns b, a buffer returned by an FCall's Compose method,
+// to the pool it came from, so that it may be reused by later calls.
+// b must not be used after it has been returned. Buffers that are never
+// returned are simply garbage collected.
+func PutBuffer(b []byte) {
+	i := poolIndex(cap(b), false)
+	if i < 0 {
+		return
+	}
+	pools[i].Put(b[:0])
+}
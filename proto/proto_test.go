@@ -3,6 +3,7 @@ package proto
 import (
 	"bytes"
 	"encoding/binary"
+	"io/ioutil"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -18,22 +19,23 @@ func randQid() Qid {
 	return Qid{uint8(rand.Int31n(256)), rand.Uint32(), rand.Uint64()}
 }
 
-func TestMarshall(t *testing.T) {
-	for _, tt := range []FCall{
+// sampleCalls returns a message of every type.
+func sampleCalls() []FCall {
+	return []FCall{
 		&TRVersion{randHeader(Tversion), rand.Uint32(), "version"},
 		&TRVersion{randHeader(Rversion), rand.Uint32(), "version"},
-		&TAuth{randHeader(Tauth), rand.Uint32(), "UNAME", "ANAME"},
+		&TAuth{randHeader(Tauth), rand.Uint32(), "UNAME", "ANAME", NoUid},
 		&RAuth{randHeader(Rauth), randQid()},
-		&TAttach{randHeader(Tattach), rand.Uint32(), rand.Uint32(), "UNAME", "ANAME"},
+		&TAttach{randHeader(Tattach), rand.Uint32(), rand.Uint32(), "UNAME", "ANAME", NoUid},
 		&RAttach{randHeader(Rattach), randQid()},
-		&RError{randHeader(Rerror), "ERROR"},
+		&RError{randHeader(Rerror), "ERROR", 0},
 		&TFlush{randHeader(Tflush), uint16(rand.Uint32())},
 		&RFlush{randHeader(Rflush)},
 		&TWalk{randHeader(Twalk), rand.Uint32(), rand.Uint32(), 2, []string{"wname1", "wname2"}},
 		&RWalk{randHeader(Rwalk), 2, []Qid{randQid(), randQid()}},
 		&TOpen{randHeader(Topen), rand.Uint32(), Mode(rand.Uint32())},
 		&ROpen{randHeader(Ropen), randQid(), rand.Uint32()},
-		&TCreate{randHeader(Tcreate), rand.Uint32(), "NAME", rand.Uint32(), uint8(rand.Uint32())},
+		&TCreate{randHeader(Tcreate), rand.Uint32(), "NAME", rand.Uint32(), uint8(rand.Uint32()), ""},
 		&RCreate{randHeader(Rcreate), randQid(), rand.Uint32()},
 		&TRead{randHeader(Tread), rand.Uint32(), rand.Uint64(), rand.Uint32()},
 		&RRead{randHeader(Rread), 10, make([]byte, 10)},
@@ -56,6 +58,10 @@ func TestMarshall(t *testing.T) {
 			"Uid",
 			"Gid",
 			"Muid",
+			"",
+			NoUid,
+			NoUid,
+			NoUid,
 		}},
 		&TWstat{randHeader(Twstat), rand.Uint32(), Stat{
 			uint16(rand.Uint32()),
@@ -69,12 +75,121 @@ func TestMarshall(t *testing.T) {
 			"Uid",
 			"Gid",
 			"Muid",
+			"",
+			NoUid,
+			NoUid,
+			NoUid,
 		}},
 		&RWstat{randHeader(Rwstat)},
+		&RLerror{randHeader(Rlerror), rand.Uint32()},
+		&TStatfs{randHeader(Tstatfs), rand.Uint32()},
+		&RStatfs{randHeader(Rstatfs), rand.Uint32(), rand.Uint32(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint32()},
+		&TLopen{randHeader(Tlopen), rand.Uint32(), rand.Uint32()},
+		&RLopen{randHeader(Rlopen), randQid(), rand.Uint32()},
+		&TLcreate{randHeader(Tlcreate), rand.Uint32(), "NAME", rand.Uint32(), rand.Uint32(), rand.Uint32()},
+		&RLcreate{randHeader(Rlcreate), randQid(), rand.Uint32()},
+		&TSymlink{randHeader(Tsymlink), rand.Uint32(), "NAME", "TARGET", rand.Uint32()},
+		&RSymlink{randHeader(Rsymlink), randQid()},
+		&TMknod{randHeader(Tmknod), rand.Uint32(), "NAME", rand.Uint32(), rand.Uint32(), rand.Uint32(), rand.Uint32()},
+		&RMknod{randHeader(Rmknod), randQid()},
+		&TRename{randHeader(Trename), rand.Uint32(), rand.Uint32(), "NAME"},
+		&RRename{randHeader(Rrename)},
+		&TReadlink{randHeader(Treadlink), rand.Uint32()},
+		&RReadlink{randHeader(Rreadlink), "TARGET"},
+		&TGetattr{randHeader(Tgetattr), rand.Uint32(), rand.Uint64()},
+		&RGetattr{randHeader(Rgetattr), rand.Uint64(), randQid(), rand.Uint32(), rand.Uint32(), rand.Uint32(),
+			rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(),
+			rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(),
+			rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64()},
+		&TSetattr{randHeader(Tsetattr), rand.Uint32(), rand.Uint32(), rand.Uint32(), rand.Uint32(), rand.Uint32(),
+			rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64()},
+		&RSetattr{randHeader(Rsetattr)},
+		&TXattrwalk{randHeader(Txattrwalk), rand.Uint32(), rand.Uint32(), "NAME"},
+		&RXattrwalk{randHeader(Rxattrwalk), rand.Uint64()},
+		&TXattrcreate{randHeader(Txattrcreate), rand.Uint32(), "NAME", rand.Uint64(), rand.Uint32()},
+		&RXattrcreate{randHeader(Rxattrcreate)},
+		&TReaddir{randHeader(Treaddir), rand.Uint32(), rand.Uint64(), rand.Uint32()},
+		&RReaddir{randHeader(Rreaddir), 10, make([]byte, 10)},
+		&TFsync{randHeader(Tfsync), rand.Uint32(), rand.Uint32()},
+		&RFsync{randHeader(Rfsync)},
+		&TLock{randHeader(Tlock), rand.Uint32(), LockTypeWrlck, rand.Uint32(), rand.Uint64(), rand.Uint64(), rand.Uint32(), "CLIENT"},
+		&RLock{randHeader(Rlock), LockSuccess},
+		&TGetlock{randHeader(Tgetlock), rand.Uint32(), LockTypeRdlck, rand.Uint64(), rand.Uint64(), rand.Uint32(), "CLIENT"},
+		&RGetlock{randHeader(Rgetlock), LockTypeUnlck, rand.Uint64(), rand.Uint64(), rand.Uint32(), "CLIENT"},
+		&TLink{randHeader(Tlink), rand.Uint32(), rand.Uint32(), "NAME"},
+		&RLink{randHeader(Rlink)},
+		&TMkdir{randHeader(Tmkdir), rand.Uint32(), "NAME", rand.Uint32(), rand.Uint32()},
+		&RMkdir{randHeader(Rmkdir), randQid()},
+		&TRenameat{randHeader(Trenameat), rand.Uint32(), "OLD", rand.Uint32(), "NEW"},
+		&RRenameat{randHeader(Rrenameat)},
+		&TUnlinkat{randHeader(Tunlinkat), rand.Uint32(), "NAME", AtRemovedir},
+		&RUnlinkat{randHeader(Runlinkat)},
+	}
+}
+
+func callName(fc FCall) string {
+	return reflect.TypeOf(fc).Elem().Name()
+}
+
+func TestMarshall(t *testing.T) {
+	for _, tt := range sampleCalls() {
+		t.Run(callName(tt), func(t *testing.T) {
+			assert := assert.New(t)
+			comp := tt.Compose()
+			r := bytes.NewReader(comp)
+			c, err := ParseCall(r)
+			assert.NoError(err)
+			assert.Equal(tt, c)
+		})
+	}
+}
+
+func TestComposeDialect(t *testing.T) {
+	for _, tt := range []FCall{
+		&TAuth{randHeader(Tauth), rand.Uint32(), "UNAME", "ANAME", 1000},
+		&TAttach{randHeader(Tattach), rand.Uint32(), rand.Uint32(), "UNAME", "ANAME", 1000},
+		&TClunk{randHeader(Tclunk), rand.Uint32()},
 	} {
 		t.Run(reflect.TypeOf(tt).Elem().Name(), func(t *testing.T) {
 			assert := assert.New(t)
-			comp := tt.Compose()
+			comp := ComposeDialect(tt, DotL)
+			r := bytes.NewReader(comp)
+			c, err := ParseCall(r)
+			assert.NoError(err)
+			assert.Equal(tt, c)
+		})
+	}
+}
+
+func TestComposeDotU(t *testing.T) {
+	stat := Stat{
+		uint16(rand.Uint32()),
+		rand.Uint32(),
+		randQid(),
+		DMSYMLINK | 0777,
+		rand.Uint32(),
+		rand.Uint32(),
+		rand.Uint64(),
+		"NAME",
+		"Uid",
+		"Gid",
+		"Muid",
+		"TARGET",
+		1000,
+		1000,
+		0,
+	}
+	for _, tt := range []FCall{
+		&TAuth{randHeader(Tauth), rand.Uint32(), "UNAME", "ANAME", 1000},
+		&TAttach{randHeader(Tattach), rand.Uint32(), rand.Uint32(), "UNAME", "ANAME", 1000},
+		&RError{randHeader(Rerror), "ERROR", ENOENT},
+		&TCreate{randHeader(Tcreate), rand.Uint32(), "NAME", DMSYMLINK | 0777, uint8(Oread), "TARGET"},
+		&RStat{randHeader(Rstat), stat},
+		&TWstat{randHeader(Twstat), rand.Uint32(), stat},
+	} {
+		t.Run(reflect.TypeOf(tt).Elem().Name(), func(t *testing.T) {
+			assert := assert.New(t)
+			comp := ComposeDialect(tt, DotU)
 			r := bytes.NewReader(comp)
 			c, err := ParseCall(r)
 			assert.NoError(err)
@@ -83,6 +198,21 @@ func TestMarshall(t *testing.T) {
 	}
 }
 
+func TestDirents(t *testing.T) {
+	assert := assert.New(t)
+	ents := []Dirent{
+		{randQid(), 1, DTDir, "dir"},
+		{randQid(), 2, DTReg, "file"},
+	}
+	var buff []byte
+	for i := range ents {
+		buff = append(buff, ents[i].Compose()...)
+	}
+	parsed, err := ParseDirents(buff)
+	assert.NoError(err)
+	assert.Equal(ents, parsed)
+}
+
 func TestBadMessage(t *testing.T) {
 	t.Run("Random", func(t *testing.T) {
 		assert := assert.New(t)
@@ -100,6 +230,14 @@ func TestBadMessage(t *testing.T) {
 		assert.Error(err)
 		assert.Nil(fc)
 	})
+	t.Run("Short", func(t *testing.T) {
+		assert := assert.New(t)
+		bs := make([]byte, 1024)
+		binary.LittleEndian.PutUint32(bs, 2)
+		fc, err := ParseCall(bytes.NewReader(bs))
+		assert.Error(err)
+		assert.Nil(fc)
+	})
 	t.Run("BadTag", func(t *testing.T) {
 		assert := assert.New(t)
 		bs := make([]byte, 1024)
@@ -110,3 +248,123 @@ func TestBadMessage(t *testing.T) {
 		assert.Nil(fc)
 	})
 }
+
+func TestParseCallSize(t *testing.T) {
+	assert := assert.New(t)
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	write := &TWrite{randHeader(Twrite), rand.Uint32(), rand.Uint64(), uint32(len(data)), data}
+	bs := write.Compose()
+
+	_, err := ParseCall(bytes.NewReader(bs))
+	assert.Error(err)
+	_, err = ParseCallSize(bytes.NewReader(bs), 1<<19)
+	assert.Error(err)
+	parsed, err := ParseCallSize(bytes.NewReader(bs), MaxMsize)
+	assert.NoError(err)
+	assert.Equal(write, parsed)
+	PutBuffer(bs)
+
+	// Reused buffers must not leak old contents, or alias parsed data.
+	read := &TRead{randHeader(Tread), rand.Uint32(), rand.Uint64(), rand.Uint32()}
+	assert.Equal(read.Compose(), append([]byte(nil), read.Compose()...))
+	bs = (&RRead{randHeader(Rread), 3, []byte("abc")}).Compose()
+	parsed, err = ParseCall(bytes.NewReader(bs))
+	assert.NoError(err)
+	PutBuffer(bs)
+	for i := 0; i < 10; i++ {
+		PutBuffer((&RRead{randHeader(Rread), 3, []byte("xyz")}).Compose())
+	}
+	assert.Equal([]byte("abc"), parsed.(*RRead).Data)
+}
+
+func TestAppendCompose(t *testing.T) {
+	big := make([]byte, 2*vectorMin)
+	rand.Read(big)
+	calls := append(sampleCalls(),
+		&RRead{randHeader(Rread), uint32(len(big)), big},
+		&TWrite{randHeader(Twrite), rand.Uint32(), rand.Uint64(), uint32(len(big)), big},
+	)
+	for _, tt := range calls {
+		t.Run(callName(tt), func(t *testing.T) {
+			assert := assert.New(t)
+			for _, d := range []Dialect{Plan9, DotU, DotL} {
+				expected := ComposeDialect(tt, d)
+				prefix := []byte("prefix")
+				assert.Equal(append(prefix, expected...), AppendComposeDialect(prefix, tt, d))
+				dirty := bytes.Repeat([]byte{0xFF}, len(expected))
+				assert.Equal(expected, AppendComposeDialect(dirty[:0], tt, d))
+
+				var w bytes.Buffer
+				assert.NoError(WriteCall(&w, tt, d))
+				assert.Equal(expected, w.Bytes())
+			}
+		})
+	}
+}
+
+func BenchmarkCompose(b *testing.B) {
+	for _, fc := range sampleCalls() {
+		fc := fc
+		b.Run(callName(fc), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fc.Compose()
+			}
+		})
+	}
+}
+
+func BenchmarkAppendCompose(b *testing.B) {
+	for _, fc := range sampleCalls() {
+		fc := fc
+		b.Run(callName(fc), func(b *testing.B) {
+			b.ReportAllocs()
+			buff := make([]byte, 0, MaxMsgLen)
+			for i := 0; i < b.N; i++ {
+				buff = fc.AppendCompose(buff[:0])
+			}
+		})
+	}
+}
+
+func BenchmarkParseCall(b *testing.B) {
+	for _, fc := range sampleCalls() {
+		fc := fc
+		b.Run(callName(fc), func(b *testing.B) {
+			b.ReportAllocs()
+			buff := fc.Compose()
+			r := bytes.NewReader(buff)
+			for i := 0; i < b.N; i++ {
+				r.Reset(buff)
+				if _, err := ParseCall(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriteCall(b *testing.B) {
+	data := make([]byte, 1<<20)
+	for _, fc := range []FCall{
+		&RRead{randHeader(Rread), uint32(len(data)), data},
+		&TWrite{randHeader(Twrite), rand.Uint32(), rand.Uint64(), uint32(len(data)), data},
+	} {
+		fc := fc
+		b.Run(callName(fc)+"/Compose", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				ioutil.Discard.Write(fc.Compose())
+			}
+		})
+		b.Run(callName(fc)+"/WriteCall", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				WriteCall(ioutil.Discard, fc, Plan9)
+			}
+		})
+	}
+}
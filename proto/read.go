@@ -1,6 +1,9 @@
 package proto
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 type TRead struct {
 	Header
@@ -22,10 +25,13 @@ func (read *TRead) parse(buff []byte) ([]byte, error) {
 }
 
 func (read *TRead) Compose() []byte {
+	return read.AppendCompose(nil)
+}
+
+func (read *TRead) AppendCompose(dst []byte) []byte {
 	// size[4] Twrite tag[2] fid[4] offset[8] count[4]
 	length := 4 + 1 + 2 + 4 + 8 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = read.Type
@@ -55,10 +61,13 @@ func (read *RRead) parse(buff []byte) ([]byte, error) {
 }
 
 func (read *RRead) Compose() []byte {
+	return read.AppendCompose(nil)
+}
+
+func (read *RRead) AppendCompose(dst []byte) []byte {
 	// size[4] Rread tag[2] count[4] data[count]
 	length := 4 + 1 + 2 + 4 + read.Count
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, int(length))
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = read.Type
@@ -68,3 +77,21 @@ func (read *RRead) Compose() []byte {
 	copy(buffer, read.Data)
 	return buff
 }
+
+// WriteTo writes the marshaled message to w. Large payloads are written
+// directly from read.Data rather than copied.
+func (read *RRead) WriteTo(w io.Writer) (int64, error) {
+	if read.Count < vectorMin || uint32(len(read.Data)) < read.Count {
+		return writeComposed(w, read)
+	}
+	// size[4] Rread tag[2] count[4]
+	length := 4 + 1 + 2 + 4
+	head, buffer := grow(nil, length)
+
+	buffer = toLittleE32(uint32(length)+read.Count, buffer)
+	buffer[0] = read.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(read.Tag, buffer)
+	buffer = toLittleE32(read.Count, buffer)
+	return writeVectored(w, head, read.Data[:read.Count])
+}
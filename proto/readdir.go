@@ -0,0 +1,154 @@
+package proto
+
+import "fmt"
+
+// Directory entry types for Dirent.Type. These are the Linux DT_* values.
+const (
+	DTUnknown = 0
+	DTDir     = 4
+	DTReg     = 8
+	DTLnk     = 10
+)
+
+type TReaddir struct {
+	Header
+	Fid    uint32
+	Offset uint64
+	Count  uint32
+}
+
+func (readdir *TReaddir) String() string {
+	return fmt.Sprintf("treaddir: [%s, fid: %d, offset: %d, count: %d]",
+		&readdir.Header, readdir.Fid, readdir.Offset, readdir.Count)
+}
+
+func (readdir *TReaddir) parse(buff []byte) ([]byte, error) {
+	readdir.Fid, buff = fromLittleE32(buff)
+	readdir.Offset, buff = fromLittleE64(buff)
+	readdir.Count, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (readdir *TReaddir) Compose() []byte {
+	return readdir.AppendCompose(nil)
+}
+
+func (readdir *TReaddir) AppendCompose(dst []byte) []byte {
+	// size[4] Treaddir tag[2] fid[4] offset[8] count[4]
+	length := 4 + 1 + 2 + 4 + 8 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = readdir.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(readdir.Tag, buffer)
+	buffer = toLittleE32(readdir.Fid, buffer)
+	buffer = toLittleE64(readdir.Offset, buffer)
+	buffer = toLittleE32(readdir.Count, buffer)
+	return buff
+}
+
+// RReaddir carries a sequence of marshaled Dirents in Data.
+// See Dirent.Compose and ParseDirents.
+type RReaddir struct {
+	Header
+	Count uint32
+	Data  []byte
+}
+
+func (readdir *RReaddir) String() string {
+	return fmt.Sprintf("rreaddir: [%s, count: %d]", &readdir.Header, readdir.Count)
+}
+
+func (readdir *RReaddir) parse(buff []byte) ([]byte, error) {
+	readdir.Count, buff = fromLittleE32(buff)
+	if uint32(len(buff)) < readdir.Count {
+		return nil, &ParseError{"rreaddir: count exceeds message length"}
+	}
+	readdir.Data = make([]byte, readdir.Count)
+	copy(readdir.Data, buff[:readdir.Count])
+	return buff[readdir.Count:], nil
+}
+
+func (readdir *RReaddir) Compose() []byte {
+	return readdir.AppendCompose(nil)
+}
+
+func (readdir *RReaddir) AppendCompose(dst []byte) []byte {
+	// size[4] Rreaddir tag[2] count[4] data[count]
+	length := 4 + 1 + 2 + 4 + readdir.Count
+	buff, buffer := grow(dst, int(length))
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = readdir.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(readdir.Tag, buffer)
+	buffer = toLittleE32(readdir.Count, buffer)
+	copy(buffer, readdir.Data)
+	return buff
+}
+
+// Dirent is a directory entry as returned in the data of an RReaddir.
+// Offset is the offset a client should send in a subsequent TReaddir to
+// continue reading after this entry.
+type Dirent struct {
+	Qid    Qid
+	Offset uint64
+	Type   uint8
+	Name   string
+}
+
+func (dirent *Dirent) String() string {
+	return fmt.Sprintf("qid: [%s], offset: %d, type: %d, name: %s",
+		&dirent.Qid, dirent.Offset, dirent.Type, dirent.Name)
+}
+
+// ParseDirents parses the Data of an RReaddir.
+func ParseDirents(buff []byte) ([]Dirent, error) {
+	dirents := make([]Dirent, 0)
+	var err error
+	for len(buff) > 0 {
+		d := Dirent{}
+		buff, err = d.parse(buff)
+		if err != nil {
+			return nil, err
+		}
+		dirents = append(dirents, d)
+	}
+	return dirents, nil
+}
+
+func (dirent *Dirent) parse(buff []byte) ([]byte, error) {
+	buff, err := dirent.Qid.parse(buff)
+	if err != nil {
+		return nil, err
+	}
+	dirent.Offset, buff = fromLittleE64(buff)
+	dirent.Type, buff = fromByte(buff)
+	if buff == nil {
+		return nil, &ParseError{"dirent: reached end of buffer"}
+	}
+	dirent.Name, buff = fromString(buff)
+	return buff, nil
+}
+
+func (dirent *Dirent) ComposeLength() uint32 {
+	// qid[13] offset[8] type[1] name[s]
+	return uint32(13 + 8 + 1 + (2 + len(dirent.Name)))
+}
+
+func (dirent *Dirent) Compose() []byte {
+	return dirent.AppendCompose(make([]byte, 0, dirent.ComposeLength()))
+}
+
+// AppendCompose appends the marshaled Dirent to dst.
+func (dirent *Dirent) AppendCompose(dst []byte) []byte {
+	buff, buffer := grow(dst, int(dirent.ComposeLength()))
+
+	buffer = toQid(&dirent.Qid, buffer)
+	buffer = toLittleE64(dirent.Offset, buffer)
+	buffer[0] = dirent.Type
+	buffer = buffer[1:]
+	buffer = toString(dirent.Name, buffer)
+	return buff
+}
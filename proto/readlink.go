@@ -0,0 +1,65 @@
+package proto
+
+import "fmt"
+
+type TReadlink struct {
+	Header
+	Fid uint32
+}
+
+func (readlink *TReadlink) String() string {
+	return fmt.Sprintf("treadlink: [%s, fid: %d]", &readlink.Header, readlink.Fid)
+}
+
+func (readlink *TReadlink) parse(buff []byte) ([]byte, error) {
+	readlink.Fid, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (readlink *TReadlink) Compose() []byte {
+	return readlink.AppendCompose(nil)
+}
+
+func (readlink *TReadlink) AppendCompose(dst []byte) []byte {
+	// size[4] Treadlink tag[2] fid[4]
+	length := 4 + 1 + 2 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = readlink.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(readlink.Tag, buffer)
+	buffer = toLittleE32(readlink.Fid, buffer)
+	return buff
+}
+
+type RReadlink struct {
+	Header
+	Target string
+}
+
+func (readlink *RReadlink) String() string {
+	return fmt.Sprintf("rreadlink: [%s, target: %s]", &readlink.Header, readlink.Target)
+}
+
+func (readlink *RReadlink) parse(buff []byte) ([]byte, error) {
+	readlink.Target, buff = fromString(buff)
+	return buff, nil
+}
+
+func (readlink *RReadlink) Compose() []byte {
+	return readlink.AppendCompose(nil)
+}
+
+func (readlink *RReadlink) AppendCompose(dst []byte) []byte {
+	// size[4] Rreadlink tag[2] target[s]
+	length := 4 + 1 + 2 + (2 + len(readlink.Target))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = readlink.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(readlink.Tag, buffer)
+	buffer = toString(readlink.Target, buffer)
+	return buff
+}
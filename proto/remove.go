@@ -17,10 +17,13 @@ func (remove *TRemove) parse(buff []byte) ([]byte, error) {
 }
 
 func (remove *TRemove) Compose() []byte {
+	return remove.AppendCompose(nil)
+}
+
+func (remove *TRemove) AppendCompose(dst []byte) []byte {
 	// size[4] Tremove tag[2] fid[4]
 	length := 4 + 1 + 2 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = remove.Type
@@ -43,10 +46,13 @@ func (remove *RRemove) parse(buff []byte) ([]byte, error) {
 }
 
 func (remove *RRemove) Compose() []byte {
+	return remove.AppendCompose(nil)
+}
+
+func (remove *RRemove) AppendCompose(dst []byte) []byte {
 	// size[4] Rwstat tag[2]
 	length := 4 + 1 + 2
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = remove.Type
@@ -0,0 +1,69 @@
+package proto
+
+import "fmt"
+
+type TRename struct {
+	Header
+	Fid  uint32
+	Dfid uint32
+	Name string
+}
+
+func (rename *TRename) String() string {
+	return fmt.Sprintf("trename: [%s, fid: %d, dfid: %d, name: %s]",
+		&rename.Header, rename.Fid, rename.Dfid, rename.Name)
+}
+
+func (rename *TRename) parse(buff []byte) ([]byte, error) {
+	rename.Fid, buff = fromLittleE32(buff)
+	rename.Dfid, buff = fromLittleE32(buff)
+	rename.Name, buff = fromString(buff)
+	return buff, nil
+}
+
+func (rename *TRename) Compose() []byte {
+	return rename.AppendCompose(nil)
+}
+
+func (rename *TRename) AppendCompose(dst []byte) []byte {
+	// size[4] Trename tag[2] fid[4] dfid[4] name[s]
+	length := 4 + 1 + 2 + 4 + 4 + (2 + len(rename.Name))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = rename.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(rename.Tag, buffer)
+	buffer = toLittleE32(rename.Fid, buffer)
+	buffer = toLittleE32(rename.Dfid, buffer)
+	buffer = toString(rename.Name, buffer)
+	return buff
+}
+
+type RRename struct {
+	Header
+}
+
+func (rename *RRename) String() string {
+	return fmt.Sprintf("rrename: [%s]", &rename.Header)
+}
+
+func (rename *RRename) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (rename *RRename) Compose() []byte {
+	return rename.AppendCompose(nil)
+}
+
+func (rename *RRename) AppendCompose(dst []byte) []byte {
+	// size[4] Rrename tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = rename.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(rename.Tag, buffer)
+	return buff
+}
@@ -0,0 +1,72 @@
+package proto
+
+import "fmt"
+
+type TRenameat struct {
+	Header
+	Olddirfid uint32
+	Oldname   string
+	Newdirfid uint32
+	Newname   string
+}
+
+func (renameat *TRenameat) String() string {
+	return fmt.Sprintf("trenameat: [%s, olddirfid: %d, oldname: %s, newdirfid: %d, newname: %s]",
+		&renameat.Header, renameat.Olddirfid, renameat.Oldname, renameat.Newdirfid, renameat.Newname)
+}
+
+func (renameat *TRenameat) parse(buff []byte) ([]byte, error) {
+	renameat.Olddirfid, buff = fromLittleE32(buff)
+	renameat.Oldname, buff = fromString(buff)
+	renameat.Newdirfid, buff = fromLittleE32(buff)
+	renameat.Newname, buff = fromString(buff)
+	return buff, nil
+}
+
+func (renameat *TRenameat) Compose() []byte {
+	return renameat.AppendCompose(nil)
+}
+
+func (renameat *TRenameat) AppendCompose(dst []byte) []byte {
+	// size[4] Trenameat tag[2] olddirfid[4] oldname[s] newdirfid[4] newname[s]
+	length := 4 + 1 + 2 + 4 + (2 + len(renameat.Oldname)) + 4 + (2 + len(renameat.Newname))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = renameat.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(renameat.Tag, buffer)
+	buffer = toLittleE32(renameat.Olddirfid, buffer)
+	buffer = toString(renameat.Oldname, buffer)
+	buffer = toLittleE32(renameat.Newdirfid, buffer)
+	buffer = toString(renameat.Newname, buffer)
+	return buff
+}
+
+type RRenameat struct {
+	Header
+}
+
+func (renameat *RRenameat) String() string {
+	return fmt.Sprintf("rrenameat: [%s]", &renameat.Header)
+}
+
+func (renameat *RRenameat) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (renameat *RRenameat) Compose() []byte {
+	return renameat.AppendCompose(nil)
+}
+
+func (renameat *RRenameat) AppendCompose(dst []byte) []byte {
+	// size[4] Rrenameat tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = renameat.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(renameat.Tag, buffer)
+	return buff
+}
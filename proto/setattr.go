@@ -0,0 +1,105 @@
+package proto
+
+import "fmt"
+
+// Bits for the Valid field of TSetattr.
+const (
+	SetattrMode     = 0x00000001
+	SetattrUid      = 0x00000002
+	SetattrGid      = 0x00000004
+	SetattrSize     = 0x00000008
+	SetattrAtime    = 0x00000010
+	SetattrMtime    = 0x00000020
+	SetattrCtime    = 0x00000040
+	SetattrAtimeSet = 0x00000080 // Use the provided atime rather than the server's current time.
+	SetattrMtimeSet = 0x00000100 // Use the provided mtime rather than the server's current time.
+)
+
+type TSetattr struct {
+	Header
+	Fid       uint32
+	Valid     uint32
+	Mode      uint32
+	Uid       uint32
+	Gid       uint32
+	Size      uint64
+	AtimeSec  uint64
+	AtimeNsec uint64
+	MtimeSec  uint64
+	MtimeNsec uint64
+}
+
+func (setattr *TSetattr) String() string {
+	return fmt.Sprintf("tsetattr: [%s, fid: %d, valid: 0x%X, mode: %o, uid: %d, gid: %d, size: %d, atime: %d.%09d, mtime: %d.%09d]",
+		&setattr.Header, setattr.Fid, setattr.Valid, setattr.Mode, setattr.Uid, setattr.Gid,
+		setattr.Size, setattr.AtimeSec, setattr.AtimeNsec, setattr.MtimeSec, setattr.MtimeNsec)
+}
+
+func (setattr *TSetattr) parse(buff []byte) ([]byte, error) {
+	setattr.Fid, buff = fromLittleE32(buff)
+	setattr.Valid, buff = fromLittleE32(buff)
+	setattr.Mode, buff = fromLittleE32(buff)
+	setattr.Uid, buff = fromLittleE32(buff)
+	setattr.Gid, buff = fromLittleE32(buff)
+	setattr.Size, buff = fromLittleE64(buff)
+	setattr.AtimeSec, buff = fromLittleE64(buff)
+	setattr.AtimeNsec, buff = fromLittleE64(buff)
+	setattr.MtimeSec, buff = fromLittleE64(buff)
+	setattr.MtimeNsec, buff = fromLittleE64(buff)
+	return buff, nil
+}
+
+func (setattr *TSetattr) Compose() []byte {
+	return setattr.AppendCompose(nil)
+}
+
+func (setattr *TSetattr) AppendCompose(dst []byte) []byte {
+	// size[4] Tsetattr tag[2] fid[4] valid[4] mode[4] uid[4] gid[4] size[8]
+	// atime_sec[8] atime_nsec[8] mtime_sec[8] mtime_nsec[8]
+	length := 4 + 1 + 2 + 4 + 4 + 4 + 4 + 4 + 8 + 8 + 8 + 8 + 8
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = setattr.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(setattr.Tag, buffer)
+	buffer = toLittleE32(setattr.Fid, buffer)
+	buffer = toLittleE32(setattr.Valid, buffer)
+	buffer = toLittleE32(setattr.Mode, buffer)
+	buffer = toLittleE32(setattr.Uid, buffer)
+	buffer = toLittleE32(setattr.Gid, buffer)
+	buffer = toLittleE64(setattr.Size, buffer)
+	buffer = toLittleE64(setattr.AtimeSec, buffer)
+	buffer = toLittleE64(setattr.AtimeNsec, buffer)
+	buffer = toLittleE64(setattr.MtimeSec, buffer)
+	buffer = toLittleE64(setattr.MtimeNsec, buffer)
+	return buff
+}
+
+type RSetattr struct {
+	Header
+}
+
+func (setattr *RSetattr) String() string {
+	return fmt.Sprintf("rsetattr: [%s]", &setattr.Header)
+}
+
+func (setattr *RSetattr) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (setattr *RSetattr) Compose() []byte {
+	return setattr.AppendCompose(nil)
+}
+
+func (setattr *RSetattr) AppendCompose(dst []byte) []byte {
+	// size[4] Rsetattr tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = setattr.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(setattr.Tag, buffer)
+	return buff
+}
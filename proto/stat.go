@@ -1,12 +1,23 @@
 package proto
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 const (
 	DMDIR    = uint32(1 << 31)
 	DMAPPEND = uint32(1 << 30)
 	DMEXCL   = uint32(1 << 29)
 	DMTMP    = uint32(1 << 26)
+
+	// The following modes are defined by 9P2000.u.
+	DMSYMLINK   = uint32(1 << 25)
+	DMDEVICE    = uint32(1 << 23)
+	DMNAMEDPIPE = uint32(1 << 21)
+	DMSOCKET    = uint32(1 << 20)
+	DMSETUID    = uint32(1 << 19)
+	DMSETGID    = uint32(1 << 18)
 )
 
 type TStat struct {
@@ -24,10 +35,13 @@ func (stat *TStat) parse(buff []byte) ([]byte, error) {
 }
 
 func (stat *TStat) Compose() []byte {
+	return stat.AppendCompose(nil)
+}
+
+func (stat *TStat) AppendCompose(dst []byte) []byte {
 	// size[4] Twrite tag[2] fid[4]
 	length := 4 + 1 + 2 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = stat.Type
@@ -50,13 +64,41 @@ type Stat struct {
 	Uid    string
 	Gid    string
 	Muid   string
+
+	// The remaining fields are only sent on 9P2000.u connections.
+	// Extension holds the target of a symlink or the description of a
+	// device. NUid, NGid and NMuid are the numeric equivalents of Uid,
+	// Gid and Muid, or NoUid if they are unknown.
+	Extension string
+	NUid      uint32
+	NGid      uint32
+	NMuid     uint32
+}
+
+// NullStat returns a Stat that changes nothing when sent in a Twstat:
+// its integer fields hold their maximum values and its strings are
+// empty. Set the fields to be changed before sending it. This is
+// nulldir in Plan 9's libc.
+func NullStat() Stat {
+	return Stat{
+		Type:   math.MaxUint16,
+		Dev:    math.MaxUint32,
+		Qid:    Qid{Qtype: math.MaxUint8, Vers: math.MaxUint32, Uid: math.MaxUint64},
+		Mode:   math.MaxUint32,
+		Atime:  math.MaxUint32,
+		Mtime:  math.MaxUint32,
+		Length: math.MaxUint64,
+		NUid:   NoUid,
+		NGid:   NoUid,
+		NMuid:  NoUid,
+	}
 }
 
 func (stat *Stat) String() string {
-	return fmt.Sprintf("stype: %d, dev: %d, qid: [%s], mode: %o, atime: %d, mtime: %d, length: %d, name: %s, uid: %s, gid: %s, muid: %s",
+	return fmt.Sprintf("stype: %d, dev: %d, qid: [%s], mode: %o, atime: %d, mtime: %d, length: %d, name: %s, uid: %s, gid: %s, muid: %s, extension: %s, n_uid: %d, n_gid: %d, n_muid: %d",
 		stat.Type, stat.Dev, &stat.Qid, stat.Mode,
 		stat.Atime, stat.Mtime, stat.Length, stat.Name, stat.Uid,
-		stat.Gid, stat.Muid)
+		stat.Gid, stat.Muid, stat.Extension, stat.NUid, stat.NGid, stat.NMuid)
 }
 
 func ParseStats(buff []byte) ([]Stat, error) {
@@ -74,7 +116,12 @@ func ParseStats(buff []byte) ([]Stat, error) {
 }
 
 func (stat *Stat) parse(buff []byte) ([]byte, error) {
-	_, buff = fromLittleE16(buff) // throw away length
+	size, buff := fromLittleE16(buff)
+	if int(size) > len(buff) {
+		return nil, fmt.Errorf("stat size %d exceeds remaining %d bytes", size, len(buff))
+	}
+	rest := buff[size:]
+	buff = buff[:size]
 	stat.Type, buff = fromLittleE16(buff)
 	stat.Dev, buff = fromLittleE32(buff)
 	buff, err := stat.Qid.parse(buff)
@@ -89,30 +136,61 @@ func (stat *Stat) parse(buff []byte) ([]byte, error) {
 	stat.Uid, buff = fromString(buff)
 	stat.Gid, buff = fromString(buff)
 	stat.Muid, buff = fromString(buff)
-	return buff, nil
+	stat.NUid, stat.NGid, stat.NMuid = NoUid, NoUid, NoUid
+	if len(buff) > 0 {
+		// 9P2000.u
+		stat.Extension, buff = fromString(buff)
+		stat.NUid, buff = fromLittleE32(buff)
+		stat.NGid, buff = fromLittleE32(buff)
+		stat.NMuid, buff = fromLittleE32(buff)
+	}
+	return rest, nil
 }
 
 func (stat *Stat) ComposeLength() uint16 {
+	return stat.ComposeLengthDialect(Plan9)
+}
+
+// ComposeLengthDialect returns the length of the Stat when composed for
+// the dialect d.
+func (stat *Stat) ComposeLengthDialect(d Dialect) uint16 {
 	// size[2], type[2], dev[4], qid[13], mode[4], atime[4], mtime[4], length[8],
 	// name[s], uid[s], gid[s], muid[s]
-	return uint16(2 + 2 + 4 + 13 + 4 + 4 + 4 + 8 +
+	length := 2 + 2 + 4 + 13 + 4 + 4 + 4 + 8 +
 		(2 + len(stat.Name)) +
 		(2 + len(stat.Uid)) +
 		(2 + len(stat.Gid)) +
-		(2 + len(stat.Muid)))
+		(2 + len(stat.Muid))
+	if d == DotU {
+		// extension[s] n_uid[4] n_gid[4] n_muid[4]
+		length += (2 + len(stat.Extension)) + 4 + 4 + 4
+	}
+	return uint16(length)
 }
 
 func (stat *Stat) Compose() []byte {
-	length := stat.ComposeLength()
-	buff := make([]byte, length)
-	buffer := buff
+	return stat.ComposeDialect(Plan9)
+}
+
+// ComposeDialect marshals the Stat for the dialect d.
+func (stat *Stat) ComposeDialect(d Dialect) []byte {
+	return stat.AppendComposeDialect(make([]byte, 0, stat.ComposeLengthDialect(d)), d)
+}
+
+// AppendComposeDialect appends the Stat, marshaled for the dialect d,
+// to dst.
+func (stat *Stat) AppendComposeDialect(dst []byte, d Dialect) []byte {
+	buff, buffer := grow(dst, int(stat.ComposeLengthDialect(d)))
+	toStat(stat, d, buffer)
+	return buff
+}
 
+func toStat(stat *Stat, d Dialect, buffer []byte) []byte {
+	length := stat.ComposeLengthDialect(d)
 	buffer = toLittleE16(length-2, buffer)
 	buffer = toLittleE16(stat.Type, buffer)
 	buffer = toLittleE32(stat.Dev, buffer)
-	qidbuff := stat.Qid.Compose()
-	copy(buffer, qidbuff)
-	buffer = buffer[len(qidbuff):]
+	buffer = toQid(&stat.Qid, buffer)
 	buffer = toLittleE32(stat.Mode, buffer)
 	buffer = toLittleE32(stat.Atime, buffer)
 	buffer = toLittleE32(stat.Mtime, buffer)
@@ -121,7 +199,13 @@ func (stat *Stat) Compose() []byte {
 	buffer = toString(stat.Uid, buffer)
 	buffer = toString(stat.Gid, buffer)
 	buffer = toString(stat.Muid, buffer)
-	return buff
+	if d == DotU {
+		buffer = toString(stat.Extension, buffer)
+		buffer = toLittleE32(stat.NUid, buffer)
+		buffer = toLittleE32(stat.NGid, buffer)
+		buffer = toLittleE32(stat.NMuid, buffer)
+	}
+	return buffer
 }
 
 type RStat struct {
@@ -144,18 +228,25 @@ func (stat *RStat) parse(buff []byte) ([]byte, error) {
 }
 
 func (stat *RStat) Compose() []byte {
+	return stat.AppendCompose(nil)
+}
+
+func (stat *RStat) AppendCompose(dst []byte) []byte {
+	return stat.appendComposeDialect(dst, Plan9)
+}
+
+func (stat *RStat) appendComposeDialect(dst []byte, d Dialect) []byte {
 	// size[4] Rstat tag[2] stat[n]
-	statLength := stat.Stat.ComposeLength()
+	statLength := stat.Stat.ComposeLengthDialect(d)
 	length := 4 + 1 + 2 + 2 + statLength
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, int(length))
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = stat.Header.Type
 	buffer = buffer[1:]
 	buffer = toLittleE16(stat.Tag, buffer)
 	buffer = toLittleE16(statLength, buffer)
-	copy(buffer, stat.Stat.Compose())
+	buffer = toStat(&stat.Stat, d, buffer)
 
 	return buff
 }
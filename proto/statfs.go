@@ -0,0 +1,92 @@
+package proto
+
+import "fmt"
+
+type TStatfs struct {
+	Header
+	Fid uint32
+}
+
+func (statfs *TStatfs) String() string {
+	return fmt.Sprintf("tstatfs: [%s, fid: %d]", &statfs.Header, statfs.Fid)
+}
+
+func (statfs *TStatfs) parse(buff []byte) ([]byte, error) {
+	statfs.Fid, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (statfs *TStatfs) Compose() []byte {
+	return statfs.AppendCompose(nil)
+}
+
+func (statfs *TStatfs) AppendCompose(dst []byte) []byte {
+	// size[4] Tstatfs tag[2] fid[4]
+	length := 4 + 1 + 2 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = statfs.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(statfs.Tag, buffer)
+	buffer = toLittleE32(statfs.Fid, buffer)
+	return buff
+}
+
+type RStatfs struct {
+	Header
+	FSType  uint32
+	Bsize   uint32
+	Blocks  uint64
+	Bfree   uint64
+	Bavail  uint64
+	Files   uint64
+	Ffree   uint64
+	Fsid    uint64
+	Namelen uint32
+}
+
+func (statfs *RStatfs) String() string {
+	return fmt.Sprintf("rstatfs: [%s, type: 0x%X, bsize: %d, blocks: %d, bfree: %d, bavail: %d, files: %d, ffree: %d, fsid: %d, namelen: %d]",
+		&statfs.Header, statfs.FSType, statfs.Bsize, statfs.Blocks, statfs.Bfree,
+		statfs.Bavail, statfs.Files, statfs.Ffree, statfs.Fsid, statfs.Namelen)
+}
+
+func (statfs *RStatfs) parse(buff []byte) ([]byte, error) {
+	statfs.FSType, buff = fromLittleE32(buff)
+	statfs.Bsize, buff = fromLittleE32(buff)
+	statfs.Blocks, buff = fromLittleE64(buff)
+	statfs.Bfree, buff = fromLittleE64(buff)
+	statfs.Bavail, buff = fromLittleE64(buff)
+	statfs.Files, buff = fromLittleE64(buff)
+	statfs.Ffree, buff = fromLittleE64(buff)
+	statfs.Fsid, buff = fromLittleE64(buff)
+	statfs.Namelen, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (statfs *RStatfs) Compose() []byte {
+	return statfs.AppendCompose(nil)
+}
+
+func (statfs *RStatfs) AppendCompose(dst []byte) []byte {
+	// size[4] Rstatfs tag[2] type[4] bsize[4] blocks[8] bfree[8] bavail[8]
+	// files[8] ffree[8] fsid[8] namelen[4]
+	length := 4 + 1 + 2 + 4 + 4 + 8 + 8 + 8 + 8 + 8 + 8 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = statfs.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(statfs.Tag, buffer)
+	buffer = toLittleE32(statfs.FSType, buffer)
+	buffer = toLittleE32(statfs.Bsize, buffer)
+	buffer = toLittleE64(statfs.Blocks, buffer)
+	buffer = toLittleE64(statfs.Bfree, buffer)
+	buffer = toLittleE64(statfs.Bavail, buffer)
+	buffer = toLittleE64(statfs.Files, buffer)
+	buffer = toLittleE64(statfs.Ffree, buffer)
+	buffer = toLittleE64(statfs.Fsid, buffer)
+	buffer = toLittleE32(statfs.Namelen, buffer)
+	return buff
+}
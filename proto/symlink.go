@@ -0,0 +1,74 @@
+package proto
+
+import "fmt"
+
+type TSymlink struct {
+	Header
+	Fid    uint32
+	Name   string
+	Symtgt string
+	Gid    uint32
+}
+
+func (symlink *TSymlink) String() string {
+	return fmt.Sprintf("tsymlink: [%s, fid: %d, name: %s, symtgt: %s, gid: %d]",
+		&symlink.Header, symlink.Fid, symlink.Name, symlink.Symtgt, symlink.Gid)
+}
+
+func (symlink *TSymlink) parse(buff []byte) ([]byte, error) {
+	symlink.Fid, buff = fromLittleE32(buff)
+	symlink.Name, buff = fromString(buff)
+	symlink.Symtgt, buff = fromString(buff)
+	symlink.Gid, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (symlink *TSymlink) Compose() []byte {
+	return symlink.AppendCompose(nil)
+}
+
+func (symlink *TSymlink) AppendCompose(dst []byte) []byte {
+	// size[4] Tsymlink tag[2] fid[4] name[s] symtgt[s] gid[4]
+	length := 4 + 1 + 2 + 4 + (2 + len(symlink.Name)) + (2 + len(symlink.Symtgt)) + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = symlink.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(symlink.Tag, buffer)
+	buffer = toLittleE32(symlink.Fid, buffer)
+	buffer = toString(symlink.Name, buffer)
+	buffer = toString(symlink.Symtgt, buffer)
+	buffer = toLittleE32(symlink.Gid, buffer)
+	return buff
+}
+
+type RSymlink struct {
+	Header
+	Qid Qid
+}
+
+func (symlink *RSymlink) String() string {
+	return fmt.Sprintf("rsymlink: [%s, qid: [%s]]", &symlink.Header, &symlink.Qid)
+}
+
+func (symlink *RSymlink) parse(buff []byte) ([]byte, error) {
+	return symlink.Qid.parse(buff)
+}
+
+func (symlink *RSymlink) Compose() []byte {
+	return symlink.AppendCompose(nil)
+}
+
+func (symlink *RSymlink) AppendCompose(dst []byte) []byte {
+	// size[4] Rsymlink tag[2] qid[13]
+	length := 4 + 1 + 2 + 13
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = symlink.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(symlink.Tag, buffer)
+	buffer = toQid(&symlink.Qid, buffer)
+	return buff
+}
@@ -0,0 +1,72 @@
+package proto
+
+import "fmt"
+
+// AtRemovedir is the TUnlinkat flag requesting removal of a directory.
+const AtRemovedir = 0x200
+
+type TUnlinkat struct {
+	Header
+	Dirfid uint32
+	Name   string
+	Flags  uint32
+}
+
+func (unlinkat *TUnlinkat) String() string {
+	return fmt.Sprintf("tunlinkat: [%s, dirfid: %d, name: %s, flags: 0x%X]",
+		&unlinkat.Header, unlinkat.Dirfid, unlinkat.Name, unlinkat.Flags)
+}
+
+func (unlinkat *TUnlinkat) parse(buff []byte) ([]byte, error) {
+	unlinkat.Dirfid, buff = fromLittleE32(buff)
+	unlinkat.Name, buff = fromString(buff)
+	unlinkat.Flags, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (unlinkat *TUnlinkat) Compose() []byte {
+	return unlinkat.AppendCompose(nil)
+}
+
+func (unlinkat *TUnlinkat) AppendCompose(dst []byte) []byte {
+	// size[4] Tunlinkat tag[2] dirfid[4] name[s] flags[4]
+	length := 4 + 1 + 2 + 4 + (2 + len(unlinkat.Name)) + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = unlinkat.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(unlinkat.Tag, buffer)
+	buffer = toLittleE32(unlinkat.Dirfid, buffer)
+	buffer = toString(unlinkat.Name, buffer)
+	buffer = toLittleE32(unlinkat.Flags, buffer)
+	return buff
+}
+
+type RUnlinkat struct {
+	Header
+}
+
+func (unlinkat *RUnlinkat) String() string {
+	return fmt.Sprintf("runlinkat: [%s]", &unlinkat.Header)
+}
+
+func (unlinkat *RUnlinkat) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (unlinkat *RUnlinkat) Compose() []byte {
+	return unlinkat.AppendCompose(nil)
+}
+
+func (unlinkat *RUnlinkat) AppendCompose(dst []byte) []byte {
+	// size[4] Runlinkat tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = unlinkat.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(unlinkat.Tag, buffer)
+	return buff
+}
@@ -2,6 +2,8 @@ package proto
 
 import (
 	"fmt"
+	"io"
+	"strings"
 )
 
 type TRVersion struct {
@@ -28,10 +30,13 @@ func (version *TRVersion) parse(buff []byte) ([]byte, error) {
 }
 
 func (version *TRVersion) Compose() []byte {
+	return version.AppendCompose(nil)
+}
+
+func (version *TRVersion) AppendCompose(dst []byte) []byte {
 	// size[4] Tversion tag[2] msize[4] version[s]
 	length := 4 + 1 + 2 + 4 + (2 + len(version.Version))
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = version.Type
@@ -42,3 +47,96 @@ func (version *TRVersion) Compose() []byte {
 
 	return buff
 }
+
+// Version strings for the dialects of the protocol understood by this package.
+const (
+	Version9P2000  = "9P2000"
+	Version9P2000L = "9P2000.L"
+	Version9P2000U = "9P2000.u"
+)
+
+// A Dialect identifies the variant of the protocol spoken on a connection.
+// Most messages are encoded identically in every dialect, but some carry
+// additional fields depending on the dialect that was negotiated with
+// Tversion. See ComposeDialect.
+type Dialect uint8
+
+const (
+	Plan9 Dialect = iota // 9P2000
+	DotL                 // 9P2000.L
+	DotU                 // 9P2000.u
+)
+
+// DialectOf returns the Dialect for a version string. Following the
+// protocol, anything after the first period in a version string that
+// does not name a known dialect is ignored, so "9P2000.foo" is
+// understood as 9P2000. ok is false if the version is not understood at all.
+func DialectOf(version string) (d Dialect, ok bool) {
+	switch version {
+	case Version9P2000:
+		return Plan9, true
+	case Version9P2000L:
+		return DotL, true
+	case Version9P2000U:
+		return DotU, true
+	}
+	if i := strings.IndexByte(version, '.'); i >= 0 && version[:i] == Version9P2000 {
+		return Plan9, true
+	}
+	return Plan9, false
+}
+
+// Version returns the version string sent in Tversion for the Dialect d.
+func (d Dialect) Version() string {
+	switch d {
+	case DotL:
+		return Version9P2000L
+	case DotU:
+		return Version9P2000U
+	default:
+		return Version9P2000
+	}
+}
+
+func (d Dialect) String() string {
+	return d.Version()
+}
+
+// extendedCall is implemented by messages whose encoding depends on the
+// dialect in use.
+type extendedCall interface {
+	appendComposeDialect(dst []byte, d Dialect) []byte
+}
+
+// ComposeDialect marshals fc according to the dialect d. For the Plan9
+// dialect, and for messages which are the same in every dialect, this is
+// the same as fc.Compose().
+//
+// Messages may always be parsed with ParseCall regardless of dialect, since
+// the additional fields are detected from the length of the message.
+func ComposeDialect(fc FCall, d Dialect) []byte {
+	return AppendComposeDialect(nil, fc, d)
+}
+
+// WriteCall writes fc to w, marshaled according to the dialect d. Unlike
+// writing the result of ComposeDialect, it reuses buffers, and writes
+// the payloads of large Twrite and Rread messages without copying them.
+func WriteCall(w io.Writer, fc FCall, d Dialect) error {
+	if wt, ok := fc.(io.WriterTo); ok {
+		_, err := wt.WriteTo(w)
+		return err
+	}
+	buff := AppendComposeDialect(nil, fc, d)
+	_, err := w.Write(buff)
+	PutBuffer(buff)
+	return err
+}
+
+// AppendComposeDialect is like ComposeDialect, but appends the message
+// to dst, like FCall's AppendCompose.
+func AppendComposeDialect(dst []byte, fc FCall, d Dialect) []byte {
+	if ec, ok := fc.(extendedCall); ok && d != Plan9 {
+		return ec.appendComposeDialect(dst, d)
+	}
+	return fc.AppendCompose(dst)
+}
@@ -33,13 +33,16 @@ func (walk *TWalk) parse(buff []byte) ([]byte, error) {
 }
 
 func (walk *TWalk) Compose() []byte {
+	return walk.AppendCompose(nil)
+}
+
+func (walk *TWalk) AppendCompose(dst []byte) []byte {
 	// size[4] Twalk  tag[2] fid[4] newfid[4] nwname[2] nwname*(wname[s])
 	length := 4 + 1 + 2 + 4 + 4 + 2
 	for _, name := range walk.Wname {
 		length += 2 + len(name)
 	}
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = walk.Type
@@ -86,10 +89,13 @@ func (walk *RWalk) parse(buff []byte) ([]byte, error) {
 }
 
 func (walk *RWalk) Compose() []byte {
+	return walk.AppendCompose(nil)
+}
+
+func (walk *RWalk) AppendCompose(dst []byte) []byte {
 	// size[4] Rwalk tag[2] nwqid[2] nwqid*(wqid[13])
 	length := 4 + 1 + 2 + 2 + (walk.Nwqid * 13)
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, int(length))
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = walk.Type
@@ -97,9 +103,7 @@ func (walk *RWalk) Compose() []byte {
 	buffer = toLittleE16(walk.Tag, buffer)
 	buffer = toLittleE16(walk.Nwqid, buffer)
 	for _, qid := range walk.Wqid {
-		qidbuff := qid.Compose()
-		copy(buffer, qidbuff)
-		buffer = buffer[len(qidbuff):]
+		buffer = toQid(&qid, buffer)
 	}
 
 	return buff
@@ -1,6 +1,9 @@
 package proto
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 type TWrite struct {
 	Header
@@ -25,10 +28,13 @@ func (write *TWrite) parse(buff []byte) ([]byte, error) {
 }
 
 func (write *TWrite) Compose() []byte {
+	return write.AppendCompose(nil)
+}
+
+func (write *TWrite) AppendCompose(dst []byte) []byte {
 	// size[4] Twrite tag[2] fid[4] offset[8] count[4] data[count]
 	length := 4 + 1 + 2 + 4 + 8 + 4 + write.Count
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, int(length))
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = write.Type
@@ -41,6 +47,26 @@ func (write *TWrite) Compose() []byte {
 	return buff
 }
 
+// WriteTo writes the marshaled message to w. Large payloads are written
+// directly from write.Data rather than copied.
+func (write *TWrite) WriteTo(w io.Writer) (int64, error) {
+	if write.Count < vectorMin || uint32(len(write.Data)) < write.Count {
+		return writeComposed(w, write)
+	}
+	// size[4] Twrite tag[2] fid[4] offset[8] count[4]
+	length := 4 + 1 + 2 + 4 + 8 + 4
+	head, buffer := grow(nil, length)
+
+	buffer = toLittleE32(uint32(length)+write.Count, buffer)
+	buffer[0] = write.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(write.Tag, buffer)
+	buffer = toLittleE32(write.Fid, buffer)
+	buffer = toLittleE64(write.Offset, buffer)
+	buffer = toLittleE32(write.Count, buffer)
+	return writeVectored(w, head, write.Data[:write.Count])
+}
+
 type RWrite struct {
 	Header
 	Count uint32
@@ -56,10 +82,13 @@ func (write *RWrite) parse(buff []byte) ([]byte, error) {
 }
 
 func (write *RWrite) Compose() []byte {
+	return write.AppendCompose(nil)
+}
+
+func (write *RWrite) AppendCompose(dst []byte) []byte {
 	// size[4] Rwrite tag[2] count[4]
 	length := 4 + 1 + 2 + 4
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = write.Type
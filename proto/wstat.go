@@ -24,11 +24,18 @@ func (wstat *TWstat) parse(buff []byte) ([]byte, error) {
 }
 
 func (wstat *TWstat) Compose() []byte {
+	return wstat.AppendCompose(nil)
+}
+
+func (wstat *TWstat) AppendCompose(dst []byte) []byte {
+	return wstat.appendComposeDialect(dst, Plan9)
+}
+
+func (wstat *TWstat) appendComposeDialect(dst []byte, d Dialect) []byte {
 	// size[4] Twstat tag[2] fid[4] stat[n]
-	statLength := wstat.Stat.ComposeLength()
+	statLength := wstat.Stat.ComposeLengthDialect(d)
 	length := 4 + 1 + 2 + 4 + 2 + statLength
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, int(length))
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = wstat.Type
@@ -36,7 +43,7 @@ func (wstat *TWstat) Compose() []byte {
 	buffer = toLittleE16(wstat.Tag, buffer)
 	buffer = toLittleE32(wstat.Fid, buffer)
 	buffer = toLittleE16(statLength, buffer)
-	copy(buffer, wstat.Stat.Compose())
+	buffer = toStat(&wstat.Stat, d, buffer)
 
 	return buff
 }
@@ -54,10 +61,13 @@ func (wstat *RWstat) parse(buff []byte) ([]byte, error) {
 }
 
 func (wstat *RWstat) Compose() []byte {
+	return wstat.AppendCompose(nil)
+}
+
+func (wstat *RWstat) AppendCompose(dst []byte) []byte {
 	// size[4] Rwstat tag[2]
 	length := 4 + 1 + 2
-	buff := make([]byte, length)
-	buffer := buff
+	buff, buffer := grow(dst, length)
 
 	buffer = toLittleE32(uint32(length), buffer)
 	buffer[0] = wstat.Type
@@ -0,0 +1,141 @@
+package proto
+
+import "fmt"
+
+type TXattrwalk struct {
+	Header
+	Fid    uint32
+	Newfid uint32
+	Name   string
+}
+
+func (xattrwalk *TXattrwalk) String() string {
+	return fmt.Sprintf("txattrwalk: [%s, fid: %d, newfid: %d, name: %s]",
+		&xattrwalk.Header, xattrwalk.Fid, xattrwalk.Newfid, xattrwalk.Name)
+}
+
+func (xattrwalk *TXattrwalk) parse(buff []byte) ([]byte, error) {
+	xattrwalk.Fid, buff = fromLittleE32(buff)
+	xattrwalk.Newfid, buff = fromLittleE32(buff)
+	xattrwalk.Name, buff = fromString(buff)
+	return buff, nil
+}
+
+func (xattrwalk *TXattrwalk) Compose() []byte {
+	return xattrwalk.AppendCompose(nil)
+}
+
+func (xattrwalk *TXattrwalk) AppendCompose(dst []byte) []byte {
+	// size[4] Txattrwalk tag[2] fid[4] newfid[4] name[s]
+	length := 4 + 1 + 2 + 4 + 4 + (2 + len(xattrwalk.Name))
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = xattrwalk.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(xattrwalk.Tag, buffer)
+	buffer = toLittleE32(xattrwalk.Fid, buffer)
+	buffer = toLittleE32(xattrwalk.Newfid, buffer)
+	buffer = toString(xattrwalk.Name, buffer)
+	return buff
+}
+
+type RXattrwalk struct {
+	Header
+	Size uint64
+}
+
+func (xattrwalk *RXattrwalk) String() string {
+	return fmt.Sprintf("rxattrwalk: [%s, size: %d]", &xattrwalk.Header, xattrwalk.Size)
+}
+
+func (xattrwalk *RXattrwalk) parse(buff []byte) ([]byte, error) {
+	xattrwalk.Size, buff = fromLittleE64(buff)
+	return buff, nil
+}
+
+func (xattrwalk *RXattrwalk) Compose() []byte {
+	return xattrwalk.AppendCompose(nil)
+}
+
+func (xattrwalk *RXattrwalk) AppendCompose(dst []byte) []byte {
+	// size[4] Rxattrwalk tag[2] size[8]
+	length := 4 + 1 + 2 + 8
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = xattrwalk.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(xattrwalk.Tag, buffer)
+	buffer = toLittleE64(xattrwalk.Size, buffer)
+	return buff
+}
+
+type TXattrcreate struct {
+	Header
+	Fid      uint32
+	Name     string
+	AttrSize uint64
+	Flags    uint32
+}
+
+func (xattrcreate *TXattrcreate) String() string {
+	return fmt.Sprintf("txattrcreate: [%s, fid: %d, name: %s, attr_size: %d, flags: %d]",
+		&xattrcreate.Header, xattrcreate.Fid, xattrcreate.Name, xattrcreate.AttrSize, xattrcreate.Flags)
+}
+
+func (xattrcreate *TXattrcreate) parse(buff []byte) ([]byte, error) {
+	xattrcreate.Fid, buff = fromLittleE32(buff)
+	xattrcreate.Name, buff = fromString(buff)
+	xattrcreate.AttrSize, buff = fromLittleE64(buff)
+	xattrcreate.Flags, buff = fromLittleE32(buff)
+	return buff, nil
+}
+
+func (xattrcreate *TXattrcreate) Compose() []byte {
+	return xattrcreate.AppendCompose(nil)
+}
+
+func (xattrcreate *TXattrcreate) AppendCompose(dst []byte) []byte {
+	// size[4] Txattrcreate tag[2] fid[4] name[s] attr_size[8] flags[4]
+	length := 4 + 1 + 2 + 4 + (2 + len(xattrcreate.Name)) + 8 + 4
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = xattrcreate.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(xattrcreate.Tag, buffer)
+	buffer = toLittleE32(xattrcreate.Fid, buffer)
+	buffer = toString(xattrcreate.Name, buffer)
+	buffer = toLittleE64(xattrcreate.AttrSize, buffer)
+	buffer = toLittleE32(xattrcreate.Flags, buffer)
+	return buff
+}
+
+type RXattrcreate struct {
+	Header
+}
+
+func (xattrcreate *RXattrcreate) String() string {
+	return fmt.Sprintf("rxattrcreate: [%s]", &xattrcreate.Header)
+}
+
+func (xattrcreate *RXattrcreate) parse(buff []byte) ([]byte, error) {
+	return buff, nil
+}
+
+func (xattrcreate *RXattrcreate) Compose() []byte {
+	return xattrcreate.AppendCompose(nil)
+}
+
+func (xattrcreate *RXattrcreate) AppendCompose(dst []byte) []byte {
+	// size[4] Rxattrcreate tag[2]
+	length := 4 + 1 + 2
+	buff, buffer := grow(dst, length)
+
+	buffer = toLittleE32(uint32(length), buffer)
+	buffer[0] = xattrcreate.Type
+	buffer = buffer[1:]
+	buffer = toLittleE16(xattrcreate.Tag, buffer)
+	return buff
+}
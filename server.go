@@ -1,5 +1,6 @@
 // Package go9p contains contains an interface definition for a 9p2000 server, `Srv`.
 // along with a few functions that will serve the 9p2000 protocol using a `Srv`.
+// Servers that also implement `LSrv` may be spoken to in the 9P2000.L dialect.
 //
 // Most people wanting to implement a 9p filesystem should start in the subpackage
 // github.com/knusbaum/go9p/fs, which contains tools for constructing a file system
@@ -15,25 +16,24 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/knusbaum/go9p/proto"
 )
 
-// If Verbose is true, incoming and outgoing 9p messages will be printed to stderr.
+// If Verbose is true, incoming and outgoing 9p messages will be printed to stderr
+// by servers and clients without a Tracer.
+//
+// Deprecated: Use a Tracer, such as LogTracer, instead.
 var Verbose bool
 
-func verboseLog(msg string, args ...interface{}) {
-	if Verbose {
-		log.Printf(msg, args...)
-	}
-}
-
 // The Srv interface is used to handle 9p2000 messages.
 // Each function handles a specific type of message, and
 // should return a response. If some expected error occurs,
@@ -41,8 +41,9 @@ func verboseLog(msg string, args ...interface{}) {
 // permissions, a proto.TError message should be returned
 // rather than a go error. Returning a go error indicates that
 // something has gone wrong with the server, and when used with
-// Serve and PostSrv, will cause the connection to be terminated
-// or the file descriptor to be closed.
+// Serve, ServeReadWriter and PostSrv, will cause the connection to
+// be terminated or the file descriptor to be closed. Requests still
+// in progress on the connection are not answered.
 type Srv interface {
 	NewConn() Conn
 	Version(Conn, *proto.TRVersion) (proto.FCall, error)
@@ -59,130 +60,417 @@ type Srv interface {
 	Wstat(Conn, *proto.TWstat) (proto.FCall, error)
 }
 
+// The LSrv interface is implemented by servers that, in addition to
+// 9p2000, handle the messages of the 9P2000.L dialect. A server that
+// implements LSrv may negotiate 9P2000.L in Version. Errors may still be
+// returned as proto.RError, and will be converted to proto.RLerror before
+// being sent to a 9P2000.L client.
+//
+// If a 9P2000.L message is received by a server that does not implement
+// LSrv, an RLerror with ENOSYS is returned.
+type LSrv interface {
+	Srv
+	Statfs(Conn, *proto.TStatfs) (proto.FCall, error)
+	Lopen(Conn, *proto.TLopen) (proto.FCall, error)
+	Lcreate(Conn, *proto.TLcreate) (proto.FCall, error)
+	Symlink(Conn, *proto.TSymlink) (proto.FCall, error)
+	Mknod(Conn, *proto.TMknod) (proto.FCall, error)
+	Rename(Conn, *proto.TRename) (proto.FCall, error)
+	Readlink(Conn, *proto.TReadlink) (proto.FCall, error)
+	Getattr(Conn, *proto.TGetattr) (proto.FCall, error)
+	Setattr(Conn, *proto.TSetattr) (proto.FCall, error)
+	Xattrwalk(Conn, *proto.TXattrwalk) (proto.FCall, error)
+	Xattrcreate(Conn, *proto.TXattrcreate) (proto.FCall, error)
+	Readdir(Conn, *proto.TReaddir) (proto.FCall, error)
+	Fsync(Conn, *proto.TFsync) (proto.FCall, error)
+	Lock(Conn, *proto.TLock) (proto.FCall, error)
+	Getlock(Conn, *proto.TGetlock) (proto.FCall, error)
+	Link(Conn, *proto.TLink) (proto.FCall, error)
+	Mkdir(Conn, *proto.TMkdir) (proto.FCall, error)
+	Renameat(Conn, *proto.TRenameat) (proto.FCall, error)
+	Unlinkat(Conn, *proto.TUnlinkat) (proto.FCall, error)
+}
+
 // Conn represents an individual connection to a 9p server.
 // In the case of a server listening on a network, there
 // may be many clients connected to a given server at once.
+//
+// TagContext returns the context for the request with the given tag,
+// creating it if necessary, and DropContext cancels and forgets it. The
+// server loop creates the context when a request arrives, and drops it
+// when the request is answered or flushed by a Tflush. Srv handlers may
+// call TagContext with the tag of the request they are handling to
+// learn when the request has been flushed, and abandon it.
+//
+// If a Conn also implements io.Closer, Close is called once the
+// connection has ended and every outstanding request on it has
+// been handled. It should release any state still associated with
+// the connection, such as fids the client never clunked.
 type Conn interface {
 	TagContext(uint16) context.Context
 	DropContext(uint16)
 }
 
-func handleConnection(nc net.Conn, srv Srv) {
-	defer nc.Close()
-	read := bufio.NewReader(nc)
-	err := handleIOAsync(read, nc, "", srv)
-	if err != nil {
-		log.Printf("%v\n", err)
+// closeConn releases conn after its connection has ended.
+func closeConn(conn Conn, t *tracer) {
+	if c, ok := conn.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			t.event(EventError, nil, fmt.Errorf("closing connection: %v", err))
+		}
 	}
 }
 
+// dialect tracks the protocol dialect and msize negotiated on a
+// connection, so that requests can be parsed and responses composed
+// appropriately.
+type dialect struct {
+	d uint32
+	m uint32
+}
+
+func (d *dialect) get() proto.Dialect {
+	return proto.Dialect(atomic.LoadUint32(&d.d))
+}
+
+// msize returns the largest message that may be received.
+func (d *dialect) msize() uint32 {
+	if m := atomic.LoadUint32(&d.m); m != 0 {
+		return m
+	}
+	return proto.MaxMsgLen
+}
+
+// update records the dialect and msize agreed upon by an Rversion
+// response.
+func (d *dialect) update(resp proto.FCall) {
+	if rv, ok := resp.(*proto.TRVersion); ok {
+		nd, _ := proto.DialectOf(rv.Version)
+		atomic.StoreUint32(&d.d, uint32(nd))
+		m := rv.Msize
+		if m > proto.MaxMsize {
+			m = proto.MaxMsize
+		}
+		atomic.StoreUint32(&d.m, m)
+	}
+}
+
+// write converts resp to the form expected by the negotiated dialect
+// and writes it to w.
+func (d *dialect) write(w io.Writer, resp proto.FCall) error {
+	dl := d.get()
+	if re, ok := resp.(*proto.RError); ok && dl != proto.Plan9 {
+		errno := re.Errno
+		if errno == 0 {
+			errno = proto.ErrnoFor(re.Ename)
+		}
+		if dl == proto.DotL {
+			resp = &proto.RLerror{proto.Header{proto.Rlerror, re.Tag}, errno}
+		} else {
+			resp = &proto.RError{re.Header, re.Ename, errno}
+		}
+	}
+	return proto.WriteCall(w, resp, dl)
+}
+
 // handleIO seems to be about 10x faster than handleIOAsync
 // in my experiments. It would be nice to be able to keep some
 // performance without making the reading, handling, and
 // writing of calls synchronous.
 func handleIO(r io.Reader, w io.Writer, srv Srv) error {
+	t := newTracer(nil)
 	conn := srv.NewConn()
+	defer closeConn(conn, t)
+	var d dialect
 	for {
-		call, err := proto.ParseCall(r)
+		call, err := proto.ParseCallSize(r, d.msize())
 		if err != nil {
 			return err
 		}
-		verboseLog("=in=> %s\n", call)
+		start := time.Now()
+		t.event(EventReceive, call, nil)
+		conn.TagContext(call.GetTag())
 		resp, err := handleCall(call, srv, conn)
+		conn.DropContext(call.GetTag())
 		if err != nil {
 			return err
 		}
 
-		if resp == nil {
-			// This case happens when an active tag is
-			// flushed.
-			continue
-		}
-		verboseLog("<=out= %s\n", resp)
-		_, err = w.Write(resp.Compose())
+		d.update(resp)
+		err = d.write(w, resp)
 		if err != nil {
 			return err
 		}
+		t.response(call, resp, start)
 	}
 	return nil
 }
 
-func handleIOAsync(r io.Reader, w io.Writer, uname string, srv Srv) error {
-	incoming := make(chan proto.FCall, 100)
-	outgoing := make(chan proto.FCall, 100)
+// flight tracks the requests in progress on a connection, so that a
+// Tflush can cancel a request and suppress its reply.
+type flight struct {
+	sync.Mutex
+	conn     Conn
+	requests map[uint16]*request
+}
+
+type request struct {
+	call    proto.FCall
+	start   time.Time
+	flushed bool
+	turn    *turn       // if not nil, the request's place in the fid order.
+	resp    proto.FCall // the reply, once it is queued to be sent.
+}
+
+func newFlight(conn Conn) *flight {
+	return &flight{conn: conn, requests: make(map[uint16]*request)}
+}
+
+// start records the arrival of call.
+func (f *flight) start(call proto.FCall) *request {
+	f.Lock()
+	defer f.Unlock()
+	r := &request{call: call, start: time.Now()}
+	f.conn.TagContext(call.GetTag())
+	f.requests[call.GetTag()] = r
+	return r
+}
+
+// finish queues resp, the reply to r, on out unless r has been flushed.
+func (f *flight) finish(r *request, resp proto.FCall, out chan<- *request) {
+	f.Lock()
+	defer f.Unlock()
+	if r.flushed {
+		return
+	}
+	tag := r.call.GetTag()
+	delete(f.requests, tag)
+	f.conn.DropContext(tag)
+	if resp != nil {
+		r.resp = resp
+		out <- r
+	}
+}
+
+// flush cancels the request flushed by t, if it has not been answered,
+// and queues the Rflush on out. The request's reply, if it was not
+// queued before the Rflush, is never sent.
+func (f *flight) flush(t *proto.TFlush, out chan<- *request) {
+	f.Lock()
+	defer f.Unlock()
+	if r, ok := f.requests[t.Oldtag]; ok {
+		r.flushed = true
+		delete(f.requests, t.Oldtag)
+		f.conn.DropContext(t.Oldtag)
+	}
+	out <- &request{call: t, start: time.Now(), resp: &proto.RFlush{proto.Header{proto.Rflush, t.Tag}}}
+}
 
+// abort cancels every request in progress and suppresses their replies.
+// It is used when the connection to the client is lost.
+func (f *flight) abort() {
+	f.Lock()
+	defer f.Unlock()
+	for tag, r := range f.requests {
+		r.flushed = true
+		delete(f.requests, tag)
+		f.conn.DropContext(tag)
+	}
+}
+
+// flushed reports whether r has been flushed.
+func (f *flight) flushed(r *request) bool {
+	f.Lock()
+	defer f.Unlock()
+	return r.flushed
+}
+
+// The defaults for Server's MaxInflight and QueueDepth.
+const (
+	DefaultMaxInflight = 100
+	DefaultQueueDepth  = 100
+)
+
+// connOptions configure how a connection is served.
+type connOptions struct {
+	inflight int           // requests handled at once.
+	queue    int           // requests read, waiting to be handled.
+	global   chan struct{} // if not nil, a slot is held while handling a request.
+	ordering Ordering
+	tracer   Tracer
+}
+
+// handleIOAsync serves a connection, reading requests from r and
+// writing responses to w. If uname is not empty, the client may only
+// attach as uname.
+func handleIOAsync(r io.Reader, w io.Writer, uname string, srv Srv, opts connOptions) (err error) {
+	incoming := make(chan *request, opts.queue)
+	outgoing := make(chan *request, opts.inflight)
+
+	t := newTracer(opts.tracer)
+	t.Trace(&Event{Kind: EventConnect, Conn: t.conn, User: uname})
+	defer func() {
+		if err == io.EOF {
+			t.event(EventDisconnect, nil, nil)
+		} else {
+			t.event(EventDisconnect, nil, err)
+		}
+	}()
 	conn := srv.NewConn()
+	defer closeConn(conn, t)
+	var d dialect
+	inflight := newFlight(conn)
+	var order *fidOrder
+	if opts.ordering.resolve(srv) == FidOrdered {
+		order = newFidOrder()
+	}
 
 	// Write the outgoing
 	var outgoingWG sync.WaitGroup
 	defer func() { outgoingWG.Wait() }()
 	outgoingWG.Add(1)
 	go func() {
-		outgoingWG.Done()
-		for call := range outgoing {
-			verboseLog("<=out= %s\n", call)
-			_, err := w.Write(call.Compose())
+		defer outgoingWG.Done()
+		for req := range outgoing {
+			// The response is traced before it is written, so that it
+			// has been counted by the time the client sees it.
+			t.response(req.call, req.resp, req.start)
+			err := d.write(w, req.resp)
 			if err != nil {
-				log.Printf("Protocol error: %v\n", err)
+				t.event(EventError, req.resp, err)
 			}
 		}
 	}()
 
+	// A go error from srv ends the connection, as documented for Srv.
+	// Closing r and w, if they can be, stops the reading of requests
+	// and tells the client.
+	var failMu sync.Mutex
+	var failErr error
+	fail := func(err error) {
+		failMu.Lock()
+		defer failMu.Unlock()
+		if failErr != nil {
+			return
+		}
+		failErr = err
+		inflight.abort()
+		for _, c := range []interface{}{r, w} {
+			if c, ok := c.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+	failure := func() error {
+		failMu.Lock()
+		defer failMu.Unlock()
+		return failErr
+	}
+
+	// Requests waiting for their turn in the fid order hold a slot of
+	// waiting rather than a place in incoming. Once their turn comes,
+	// they are passed to any free worker on ready, which always has room
+	// for them, as each holds its slot of waiting until it is taken.
+	// Incoming is only closed once every request in the order has been
+	// handled, so the workers stop after the last of them.
+	waiting := make(chan struct{}, opts.queue)
+	ready := make(chan *request, opts.queue)
+	var ordered sync.WaitGroup
+	serve := func(req *request) {
+		if inflight.flushed(req) {
+			return
+		}
+		if opts.global != nil {
+			opts.global <- struct{}{}
+			defer func() { <-opts.global }()
+		}
+		resp, err := handleCall(req.call, srv, conn)
+		if err != nil {
+			t.event(EventError, req.call, err)
+			fail(err)
+			return
+		}
+		d.update(resp)
+		inflight.finish(req, resp, outgoing)
+	}
+
 	var workerWG sync.WaitGroup
 	defer func() { workerWG.Wait(); close(outgoing) }()
-	for i := 0; i < 100; i++ {
+	for i := 0; i < opts.inflight; i++ {
 		workerWG.Add(1)
 		go func() {
 			defer workerWG.Done()
-			for call := range incoming {
-				resp, err := handleCall(call, srv, conn)
-				if err != nil {
-					log.Printf("Protocol error: %v\n", err)
-					//return err
-					return
+			for {
+				var req *request
+				select {
+				case req = <-ready:
+					<-waiting
+				case r, ok := <-incoming:
+					if !ok {
+						return
+					}
+					req = r
 				}
-				if resp == nil {
-					// This case happens when an active tag is
-					// flushed.
+				serve(req)
+				if req.turn == nil {
 					continue
 				}
-				outgoing <- resp
+				for _, next := range order.leave(req.turn) {
+					ready <- next
+				}
+				ordered.Done()
 			}
 		}()
 	}
 
 	// Read incoming
-	defer close(incoming)
+	defer func() { ordered.Wait(); close(incoming) }()
 	for {
-		call, err := proto.ParseCall(r)
-		verboseLog("=in=> %s\n", call)
+		call, err := proto.ParseCallSize(r, d.msize())
+		if ferr := failure(); ferr != nil {
+			return ferr
+		}
 		if err != nil {
-			log.Printf("Protocol error: %v\n", err)
+			// A timeout means the server is shutting down, and the
+			// requests in progress are left to finish. Otherwise the
+			// client is gone, and there is no one to answer.
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				inflight.abort()
+			}
 			return err
 		}
+		t.event(EventReceive, call, nil)
 
 		if ta, ok := call.(*proto.TAttach); ok && uname != "" {
 			// TODO: it would be nice to move this down into Srv so that we
 			// can respond with RError instead of just killing the connection.
 			if ta.Uname != uname {
-				outgoing <- &proto.RError{proto.Header{proto.Rerror, ta.Tag}, fmt.Sprintf("invalid user %s", ta.Uname)}
+				outgoing <- &request{call: call, start: time.Now(), resp: &proto.RError{proto.Header{proto.Rerror, ta.Tag}, fmt.Sprintf("invalid user %s", ta.Uname), proto.EACCES}}
 				return fmt.Errorf("Protocol error: client connected with cert for %s, but attached with user name %s", uname, ta.Uname)
 			}
-			fmt.Printf("UNAME %s -> %s\n", ta.Uname, uname)
-			ta.Uname = uname
 		}
 
-		select {
-		case incoming <- call:
-		default:
-			panic("FAILED TO QUEUE INCOMING!")
+		if flush, ok := call.(*proto.TFlush); ok {
+			inflight.flush(flush, outgoing)
+			continue
 		}
+
+		// If the queue is full, this blocks, and no more requests are
+		// read until a worker is free to take one.
+		req := inflight.start(call)
+		if order != nil {
+			waiting <- struct{}{}
+			ordered.Add(1)
+			if !order.enter(req) {
+				continue
+			}
+			<-waiting
+		}
+		incoming <- req
 	}
 	return nil
 }
 
 func handleCall(call proto.FCall, srv Srv, conn Conn) (proto.FCall, error) {
-	ctx := conn.TagContext(call.GetTag())
 	var (
 		ret proto.FCall
 		err error
@@ -195,8 +483,9 @@ func handleCall(call proto.FCall, srv Srv, conn Conn) (proto.FCall, error) {
 	case *proto.TAttach:
 		ret, err = srv.Attach(conn, call.(*proto.TAttach))
 	case *proto.TFlush:
+		// Requests are answered in order by handleIO, so there is
+		// never anything to flush.
 		flush := call.(*proto.TFlush)
-		//conn.DropContext(flush.Oldtag)
 		ret, err = &proto.RFlush{proto.Header{proto.Rflush, flush.Tag}}, nil
 	case *proto.TWalk:
 		ret, err = srv.Walk(conn, call.(*proto.TWalk))
@@ -217,50 +506,93 @@ func handleCall(call proto.FCall, srv Srv, conn Conn) (proto.FCall, error) {
 	case *proto.TWstat:
 		ret, err = srv.Wstat(conn, call.(*proto.TWstat))
 	default:
-		return nil, fmt.Errorf("Invalid call: %s", reflect.TypeOf(call))
+		lsrv, ok := srv.(LSrv)
+		if !ok {
+			if isDotL(call) {
+				ret = &proto.RLerror{proto.Header{proto.Rlerror, call.GetTag()}, proto.ENOSYS}
+				break
+			}
+			return nil, fmt.Errorf("Invalid call: %s", reflect.TypeOf(call))
+		}
+		ret, err = handleDotL(call, lsrv, conn)
 	}
 
-	if ctx.Err() != nil {
-		return nil, nil
-	}
-	conn.DropContext(call.GetTag())
 	return ret, err
 }
 
+func handleDotL(call proto.FCall, srv LSrv, conn Conn) (proto.FCall, error) {
+	switch call.(type) {
+	case *proto.TStatfs:
+		return srv.Statfs(conn, call.(*proto.TStatfs))
+	case *proto.TLopen:
+		return srv.Lopen(conn, call.(*proto.TLopen))
+	case *proto.TLcreate:
+		return srv.Lcreate(conn, call.(*proto.TLcreate))
+	case *proto.TSymlink:
+		return srv.Symlink(conn, call.(*proto.TSymlink))
+	case *proto.TMknod:
+		return srv.Mknod(conn, call.(*proto.TMknod))
+	case *proto.TRename:
+		return srv.Rename(conn, call.(*proto.TRename))
+	case *proto.TReadlink:
+		return srv.Readlink(conn, call.(*proto.TReadlink))
+	case *proto.TGetattr:
+		return srv.Getattr(conn, call.(*proto.TGetattr))
+	case *proto.TSetattr:
+		return srv.Setattr(conn, call.(*proto.TSetattr))
+	case *proto.TXattrwalk:
+		return srv.Xattrwalk(conn, call.(*proto.TXattrwalk))
+	case *proto.TXattrcreate:
+		return srv.Xattrcreate(conn, call.(*proto.TXattrcreate))
+	case *proto.TReaddir:
+		return srv.Readdir(conn, call.(*proto.TReaddir))
+	case *proto.TFsync:
+		return srv.Fsync(conn, call.(*proto.TFsync))
+	case *proto.TLock:
+		return srv.Lock(conn, call.(*proto.TLock))
+	case *proto.TGetlock:
+		return srv.Getlock(conn, call.(*proto.TGetlock))
+	case *proto.TLink:
+		return srv.Link(conn, call.(*proto.TLink))
+	case *proto.TMkdir:
+		return srv.Mkdir(conn, call.(*proto.TMkdir))
+	case *proto.TRenameat:
+		return srv.Renameat(conn, call.(*proto.TRenameat))
+	case *proto.TUnlinkat:
+		return srv.Unlinkat(conn, call.(*proto.TUnlinkat))
+	}
+	return nil, fmt.Errorf("Invalid call: %s", reflect.TypeOf(call))
+}
+
+// isDotL reports whether call is a 9P2000.L request.
+func isDotL(call proto.FCall) bool {
+	switch call.(type) {
+	case *proto.TStatfs, *proto.TLopen, *proto.TLcreate, *proto.TSymlink,
+		*proto.TMknod, *proto.TRename, *proto.TReadlink, *proto.TGetattr,
+		*proto.TSetattr, *proto.TXattrwalk, *proto.TXattrcreate,
+		*proto.TReaddir, *proto.TFsync, *proto.TLock, *proto.TGetlock,
+		*proto.TLink, *proto.TMkdir, *proto.TRenameat, *proto.TUnlinkat:
+		return true
+	}
+	return false
+}
+
 // ServeReadWriter accepts an io.Reader an io.Writer, and an Srv.
 // It reads 9p2000 messages from r, handles them with srv, and
-// writes the responses to w.
+// writes the responses to w. To count its requests with Metrics,
+// or limit them, use Server's ServeReadWriter.
 func ServeReadWriter(r io.Reader, w io.Writer, srv Srv) error {
-	return handleIOAsync(r, w, "", srv)
+	s := &Server{Srv: srv}
+	return s.ServeReadWriter(r, w)
 }
 
 // Serve serves srv on the given address, addr.
 func Serve(addr string, srv Srv) error {
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
-	}
-	for {
-		a, err := l.Accept()
-		if err != nil {
-			return err
-		}
-		go func(nc net.Conn, srv Srv) {
-			defer nc.Close()
-			read := bufio.NewReader(nc)
-			err := ServeReadWriter(read, nc, srv)
-			if err != nil {
-				log.Printf("%v\n", err)
-			}
-		}(a, srv)
-	}
+	s := &Server{Addr: addr, Srv: srv}
+	return s.ListenAndServe()
 }
 
 func ServeTLS(addr string, srvcert tls.Certificate, ca *x509.Certificate, withauth bool, srv Srv) error {
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
-	}
 	certpool := x509.NewCertPool()
 	certpool.AddCert(ca)
 
@@ -271,45 +603,290 @@ func ServeTLS(addr string, srvcert tls.Certificate, ca *x509.Certificate, withau
 		clientAuth = tls.NoClientCert
 	}
 
-	tlsl := tls.NewListener(l, &tls.Config{
-		Certificates: []tls.Certificate{srvcert},
-		ClientCAs:    certpool,
-		ClientAuth:   clientAuth,
-	})
+	s := &Server{
+		Addr: addr,
+		Srv:  srv,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{srvcert},
+			ClientCAs:    certpool,
+			ClientAuth:   clientAuth,
+		},
+	}
+	return s.ListenAndServe()
+}
+
+// ErrServerClosed is returned by the Server's Serve and ListenAndServe
+// methods after a call to Shutdown or Close.
+var ErrServerClosed = errors.New("go9p: Server closed")
+
+// A Server serves a Srv on a network listener, and keeps track of its
+// connections so that it can be stopped. It is modeled on net/http's
+// Server. The zero value is not usable; at least Srv must be set.
+type Server struct {
+	// Addr is the TCP address to listen on for ListenAndServe.
+	Addr string
+	// Srv handles the 9p messages received on every connection.
+	Srv Srv
+	// If TLSConfig is not nil, connections are wrapped with TLS.
+	// If a client presents a verified certificate, the certificate's
+	// CommonName is the only user name it may attach as.
+	TLSConfig *tls.Config
+
+	// MaxInflight is the number of requests handled at once on each
+	// connection. If zero, DefaultMaxInflight is used.
+	MaxInflight int
+	// QueueDepth is the number of requests read from a connection that
+	// may wait for one of its MaxInflight handlers. Once the queue is
+	// full, the server stops reading from the connection until a
+	// request is handled, so that a client sending requests faster than
+	// they are answered is slowed down. Tflush requests never wait in
+	// the queue. If zero, DefaultQueueDepth is used.
+	QueueDepth int
+	// If MaxServerInflight is positive, it limits the number of
+	// requests handled at once across all connections.
+	MaxServerInflight int
+	// Ordering is the order in which requests on a connection are
+	// handled. See Ordering.
+	Ordering Ordering
+	// Tracer receives the events of every connection. If nil,
+	// DefaultTracer(nil) is used.
+	Tracer Tracer
+	// If Metrics is not nil, it counts the requests of every
+	// connection, as well as any Tracer. This includes connections
+	// served by s's ServeReadWriter and PostSrv.
+	Metrics *Metrics
+
+	mu         sync.Mutex
+	global     chan struct{}
+	listeners  map[net.Listener]struct{}
+	conns      map[net.Conn]struct{}
+	connsDone  chan struct{}
+	inShutdown bool
+}
+
+// ListenAndServe listens on the TCP address s.Addr and then calls Serve.
+func (s *Server) ListenAndServe() error {
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l, serving each of them with s.Srv in
+// a new goroutine. Serve always returns a non-nil error. After Shutdown
+// or Close, the error is ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+
 	for {
-		a, err := tlsl.Accept()
+		nc, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
-		go func(nc net.Conn, srv Srv) {
-			//fmt.Printf("SERVER GOT CONNECTION: %#v\n", nc)
-			var uname string
-			if tc, ok := nc.(*tls.Conn); ok && withauth {
-				err := tc.Handshake()
-				if err != nil {
-					fmt.Printf("TLS Error: %v\n", err)
-					return
-				}
-				fmt.Printf("CLIENT: %#v\n", tc.ConnectionState())
-				fmt.Printf("Client connected as %v\n", tc.ConnectionState().PeerCertificates[0].Subject.CommonName)
-				uname = tc.ConnectionState().PeerCertificates[0].Subject.CommonName
-			}
-			defer nc.Close()
-			read := bufio.NewReader(nc)
-			err := handleIOAsync(read, nc, uname, srv)
-			if err != nil {
-				log.Printf("%v\n", err)
-			}
-		}(a, srv)
+		if !s.trackConn(nc, true) {
+			nc.Close()
+			continue
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// ServeReadWriter serves a single connection with s.Srv, reading 9p2000
+// messages from r and writing the responses to w, with s's limits,
+// Tracer and Metrics. The connection is not tracked by Shutdown or
+// Close.
+func (s *Server) ServeReadWriter(r io.Reader, w io.Writer) error {
+	return handleIOAsync(r, w, "", s.Srv, s.connOptions())
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer s.trackConn(nc, false)
+	defer nc.Close()
+	var uname string
+	if tc, ok := nc.(*tls.Conn); ok {
+		err := tc.Handshake()
+		if err != nil {
+			newTracer(s.tracer()).event(EventError, nil, fmt.Errorf("TLS handshake with %v: %v", nc.RemoteAddr(), err))
+			return
+		}
+		if state := tc.ConnectionState(); len(state.VerifiedChains) > 0 {
+			uname = state.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	read := bufio.NewReader(nc)
+	handleIOAsync(read, nc, uname, s.Srv, s.connOptions())
+}
+
+// connOptions returns the options for a new connection.
+func (s *Server) connOptions() connOptions {
+	opts := connOptions{inflight: s.MaxInflight, queue: s.QueueDepth, ordering: s.Ordering, tracer: s.tracer()}
+	if opts.inflight <= 0 {
+		opts.inflight = DefaultMaxInflight
+	}
+	if opts.queue <= 0 {
+		opts.queue = DefaultQueueDepth
+	}
+	if s.MaxServerInflight > 0 {
+		s.mu.Lock()
+		if s.global == nil {
+			s.global = make(chan struct{}, s.MaxServerInflight)
+		}
+		opts.global = s.global
+		s.mu.Unlock()
+	}
+	return opts
+}
+
+// tracer returns the Tracer receiving the events of s's connections.
+func (s *Server) tracer() Tracer {
+	if s.Metrics == nil {
+		return s.Tracer
+	}
+	return MultiTracer(DefaultTracer(s.Tracer), s.Metrics)
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// trackListener adds or removes l from the set of active listeners.
+// It returns false if l cannot be added because the server is
+// shutting down.
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	if add {
+		if s.inShutdown {
+			return false
+		}
+		s.listeners[l] = struct{}{}
+	} else {
+		delete(s.listeners, l)
+	}
+	return true
+}
+
+// trackConn adds or removes nc from the set of active connections.
+// It returns false if nc cannot be added because the server is
+// shutting down.
+func (s *Server) trackConn(nc net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if add {
+		if s.inShutdown {
+			return false
+		}
+		s.conns[nc] = struct{}{}
+	} else {
+		delete(s.conns, nc)
+		if len(s.conns) == 0 && s.connsDone != nil {
+			// No connections are added once connsDone exists, so
+			// this happens at most once.
+			close(s.connsDone)
+		}
+	}
+	return true
+}
+
+// closeListeners marks the server as shutting down, closes its
+// listeners, and returns a channel that is closed once the last
+// connection has finished.
+func (s *Server) closeListeners() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inShutdown = true
+	for l := range s.listeners {
+		l.Close()
+		delete(s.listeners, l)
+	}
+	if s.connsDone == nil {
+		s.connsDone = make(chan struct{})
+		if len(s.conns) == 0 {
+			close(s.connsDone)
+		}
+	}
+	return s.connsDone
+}
+
+// Shutdown gracefully shuts down the server. It closes the listeners,
+// then stops reading new requests from every connection, waits for the
+// requests already received to be answered, and closes the connections.
+// As each connection ends, its Conn is closed (see Conn), which for
+// servers built with the fs package clunks every remaining fid so that
+// File.Close is called for every open file.
+//
+// If ctx expires before all connections have finished, Shutdown returns
+// the context's error. Close may then be used to force the remaining
+// connections closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := s.closeListeners()
+	s.mu.Lock()
+	for nc := range s.conns {
+		// Unblock the reader. Requests already read are still handled.
+		nc.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// Close immediately closes the listeners and all connections. Requests
+// in progress are abandoned, although each connection's Conn is still
+// closed once its outstanding requests return. For a graceful shutdown,
+// use Shutdown.
+func (s *Server) Close() error {
+	s.closeListeners()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for nc := range s.conns {
+		if cerr := nc.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
 // PostSrv serves srv, from a file descriptor named name.
 // The fd is posted and can subsequently be mounted. On Unix, the
 // descriptor is posted under in the current namespace, which is
 // determined by 9fans.net/go/plan9/client Namespace. On Plan9 it
 // is posted in the usual place, /srv.
 func PostSrv(name string, srv Srv) error {
+	s := &Server{Srv: srv}
+	return s.PostSrv(name)
+}
+
+// PostSrv serves s.Srv, from a file descriptor named name, as the
+// package's PostSrv does, with s's limits, Tracer and Metrics.
+func (s *Server) PostSrv(name string) error {
 	f, handle, err := postfd(name)
 	if err != nil {
 		return err
@@ -318,6 +895,6 @@ func PostSrv(name string, srv Srv) error {
 	if handle != nil {
 		defer handle.Close()
 	}
-	err = ServeReadWriter(f, f, srv)
+	err = s.ServeReadWriter(f, f)
 	return err
 }
@@ -47,7 +47,8 @@ func (p *pipe) Read(b []byte) (n int, err error) {
 }
 
 func (p *pipe) Write(b []byte) (n int, err error) {
-	p.out <- b
+	// Writers may reuse b once Write returns.
+	p.out <- append([]byte(nil), b...)
 	return len(b), nil
 }
 
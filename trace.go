@@ -0,0 +1,167 @@
+package go9p
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/knusbaum/go9p/proto"
+)
+
+// EventKind identifies the kind of an Event.
+type EventKind int
+
+const (
+	EventConnect    EventKind = iota // A connection was established.
+	EventDisconnect                  // A connection ended. Err holds the reason, if any.
+	EventReceive                     // Call was received.
+	EventSend                        // Call was sent.
+	EventAuth                        // User attached, or failed to, if Err is not nil.
+	EventError                       // Something went wrong. Err holds the error.
+)
+
+var eventKindNames = []string{
+	EventConnect:    "connect",
+	EventDisconnect: "disconnect",
+	EventReceive:    "receive",
+	EventSend:       "send",
+	EventAuth:       "auth",
+	EventError:      "error",
+}
+
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "unknown"
+}
+
+// An Event describes something that happened on a connection of a
+// server or client.
+type Event struct {
+	Kind EventKind
+	// Conn identifies the connection. Connection ids are unique within
+	// a process for servers, and separately for clients.
+	Conn uint64
+	// Call is the message sent or received.
+	Call proto.FCall
+	// For a response, Request is the request it answers, and Latency
+	// is the time between the request being received and the response
+	// being sent (on a server) or the request being sent and the
+	// response being received (on a client).
+	Request proto.FCall
+	Latency time.Duration
+	// User is the user attaching, for EventAuth, or the user identified
+	// by a client certificate, for EventConnect.
+	User string
+	Err  error
+}
+
+// A Tracer receives the Events of a server or client. Trace is called
+// from many goroutines at once, and should return quickly, since it
+// holds up the connection.
+type Tracer interface {
+	Trace(e *Event)
+}
+
+// TracerFunc adapts a function to the Tracer interface.
+type TracerFunc func(e *Event)
+
+func (f TracerFunc) Trace(e *Event) {
+	f(e)
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Trace(*Event) {}
+
+// NopTracer discards every Event. It is the default Tracer, unless
+// Verbose is set.
+var NopTracer Tracer = nopTracer{}
+
+type logTracer struct {
+	l *log.Logger
+}
+
+// LogTracer returns a Tracer that prints Events to l in a human
+// readable form. Messages received are printed as "=in=>" and messages
+// sent as "<=out=", as Verbose used to.
+func LogTracer(l *log.Logger) Tracer {
+	return &logTracer{l}
+}
+
+func (t *logTracer) Trace(e *Event) {
+	switch e.Kind {
+	case EventReceive:
+		t.l.Printf("[%d] =in=> %s\n", e.Conn, e.Call)
+	case EventSend:
+		t.l.Printf("[%d] <=out= %s\n", e.Conn, e.Call)
+	case EventAuth:
+		if e.Err != nil {
+			t.l.Printf("[%d] %s failed to attach: %v\n", e.Conn, e.User, e.Err)
+		} else {
+			t.l.Printf("[%d] %s attached\n", e.Conn, e.User)
+		}
+	case EventConnect:
+		if e.User != "" {
+			t.l.Printf("[%d] connected as %s\n", e.Conn, e.User)
+		} else {
+			t.l.Printf("[%d] connected\n", e.Conn)
+		}
+	case EventDisconnect:
+		if e.Err != nil {
+			t.l.Printf("[%d] disconnected: %v\n", e.Conn, e.Err)
+		} else {
+			t.l.Printf("[%d] disconnected\n", e.Conn)
+		}
+	default:
+		t.l.Printf("[%d] %s: %v\n", e.Conn, e.Kind, e.Err)
+	}
+}
+
+// DefaultTracer returns t if it is not nil, and otherwise the default
+// Tracer: NopTracer, or a LogTracer printing to stderr if Verbose is
+// set.
+func DefaultTracer(t Tracer) Tracer {
+	if t != nil {
+		return t
+	}
+	if Verbose {
+		return LogTracer(log.New(os.Stderr, "", log.LstdFlags))
+	}
+	return NopTracer
+}
+
+var lastConnID uint64
+
+// tracer emits the Events of a single connection.
+type tracer struct {
+	Tracer
+	conn uint64
+}
+
+func newTracer(t Tracer) *tracer {
+	return &tracer{DefaultTracer(t), atomic.AddUint64(&lastConnID, 1)}
+}
+
+func (t *tracer) event(kind EventKind, call proto.FCall, err error) {
+	t.Trace(&Event{Kind: kind, Conn: t.conn, Call: call, Err: err})
+}
+
+// response traces resp, sent in reply to req, which was received at
+// start. Replies to attach requests are also traced as EventAuth.
+func (t *tracer) response(req, resp proto.FCall, start time.Time) {
+	t.Trace(&Event{Kind: EventSend, Conn: t.conn, Call: resp, Request: req, Latency: time.Since(start)})
+	if ta, ok := req.(*proto.TAttach); ok {
+		e := &Event{Kind: EventAuth, Conn: t.conn, User: ta.Uname}
+		switch r := resp.(type) {
+		case *proto.RError:
+			e.Err = errors.New(r.Ename)
+		case *proto.RLerror:
+			e.Err = errors.New(proto.ErrnoString(r.Ecode))
+		}
+		t.Trace(e)
+	}
+}
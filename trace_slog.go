@@ -0,0 +1,52 @@
+//go:build go1.21
+// +build go1.21
+
+package go9p
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogTracer struct {
+	l *slog.Logger
+}
+
+// SlogTracer returns a Tracer that writes Events to l as structured
+// records. Messages sent and received are logged at debug level, errors
+// and failed attaches at error and warn level, and everything else at
+// info level.
+func SlogTracer(l *slog.Logger) Tracer {
+	return &slogTracer{l}
+}
+
+func (t *slogTracer) Trace(e *Event) {
+	level := slog.LevelInfo
+	attrs := []slog.Attr{slog.Uint64("conn", e.Conn)}
+	switch e.Kind {
+	case EventReceive, EventSend:
+		level = slog.LevelDebug
+	case EventError:
+		level = slog.LevelError
+	case EventAuth:
+		if e.Err != nil {
+			level = slog.LevelWarn
+		}
+	}
+	if !t.l.Enabled(context.Background(), level) {
+		return
+	}
+	if e.Call != nil {
+		attrs = append(attrs, slog.String("call", e.Call.String()))
+	}
+	if e.Request != nil {
+		attrs = append(attrs, slog.String("request", e.Request.String()), slog.Duration("latency", e.Latency))
+	}
+	if e.User != "" {
+		attrs = append(attrs, slog.String("user", e.User))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("error", e.Err.Error()))
+	}
+	t.l.LogAttrs(context.Background(), level, "9p "+e.Kind.String(), attrs...)
+}
@@ -0,0 +1,134 @@
+package union
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/knusbaum/go9p/client"
+	"github.com/knusbaum/go9p/fs"
+)
+
+func (o MountOption) String() string {
+	switch o {
+	case REPLACE:
+		return "REPLACE"
+	case BEFORE:
+		return "BEFORE"
+	case AFTER:
+		return "AFTER"
+	}
+	return fmt.Sprintf("MountOption(%d)", int(o))
+}
+
+// A NamespaceEntry describes a mount or bind of a union filesystem.
+type NamespaceEntry struct {
+	// Old is the path mounted or bound over.
+	Old string
+	// Source is the path bound for binds, and describes the server of
+	// Client for mounts.
+	Source string
+	// Client is the client mounted, or nil for binds.
+	Client *client.Client
+	Option MountOption
+	Create bool
+}
+
+// String returns e as a line of Plan 9's ns(1), such as
+// "mount -bc tcp!host!564 /n/x" or "bind -a /usr/bin /bin".
+func (e NamespaceEntry) String() string {
+	cmd := "bind"
+	if e.Client != nil {
+		cmd = "mount"
+	}
+	flags := ""
+	switch e.Option {
+	case BEFORE:
+		flags = "b"
+	case AFTER:
+		flags = "a"
+	}
+	if e.Create {
+		flags += "c"
+	}
+	if flags != "" {
+		cmd += " -" + flags
+	}
+	return cmd + " " + quote(e.Source) + " " + quote(e.Old)
+}
+
+// quote quotes s as rc(1) does, if it has to be.
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n#;&|^$=`'{}()<>") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Namespace returns the mounts and binds of the union filesystem fs, in
+// the order they are searched.
+func Namespace(fs *fs.FS) ([]NamespaceEntry, error) {
+	root, ok := fs.Root.(*unionDir)
+	if !ok {
+		return nil, fmt.Errorf("cannot list the namespace of a non-union filesystem")
+	}
+
+	root.RLock()
+	defer root.RUnlock()
+
+	entries := []NamespaceEntry{}
+	for _, me := range root.mountTable {
+		e := NamespaceEntry{
+			Old:    me.mountPoint,
+			Client: me.c,
+			Option: me.option,
+			Create: me.create,
+		}
+		switch {
+		case me.c != nil:
+			e.Source = me.c.String()
+		case me.d != nil:
+			e.Source = me.d.path
+		default:
+			// Files added to the union are not mounts.
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// AddNamespaceFile adds a read-only file at old to the union filesystem
+// ufs, which lists the entries of Namespace in the format of ns(1) when
+// opened. The file is listed whatever is mounted over its directory, and
+// is removed with UnmountPoint.
+func AddNamespaceFile(ufs *fs.FS, old string) error {
+	root, ok := ufs.Root.(*unionDir)
+	if !ok {
+		return fmt.Errorf("cannot add a namespace file to a non-union filesystem")
+	}
+
+	name := filepath.Base(old)
+	if name == "/" || name == "." {
+		return fmt.Errorf("invalid namespace file path: %s", old)
+	}
+	f := fs.NewDynamicFile(ufs.NewStat(name, "none", "none", 0444), func() []byte {
+		entries, _ := Namespace(ufs)
+		var b strings.Builder
+		for _, e := range entries {
+			b.WriteString(e.String())
+			b.WriteByte('\n')
+		}
+		return []byte(b.String())
+	})
+
+	root.Lock()
+	defer root.Unlock()
+
+	root.mountTable = append(root.mountTable, mountEntry{
+		f:          f,
+		mountPoint: old,
+	})
+
+	return nil
+}
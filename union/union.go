@@ -25,9 +25,10 @@ const (
 
 type mountEntry struct {
 	c          *client.Client
-	f          *unionFile
+	f          fs.File
 	d          *unionDir
 	mountPoint string
+	option     MountOption
 	replace    bool
 	create     bool
 }
@@ -90,10 +91,17 @@ func (n *baseUnionNode) Stat() proto.Stat {
 }
 
 func (n *baseUnionNode) WriteStat(s *proto.Stat) error {
-	if n.mount.c == nil {
+	if n.mount.c == nil && n.mount.f == nil && n.mount.d == nil {
 		return fmt.Errorf("the root directory cannot be modified")
 	}
 
+	n.Lock()
+	if s.Name != "" && s.Name != filepath.Base(n.path) {
+		// The node has been renamed by its parent's RenameChild.
+		n.path = filepath.Join(filepath.Dir(n.path), s.Name)
+	}
+	n.Unlock()
+
 	rel, err := filepath.Rel(n.mount.mountPoint, n.path)
 	if err != nil {
 		return err
@@ -239,6 +247,9 @@ func (ud *unionDir) RemoveFile(f fs.FSNode) error {
 	if !ok {
 		return fmt.Errorf("cannot remove file that is not a union filesystem file")
 	}
+	if uf.mount.f != nil {
+		return fmt.Errorf("cannot remove a bound file")
+	}
 
 	rel, err := filepath.Rel(ud.mount.mountPoint, uf.path)
 	if err != nil {
@@ -262,6 +273,53 @@ func (ud *unionDir) RemoveFile(f fs.FSNode) error {
 	panic(fmt.Errorf("invalid mount table state"))
 }
 
+// RenameChild renames the child oldname of ud to newname, in the mount
+// it comes from. It fails if any mount in the union already has a child
+// named newname.
+func (ud *unionDir) RenameChild(oldname, newname string) error {
+	if oldname == newname {
+		return nil
+	}
+	children := ud.Children()
+	if _, ok := children[newname]; ok {
+		return fmt.Errorf("%s already exists", newname)
+	}
+	var n *baseUnionNode
+	switch c := children[oldname].(type) {
+	case *unionDir:
+		n = &c.baseUnionNode
+	case *unionFile:
+		n = &c.baseUnionNode
+	default:
+		return fmt.Errorf("%s does not exist", oldname)
+	}
+
+	rel, err := filepath.Rel(n.mount.mountPoint, n.path)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case n.mount.c != nil:
+		stat := proto.NullStat()
+		stat.Name = newname
+		return n.mount.c.WStat(rel, &stat)
+	case n.mount.d != nil:
+		on := n.mount.d.find(rel)
+		if on == nil {
+			return fmt.Errorf("stale mount")
+		}
+		if on.parent == nil {
+			return fmt.Errorf("cannot rename root")
+		}
+		return on.parent.RenameChild(oldname, newname)
+	case n.mount.f != nil:
+		return fmt.Errorf("cannot rename a bound file")
+	}
+
+	panic(fmt.Errorf("invalid mount table state"))
+}
+
 func (ud *unionDir) CreateFile(user, name string, perm uint32, mode uint8) (fs.File, error) {
 	// First, we find the mount that will permit creation
 	mte := ud.mount
@@ -388,8 +446,23 @@ func (ud *unionDir) Children() map[string]fs.FSNode {
 	mountTable := append([]mountEntry{}, ud.mountTable...)
 	ud.RUnlock()
 
+	// Files added to the union, such as the ns file, are listed whatever
+	// is mounted over their directory.
+	for _, me := range mountTable {
+		if me.f != nil && filepath.Dir(me.mountPoint) == ud.path {
+			n := baseUnionNode{
+				path:  me.mountPoint,
+				mount: me,
+			}
+			children[filepath.Base(me.mountPoint)] = newUnionFile(n)
+		}
+	}
+
 	// TODO consider a scatter/gather approach with goroutines since these can be I/O blocking
 	for _, me := range mountTable {
+		if me.f != nil {
+			continue
+		}
 		isCurrentMount := ud.mount.c == me.c && ud.mount.d == me.d && ud.mount.f == me.f
 
 		if ud.path != me.mountPoint && !isCurrentMount {
@@ -619,12 +692,16 @@ func removeUnionFile(fs *fs.FS, f fs.FSNode) error {
 }
 
 func NewUnionFS() *fs.FS {
-	return &fs.FS{
+	ufs := &fs.FS{
 		Root:       &unionDir{baseUnionNode: baseUnionNode{path: "/"}},
 		CreateFile: createUnionFile,
 		CreateDir:  createUnionDir,
 		RemoveFile: removeUnionFile,
 	}
+	// The first Qid is the root's, so that files added to the union
+	// do not share it.
+	ufs.NewQid(proto.DMDIR)
+	return ufs
 }
 
 // Mount a 9p client into the union filesystem at the old path.
@@ -632,6 +709,8 @@ func NewUnionFS() *fs.FS {
 // The provided filesystem must be a union filesystem created with NewUnionFS().
 // The create parameter indicates whether new files or directories at the old path
 // should be created with this client, unless a higher priority mount is also create.
+// Stats of the mounted files are asked of c each time, so a client made with
+// client.WithCache avoids asking the server for them again.
 func Mount(fs *fs.FS, c *client.Client, old string, option MountOption, create bool) error {
 	root, ok := fs.Root.(*unionDir)
 	if !ok {
@@ -641,6 +720,7 @@ func Mount(fs *fs.FS, c *client.Client, old string, option MountOption, create b
 	entry := mountEntry{
 		c:          c,
 		mountPoint: old,
+		option:     option,
 		replace:    option == REPLACE,
 		create:     create,
 	}
@@ -679,6 +759,7 @@ func Bind(fs *fs.FS, path string, old string, option MountOption, create bool) e
 	entry := mountEntry{
 		d:          pathdir,
 		mountPoint: old,
+		option:     option,
 		replace:    option == REPLACE,
 		create:     create,
 	}
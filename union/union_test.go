@@ -394,3 +394,115 @@ func TestUnionMountBin(t *testing.T) {
 		t.Fatalf("/usr hasn't been unmounted")
 	}
 }
+
+func TestRename(t *testing.T) {
+	lowerfs, lowerdir := newFS()
+	lowerdir.AddChild(newStaticFile(lowerfs, "one", "1\n"))
+	lowerpipe := startServer(lowerfs)
+	defer lowerpipe.Close()
+
+	upperfs, upperdir := newFS()
+	upperdir.AddChild(newStaticFile(upperfs, "two", "2\n"))
+	upperpipe := startServer(upperfs)
+	defer upperpipe.Close()
+
+	ufs := NewUnionFS()
+	lowerc := mustNewClient(lowerpipe)
+	mustMount(ufs, lowerc, "/", AFTER, false)
+	defer UnmountClient(ufs, lowerc, "/")
+	upperc := mustNewClient(upperpipe)
+	mustMount(ufs, upperc, "/", BEFORE, false)
+	defer UnmountClient(ufs, upperc, "/")
+
+	root, ok := ufs.Root.(fs.Renamer)
+	if !ok {
+		t.Fatalf("union directories are not Renamers")
+	}
+
+	// Names in any mount conflict.
+	if err := root.RenameChild("one", "two"); err == nil {
+		t.Fatalf("renamed one over two")
+	}
+
+	// As the fs server does, stat the node before renaming it.
+	n := ufs.Root.Children()["one"]
+	st := n.Stat()
+	if err := root.RenameChild("one", "uno"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lowerdir.Children()["uno"]; !ok {
+		t.Fatalf("uno was not renamed in its mount")
+	}
+	assertFile(ufs.Root, "uno", "1\n")
+	if _, ok := ufs.Root.Children()["one"]; ok {
+		t.Fatalf("one is still in the union")
+	}
+
+	// The renamed node follows its new name.
+	st.Name = "uno"
+	if err := n.WriteStat(&st); err != nil {
+		t.Fatal(err)
+	}
+	if name := n.Stat().Name; name != "uno" {
+		t.Fatalf("renamed node is named %q", name)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	rootfs, rootfsdir := newFS()
+	bindir := newStaticDir(rootfs, "bin")
+	bindir.AddChild(newStaticFile(rootfs, "ls", "Binary data\n"))
+	rootfsdir.AddChild(bindir)
+	rootfsdir.AddChild(newStaticDir(rootfs, "usr"))
+	rootpipe := startServer(rootfs)
+	defer rootpipe.Close()
+
+	usrfs, usrfsdir := newFS()
+	usrfsdir.AddChild(newStaticDir(usrfs, "bin"))
+	usrpipe := startServer(usrfs)
+	defer usrpipe.Close()
+
+	ufs := NewUnionFS()
+	rootc := mustNewClient(rootpipe)
+	mustMount(ufs, rootc, "/", AFTER, false)
+	usrc := mustNewClient(usrpipe)
+	mustMount(ufs, usrc, "/usr", BEFORE, true)
+	mustBind(ufs, "/usr/bin", "/bin", AFTER, false)
+
+	ns, err := Namespace(ufs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NamespaceEntry{
+		{Old: "/usr", Source: usrc.String(), Client: usrc, Option: BEFORE, Create: true},
+		{Old: "/", Source: rootc.String(), Client: rootc, Option: AFTER},
+		{Old: "/bin", Source: "/usr/bin", Option: AFTER},
+	}
+	if fmt.Sprint(ns) != fmt.Sprint(want) {
+		t.Fatalf("namespace is %v, not %v", ns, want)
+	}
+
+	// The ns file is not part of the namespace it lists, and stays
+	// when its directory is replaced.
+	if err := AddNamespaceFile(ufs, "/ns"); err != nil {
+		t.Fatal(err)
+	}
+	text := fmt.Sprintf("mount -bc %s /usr\nmount -a %s /\nbind -a /usr/bin /bin\n", usrc, rootc)
+	assertFile(ufs.Root, "ns", text)
+	mustBind(ufs, "/usr", "/", REPLACE, false)
+	text = "bind /usr /\n" + text
+	assertFile(ufs.Root, "ns", text)
+	if len(ufs.Root.Children()) != 2 {
+		t.Fatalf("/ has not been replaced with /usr: %s", ufs.Root)
+	}
+
+	if s := (NamespaceEntry{Old: "/n/my dir", Source: "#s/boot", Option: REPLACE}).String(); s != "bind '#s/boot' '/n/my dir'" {
+		t.Fatalf("entry is formatted as %s", s)
+	}
+	if _, err := UnmountPoint(ufs, "/ns"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ufs.Root.Children()["ns"]; ok {
+		t.Fatalf("ns has not been removed")
+	}
+}